@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"flash_sale/internal/adminkey"
+	"flash_sale/internal/audit"
+	"flash_sale/internal/config"
+	"flash_sale/internal/storage"
+)
+
+const usage = `usage:
+  adminkey create -name n -role r [-scopes a,b] [-ttl d]   issue a key (printed once)
+  adminkey list                                            list keys
+  adminkey rotate -id n [-grace d]                         issue a replacement, old key expires after grace
+  adminkey revoke -id n                                    revoke a key immediately`
+
+// 管理密钥命令，与服务端共用环境变量（DB_DRIVER / DB_DSN / DB_PATH 等），直接读写 DB。
+// 用于首次部署签发 admin 密钥（不依赖 ADMIN_BOOTSTRAP_KEY），以及密钥全部丢失时的恢复。
+// 签发 / 轮换 / 吊销同样写入审计事件，操作者记为 cli:adminkey。
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	name := fs.String("name", "", "key name")
+	role := fs.String("role", "", "viewer / operator / admin")
+	scopes := fs.String("scopes", "", "comma separated scopes (empty for all scopes of the role)")
+	ttl := fs.Duration("ttl", 0, "key lifetime (0 for no expiry)")
+	id := fs.Uint("id", 0, "key id")
+	grace := fs.Duration("grace", 0, "how long the old key stays valid after rotation")
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("config load: %v", err)
+	}
+	db, err := storage.Open(cfg)
+	if err != nil {
+		log.Fatalf("db open: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx = audit.WithActor(ctx, "cli:adminkey")
+
+	var out any
+	switch cmd {
+	case "create":
+		if *name == "" || *role == "" {
+			log.Fatal("-name and -role are required")
+		}
+		var list []string
+		if *scopes != "" {
+			list = strings.Split(*scopes, ",")
+		}
+		out, err = adminkey.Create(ctx, db, *name, adminkey.Role(*role), list, *ttl)
+	case "list":
+		out, err = adminkey.List(ctx, db)
+	case "rotate":
+		out, err = adminkey.Rotate(ctx, db, *id, *grace)
+	case "revoke":
+		out, err = adminkey.Revoke(ctx, db, *id)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", cmd, err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		log.Fatalf("encode: %v", err)
+	}
+}
@@ -7,8 +7,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"flash_sale/internal/auth"
+	"flash_sale/internal/pow"
+
+	"github.com/google/uuid"
 )
 
 // Result 记录单次请求的 HTTP 结果，便于聚合统计。
@@ -21,9 +28,16 @@ type Result struct {
 func main() {
 	baseURL := flag.String("base", "http://localhost:8080", "server base url")
 	productID := flag.Int("product", 1, "product id")
+	skuID := flag.Int("sku", 0, "sku id (0 for products without skus)")
 	preload := flag.Bool("preload", true, "call preload before test")
-	adminToken := flag.String("admin-token", "dev-admin-token", "admin token for preload endpoint")
+	adminToken := flag.String("admin-token", "dev-admin-token", "admin API key with stock:preload scope")
 	stockCheck := flag.Bool("stock", true, "check redis stock after test")
+	// 服务端开启 JWT_ENABLED 时，用同一 HS256 密钥为每个压测用户签发令牌。
+	jwtSecret := flag.String("jwt-secret", "", "HS256 secret to mint per-user bearer tokens (empty: no auth header)")
+	// 服务端开启 SIGNED_REQUESTS_ENABLED 时，按 client_id:secret 为每个请求签名。
+	signKey := flag.String("sign", "", "client_id:secret to sign buy requests (empty: unsigned)")
+	// 服务端开启 POW_ENABLED 时，每次下单前领取并求解挑战。
+	solvePow := flag.Bool("pow", false, "fetch and solve a proof-of-work challenge before each buy")
 
 	// 超卖测试参数：200 个用户并发抢 1 件
 	nUsers := flag.Int("users", 200, "distinct users")
@@ -31,6 +45,8 @@ func main() {
 	flag.Parse()
 
 	client := &http.Client{Timeout: 5 * time.Second}
+	clientID, signSecret, _ := strings.Cut(*signKey, ":")
+	opts := clientOptions{jwtSecret: *jwtSecret, signClient: clientID, signSecret: signSecret, pow: *solvePow}
 
 	if *preload {
 		// 先预热 Redis 库存，再发并发请求，避免库存 key 缺失导致测试偏差。
@@ -44,12 +60,12 @@ func main() {
 
 	// 1) 不超卖测试：不同 user 并发
 	fmt.Printf("start oversell test: product=%d users=%d concurrency=%d\n", *productID, *nUsers, *concurrency)
-	results := runBuy(client, *baseURL, *productID, *nUsers, *concurrency)
+	results := runBuy(client, opts, *baseURL, *productID, *skuID, *nUsers, *concurrency)
 
 	printSummary("oversell", results)
 
 	if *stockCheck {
-		stock, err := getStock(client, *baseURL, *productID)
+		stock, err := getStock(client, *baseURL, *productID, *skuID)
 		if err != nil {
 			fmt.Println("stock check err:", err)
 		} else {
@@ -61,13 +77,14 @@ func main() {
 	// 注意：你现在的限流是 1000/s，很难触发。建议临时把路由里的限流改成 5/s 再测：
 	// middleware.RedisRateLimit(rdb, 5, time.Second)
 	fmt.Println("\nstart rate limit test: same user (10001), 50 requests, concurrency 50")
-	results2 := runBuySameUser(client, *baseURL, *productID, 10001, 50, 50)
+	results2 := runBuySameUser(client, opts, *baseURL, *productID, *skuID, 10001, 50, 50)
 	printSummary("rate_limit", results2)
 }
 
-func runBuy(client *http.Client, baseURL string, productID int, nUsers int, concurrency int) []Result {
+func runBuy(client *http.Client, opts clientOptions, baseURL string, productID int, skuID int, nUsers int, concurrency int) []Result {
 	type Req struct {
 		ProductID int   `json:"product_id"`
+		SKUID     int   `json:"sku_id,omitempty"`
 		UserID    int64 `json:"user_id"`
 		Quantity  int   `json:"quantity"`
 	}
@@ -83,8 +100,8 @@ func runBuy(client *http.Client, baseURL string, productID int, nUsers int, conc
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			req := Req{ProductID: productID, UserID: int64(idx + 1), Quantity: 1}
-			results[idx] = buyOnce(client, baseURL, req)
+			req := Req{ProductID: productID, SKUID: skuID, UserID: int64(idx + 1), Quantity: 1}
+			results[idx] = buyOnce(client, opts, baseURL, req, productID, req.UserID)
 		}(i)
 	}
 
@@ -92,9 +109,10 @@ func runBuy(client *http.Client, baseURL string, productID int, nUsers int, conc
 	return results
 }
 
-func runBuySameUser(client *http.Client, baseURL string, productID int, userID int64, total int, concurrency int) []Result {
+func runBuySameUser(client *http.Client, opts clientOptions, baseURL string, productID int, skuID int, userID int64, total int, concurrency int) []Result {
 	type Req struct {
 		ProductID int   `json:"product_id"`
+		SKUID     int   `json:"sku_id,omitempty"`
 		UserID    int64 `json:"user_id"`
 		Quantity  int   `json:"quantity"`
 	}
@@ -110,8 +128,8 @@ func runBuySameUser(client *http.Client, baseURL string, productID int, userID i
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			req := Req{ProductID: productID, UserID: userID, Quantity: 1}
-			results[idx] = buyOnce(client, baseURL, req)
+			req := Req{ProductID: productID, SKUID: skuID, UserID: userID, Quantity: 1}
+			results[idx] = buyOnce(client, opts, baseURL, req, productID, req.UserID)
 		}(i)
 	}
 
@@ -119,11 +137,20 @@ func runBuySameUser(client *http.Client, baseURL string, productID int, userID i
 	return results
 }
 
-func buyOnce(client *http.Client, baseURL string, req any) Result {
+func buyOnce(client *http.Client, opts clientOptions, baseURL string, req any, productID int, userID int64) Result {
 	b, _ := json.Marshal(req)
 	url := fmt.Sprintf("%s/api/flash_sale/buy", baseURL)
 	httpReq, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
 	httpReq.Header.Set("Content-Type", "application/json")
+	opts.apply(httpReq, userID, b)
+	if opts.pow {
+		challenge, solution, err := solveChallenge(client, opts, baseURL, productID, userID)
+		if err != nil {
+			return Result{Err: err}
+		}
+		httpReq.Header.Set("X-PoW-Challenge", challenge)
+		httpReq.Header.Set("X-PoW-Solution", solution)
+	}
 
 	resp, err := client.Do(httpReq)
 	if err != nil {
@@ -134,6 +161,58 @@ func buyOnce(client *http.Client, baseURL string, req any) Result {
 	return Result{Status: resp.StatusCode, Body: string(body)}
 }
 
+// clientOptions 为压测请求附加鉴权信息：按用户签发的 JWT、请求签名与工作量证明，均未开启时不附加。
+type clientOptions struct {
+	jwtSecret  string
+	signClient string
+	signSecret string
+	pow        bool
+}
+
+func (o clientOptions) apply(req *http.Request, userID int64, body []byte) {
+	if o.jwtSecret != "" {
+		token, err := auth.SignHS256(o.jwtSecret, userID, "", "", time.Hour)
+		if err != nil {
+			panic(fmt.Sprintf("sign token: %v", err))
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if o.signClient != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonce := uuid.New().String()
+		req.Header.Set(auth.HeaderClientID, o.signClient)
+		req.Header.Set(auth.HeaderTimestamp, timestamp)
+		req.Header.Set(auth.HeaderNonce, nonce)
+		req.Header.Set(auth.HeaderSignature, auth.SignRequest(o.signSecret, req.Method, req.URL.Path, timestamp, nonce, body))
+	}
+}
+
+// solveChallenge 领取并求解下单用的工作量证明挑战。
+func solveChallenge(client *http.Client, opts clientOptions, baseURL string, productID int, userID int64) (string, string, error) {
+	url := fmt.Sprintf("%s/api/flash_sale/challenge/%d?user_id=%d", baseURL, productID, userID)
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	opts.apply(req, userID, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return "", "", fmt.Errorf("challenge status=%d body=%s", resp.StatusCode, string(b))
+	}
+	var out struct {
+		Data struct {
+			Challenge  string `json:"challenge"`
+			Difficulty int    `json:"difficulty"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return "", "", err
+	}
+	return out.Data.Challenge, pow.Solve(out.Data.Challenge, out.Data.Difficulty), nil
+}
+
 // printSummary 聚合输出不同状态码分布。
 func printSummary(name string, results []Result) {
 	count := map[int]int{}
@@ -146,7 +225,7 @@ func printSummary(name string, results []Result) {
 		count[r.Status]++
 	}
 	fmt.Printf("[%s] http status summary:\n", name)
-	for _, code := range []int{200, 400, 404, 429, 500} {
+	for _, code := range []int{200, 400, 401, 403, 404, 409, 429, 500} {
 		if count[code] > 0 {
 			fmt.Printf("  %d -> %d\n", code, count[code])
 		}
@@ -183,8 +262,8 @@ func doPOST(client *http.Client, url string, body any, headers map[string]string
 }
 
 // getStock 查询 Redis 中当前库存，用于压测后校验是否出现超卖。
-func getStock(client *http.Client, baseURL string, productID int) (int64, error) {
-	url := fmt.Sprintf("%s/api/flash_sale/stock/%d", baseURL, productID)
+func getStock(client *http.Client, baseURL string, productID int, skuID int) (int64, error) {
+	url := fmt.Sprintf("%s/api/flash_sale/stock/%d?sku_id=%d", baseURL, productID, skuID)
 	resp, err := client.Get(url)
 	if err != nil {
 		return 0, err
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"flash_sale/internal/config"
+	"flash_sale/internal/migrate"
+	"flash_sale/internal/storage"
+)
+
+const usage = `usage:
+  migrate up [-to version]    apply pending migrations (up to version, default latest)
+  migrate down [-steps n]     roll back the last n applied migrations (default 1)
+  migrate status              list migrations and whether they are applied`
+
+// 数据库迁移命令，与服务端共用环境变量（DB_DRIVER / DB_DSN / DB_PATH 等）。
+// up / down 期间持有迁移锁，可与正在启动的服务实例并发执行。
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	to := fs.Int64("to", 0, "target version for up (0 for latest)")
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("config load: %v", err)
+	}
+	db, err := storage.Open(cfg)
+	if err != nil {
+		log.Fatalf("db open: %v", err)
+	}
+	m := migrate.NewMigrator(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	switch cmd {
+	case "up":
+		applied, err := m.Up(ctx, *to)
+		for _, mg := range applied {
+			log.Printf("applied %d %s", mg.Version, mg.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate up: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Printf("no pending migrations")
+		}
+	case "down":
+		if *steps <= 0 {
+			log.Fatalf("-steps must be > 0")
+		}
+		reverted, err := m.Down(ctx, *steps)
+		for _, mg := range reverted {
+			log.Printf("reverted %d %s", mg.Version, mg.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate down: %v", err)
+		}
+	case "status":
+		list, err := m.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate status: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, st := range list {
+			at := "pending"
+			if st.AppliedAt != nil {
+				at = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, at)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
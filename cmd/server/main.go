@@ -9,34 +9,75 @@ import (
 	"syscall"
 	"time"
 
+	"flash_sale/internal/adminkey"
+	"flash_sale/internal/audit"
+	"flash_sale/internal/auth"
+	"flash_sale/internal/campaign"
 	"flash_sale/internal/config"
-	"flash_sale/internal/model"
+	"flash_sale/internal/lottery"
+	"flash_sale/internal/migrate"
+	"flash_sale/internal/notify"
+	"flash_sale/internal/order"
+	"flash_sale/internal/pow"
 	"flash_sale/internal/queue"
+	"flash_sale/internal/repository"
+	"flash_sale/internal/risk"
 	"flash_sale/internal/router"
+	"flash_sale/internal/storage"
+	"flash_sale/internal/waitroom"
 
 	"github.com/gin-gonic/gin"
 	rd "github.com/redis/go-redis/v9"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
 // main 负责初始化依赖并启动 HTTP 服务。
-// 启动顺序：配置 -> DB -> Redis -> Producer/Relay/Consumer -> Router -> HTTP Server。
+// 启动顺序：配置 -> DB -> Redis -> 下单链路（Relay+Broker 或 Stream 直连）/超时取消/滞留清扫/活动调度 -> Router -> HTTP Server。
 func main() {
 	// 1) 加载配置（支持环境变量覆盖默认值）
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("config load: %v", err)
 	}
+	// JWT 鉴权：启动时加载密钥（JWKS 文件无效直接退出）
+	var verifier *auth.Verifier
+	if cfg.JWTEnabled {
+		verifier, err = auth.NewVerifier(cfg.JWTHS256Secrets, cfg.JWTJWKSFile, cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTLeeway)
+		if err != nil {
+			log.Fatalf("jwt: %v", err)
+		}
+	} else {
+		log.Printf("jwt: disabled, user identity is taken from the request user_id (local debugging only)")
+	}
 
-	// 2) 连接 SQLite，自动建表（包含订单请求状态表）
-	db, err := gorm.Open(sqlite.Open(cfg.DBPath), &gorm.Config{})
+	// 2) 按 DB_DRIVER 连接 SQLite / PostgreSQL / MySQL，执行（或校验）版本化迁移
+	db, err := storage.Open(cfg)
 	if err != nil {
 		log.Fatalf("db open: %v", err)
 	}
-	if err := db.AutoMigrate(&model.Product{}, &model.Order{}, &model.OrderRequest{}); err != nil {
-		log.Fatalf("db migrate: %v", err)
+	migrator := migrate.NewMigrator(db)
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 5*time.Minute)
+	if cfg.DBAutoMigrate {
+		applied, err := migrator.Up(migrateCtx, 0)
+		if err != nil {
+			log.Fatalf("db migrate: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("db migration applied: %d %s", m.Version, m.Name)
+		}
+	} else {
+		pending, err := migrator.Pending(migrateCtx)
+		if err != nil {
+			log.Fatalf("db migration status: %v", err)
+		}
+		if pending > 0 {
+			log.Fatalf("db schema out of date: %d pending migrations, run `go run ./cmd/migrate up`", pending)
+		}
+	}
+	// 登记初始管理密钥（已存在则跳过），之后用它签发正式密钥；未配置且没有可用的 admin 密钥时拒绝启动
+	if err := adminkey.EnsureBootstrap(audit.WithActor(migrateCtx, "system:bootstrap"), db, cfg.AdminBootstrapKey); err != nil {
+		log.Fatalf("admin bootstrap key: %v", err)
 	}
+	cancelMigrate()
 
 	// 3) 初始化 Redis 客户端并做启动连通性探测
 	rdb := rd.NewClient(&rd.Options{
@@ -52,23 +93,88 @@ func main() {
 		log.Fatalf("redis: %v", err)
 	}
 
-	// 4) 初始化 Kafka 生产者、Relay 与消费者
-	producer := queue.NewProducer(cfg.KafkaBrokers, cfg.KafkaTopic)
-	defer producer.Close()
-
-	relay := queue.NewRelay(rdb, producer, cfg.OrderEventStream, cfg.OrderEventGroup, cfg.OrderEventConsumer)
+	// 4) 按链路模式初始化消费端（relay：Broker + Relay；stream：直连 outbox），以及超时取消、滞留请求清扫与活动调度任务
+	claim := queue.ClaimPolicy{
+		MinIdle:   cfg.OrderEventClaimMinIdle,
+		Interval:  cfg.OrderEventClaimInterval,
+		MaxClaims: cfg.OrderEventMaxClaims,
+	}
 
-	consumer := queue.NewConsumer(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroupID, db, rdb)
-	defer consumer.Close()
+	store := repository.NewGormStore(db)
+	states := repository.NewRedisStateCache(rdb)
+	inventory := repository.NewRedisInventory(rdb, cfg.OrderEventStream)
 
 	consumerCtx, cancelConsumer := context.WithCancel(context.Background())
 	defer cancelConsumer()
-	go relay.Run(consumerCtx)
+
+	var consumer *queue.Consumer
+	var brokerDLQ *queue.BrokerDLQ
+	switch cfg.PipelineMode {
+	case config.PipelineStream:
+		// 仅 Redis + DB：Consumer 以独立消费者组读取 outbox，死信写回 <stream>:dlq。
+		sub := queue.NewStreamSubscriber(rdb, cfg.OrderEventStream, cfg.StreamConsumerGroup, cfg.OrderEventConsumer, claim)
+		consumer = queue.NewConsumer(sub, store, states, inventory, cfg.OrderPayTimeout, queue.NewStreamDLQ(rdb, cfg.OrderEventStream), cfg.OrderEventMaxAttempts)
+	default:
+		var broker queue.Broker
+		switch cfg.Broker {
+		case config.BrokerMemory:
+			broker = queue.NewMemoryBroker()
+		default:
+			broker = queue.NewKafkaBroker(cfg.KafkaBrokers)
+		}
+		log.Printf("message broker: %s", cfg.Broker)
+
+		publisher := broker.Publisher(cfg.KafkaTopic)
+		defer publisher.Close()
+
+		relay := queue.NewRelay(rdb, publisher, cfg.OrderEventStream, cfg.OrderEventGroup, cfg.OrderEventConsumer, claim)
+
+		brokerDLQ = queue.NewBrokerDLQ(broker, cfg.KafkaDLQTopic, rdb, publisher)
+		defer brokerDLQ.Close()
+
+		consumer = queue.NewConsumer(broker.Subscriber(cfg.KafkaTopic, cfg.KafkaGroupID), store, states, inventory, cfg.OrderPayTimeout, brokerDLQ, cfg.KafkaMaxAttempts)
+		go relay.Run(consumerCtx)
+	}
+	defer consumer.Close()
+	log.Printf("order pipeline: %s", cfg.PipelineMode)
+
+	expiry := order.NewExpiryWorker(db, rdb, cfg.OrderExpiryInterval, cfg.OrderExpiryBatch)
+	scheduler := campaign.NewScheduler(db, rdb, cfg.CampaignWarmupLead, cfg.CampaignScheduleInterval, cfg.StockCacheTTL)
+	drawer := lottery.NewDrawer(db, rdb, cfg.OrderEventStream, cfg.LotteryScheduleInterval, cfg.StockCacheTTL)
+	sweeper := queue.NewPendingSweeper(db, rdb, cfg.OrderEventStream, cfg.PendingSweepThreshold, cfg.PendingSweepInterval, cfg.PendingSweepBatch)
+
 	go consumer.Run(consumerCtx)
+	go expiry.Run(consumerCtx)
+	go scheduler.Run(consumerCtx)
+	go drawer.Run(consumerCtx)
+	go sweeper.Run(consumerCtx)
+
+	// 请求终态推送：单个 pub/sub 订阅分发给本实例的 SSE / WebSocket 连接
+	hub := notify.NewResultHub(rdb)
+	go hub.Run(consumerCtx)
+
+	// 等待室：按速率放行排队用户，下单需凭准入凭证
+	var room *waitroom.Room
+	if cfg.WaitingRoomEnabled {
+		room = waitroom.NewRoom(rdb, store.Products(), cfg.WaitingRoomSecret, cfg.WaitingRoomAdmitRate, cfg.WaitingRoomAdmitInterval, cfg.WaitingRoomTokenTTL)
+		go room.Run(consumerCtx)
+	}
+
+	// 风控评估：黑名单始终生效；配置外部风控服务后按其结论放行、拒绝或要求人机校验
+	var evaluator risk.Evaluator
+	if cfg.RiskEvaluatorURL != "" {
+		evaluator = risk.NewHTTPEvaluator(cfg.RiskEvaluatorURL, cfg.RiskEvaluatorTimeout)
+	}
+
+	// 工作量证明：下单前须求解挑战，难度随入口 QPS 调整；风控要求人机校验时同样使用
+	var gate *pow.Gate
+	if cfg.PowEnabled || evaluator != nil {
+		gate = pow.NewGate(rdb, cfg.PowSecret, cfg.PowMinDifficulty, cfg.PowMaxDifficulty, float64(cfg.PowBaseQPS), cfg.PowChallengeTTL)
+	}
 
 	// 5) 初始化路由并交给 HTTP Server
 	r := gin.Default()
-	router.Setup(r, db, rdb, cfg)
+	router.Setup(r, db, rdb, cfg, brokerDLQ, hub, room, verifier, gate, evaluator)
 
 	srv := &http.Server{
 		Addr:    cfg.HTTPAddr,
@@ -78,7 +184,7 @@ func main() {
 	appCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// 6) 收到退出信号后，先停 worker（relay/consumer），再优雅关闭 HTTP 服务
+	// 6) 收到退出信号后，先停 worker（relay/consumer/expiry/sweeper/campaign），再优雅关闭 HTTP 服务
 	go func() {
 		<-appCtx.Done()
 		cancelConsumer()
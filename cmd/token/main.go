@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"flash_sale/internal/auth"
+)
+
+// 令牌签发命令：用 JWT_HS256_SECRETS 中的第一个密钥签发 HS256 令牌，供本地调试（curl / 压测）使用。
+// 示例：go run ./cmd/token -user 10001
+func main() {
+	userID := flag.Int64("user", 0, "user id (sub claim)")
+	ttl := flag.Duration("ttl", time.Hour, "token lifetime")
+	secret := flag.String("secret", firstSecret(os.Getenv("JWT_HS256_SECRETS")), "HS256 secret (default: first of JWT_HS256_SECRETS)")
+	issuer := flag.String("iss", os.Getenv("JWT_ISSUER"), "iss claim")
+	audience := flag.String("aud", os.Getenv("JWT_AUDIENCE"), "aud claim")
+	flag.Parse()
+
+	if *userID <= 0 {
+		log.Fatal("-user is required")
+	}
+	token, err := auth.SignHS256(*secret, *userID, *issuer, *audience, *ttl)
+	if err != nil {
+		log.Fatalf("sign: %v", err)
+	}
+	fmt.Println(token)
+}
+
+func firstSecret(csv string) string {
+	first, _, _ := strings.Cut(csv, ",")
+	return strings.TrimSpace(first)
+}
@@ -0,0 +1,313 @@
+package adminkey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidKey 表示密钥缺失、不存在、已吊销或已过期（对调用方不区分，避免探测）。
+	ErrInvalidKey = errors.New("invalid admin key")
+	// ErrKeyNotFound 表示按 ID 管理的密钥不存在。
+	ErrKeyNotFound = errors.New("admin key not found")
+	// ErrKeyInactive 表示密钥已吊销或已过期，不能再轮换。
+	ErrKeyInactive = errors.New("admin key revoked or expired")
+	// ErrInvalidRole 表示角色不是 viewer / operator / admin。
+	ErrInvalidRole = errors.New("invalid admin role")
+	// ErrInvalidScope 表示权限不存在或超出角色范围。
+	ErrInvalidScope = errors.New("invalid admin scope")
+	// ErrLastAdmin 表示不能吊销最后一个可用的 admin 密钥（否则无法再管理密钥）。
+	ErrLastAdmin = errors.New("cannot revoke the last active admin key")
+	// ErrNoAdminKey 表示未配置初始密钥且库中没有可用的 admin 密钥。
+	ErrNoAdminKey = errors.New("no active admin key: set ADMIN_BOOTSTRAP_KEY or issue one with cmd/adminkey")
+)
+
+const (
+	// 生成的密钥形如 fsk_<8 位十六进制>_<43 位 base64url>，前 PrefixLen 个字符作为可公开的前缀。
+	keyMarker = "fsk_"
+	PrefixLen = 12
+
+	bootstrapName = "bootstrap"
+	// LastUsedAt 的刷新粒度，避免每次管理请求都写库。
+	lastUsedResolution = time.Minute
+	// 签发时前缀冲突的重试次数。
+	issueAttempts = 3
+)
+
+// 前缀不存在时参与比较的摘要，使耗时与前缀存在时一致。
+var dummyHash = hashKey("flash_sale:admin-key:dummy")
+
+// Issued 为新签发的密钥，Key 为明文，只在创建 / 轮换的响应中出现一次。
+type Issued struct {
+	model.AdminKey
+	Key string `json:"key"`
+}
+
+// Create 签发密钥。scopes 为空表示角色的全部权限，否则必须是角色权限的子集；ttl 为 0 表示不过期。
+// 同一事务内写入 admin_key.create 审计事件。
+func Create(ctx context.Context, db *gorm.DB, name string, role Role, scopes []string, ttl time.Duration) (Issued, error) {
+	if _, ok := roleScopes[role]; !ok {
+		return Issued{}, ErrInvalidRole
+	}
+	scopeList, err := parseScopes(role, scopes)
+	if err != nil {
+		return Issued{}, err
+	}
+	var out Issued
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if out, err = issue(tx, name, role, scopeList, ttl, nil); err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, audit.ActionKeyCreate, out.AdminKey, nil)
+	})
+	return out, err
+}
+
+// List 列出全部密钥（不含摘要）。
+func List(ctx context.Context, db *gorm.DB) ([]model.AdminKey, error) {
+	var keys []model.AdminKey
+	err := db.WithContext(ctx).Order("id ASC").Find(&keys).Error
+	return keys, err
+}
+
+// Rotate 为密钥签发同名、同角色、同权限的新密钥（原密钥设置了有效期时新密钥沿用相同时长）。
+// grace 为 0 时旧密钥立即吊销，否则在 grace 后过期，供调用方切换。同一事务内写入 admin_key.rotate 审计事件。
+func Rotate(ctx context.Context, db *gorm.DB, id uint, grace time.Duration) (Issued, error) {
+	var out Issued
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		old, err := getForUpdate(tx, id)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if !old.Active(now) {
+			return ErrKeyInactive
+		}
+		var ttl time.Duration
+		if old.ExpiresAt != nil {
+			ttl = old.ExpiresAt.Sub(old.CreatedAt)
+		}
+		if out, err = issue(tx, old.Name, Role(old.Role), old.Scopes, ttl, &old.ID); err != nil {
+			return err
+		}
+		if err := recordEvent(ctx, tx, audit.ActionKeyRotate, old, map[string]any{
+			"new_id":     out.ID,
+			"new_prefix": out.Prefix,
+			"grace_sec":  int64(grace / time.Second),
+		}); err != nil {
+			return err
+		}
+
+		if grace <= 0 {
+			return tx.Model(&model.AdminKey{}).Where("id = ?", id).Update("revoked_at", now).Error
+		}
+		expiresAt := now.Add(grace)
+		if old.ExpiresAt != nil && old.ExpiresAt.Before(expiresAt) {
+			return nil
+		}
+		return tx.Model(&model.AdminKey{}).Where("id = ?", id).Update("expires_at", expiresAt).Error
+	})
+	return out, err
+}
+
+// Revoke 吊销密钥，重复吊销返回原记录（不重复记录审计）。至少保留一个可用的 admin 密钥。
+func Revoke(ctx context.Context, db *gorm.DB, id uint) (model.AdminKey, error) {
+	var out model.AdminKey
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		k, err := getForUpdate(tx, id)
+		if err != nil {
+			return err
+		}
+		out = k
+		if k.RevokedAt != nil {
+			return nil
+		}
+		now := time.Now()
+		if Role(k.Role) == RoleAdmin && k.Active(now) {
+			// 锁住全部未吊销的 admin 密钥，防止并发吊销同时通过检查。
+			var admins []model.AdminKey
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("role = ? AND revoked_at IS NULL AND id <> ?", RoleAdmin, id).
+				Find(&admins).Error; err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(admins, func(a model.AdminKey) bool { return a.Active(now) }) {
+				return ErrLastAdmin
+			}
+		}
+		out.RevokedAt = &now
+		if err := tx.Model(&model.AdminKey{}).Where("id = ?", id).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, audit.ActionKeyRevoke, k, nil)
+	})
+	return out, err
+}
+
+// Authenticate 校验明文密钥：按前缀定位后以常量时间比较摘要，要求未吊销且未过期。
+func Authenticate(ctx context.Context, db *gorm.DB, key string) (model.AdminKey, error) {
+	if len(key) < PrefixLen {
+		return model.AdminKey{}, ErrInvalidKey
+	}
+	db = db.WithContext(ctx)
+	var k model.AdminKey
+	res := db.Where("prefix = ?", key[:PrefixLen]).Limit(1).Find(&k)
+	if res.Error != nil {
+		return model.AdminKey{}, res.Error
+	}
+	stored := k.KeyHash
+	if res.RowsAffected == 0 {
+		stored = dummyHash
+	}
+	match := subtle.ConstantTimeCompare([]byte(hashKey(key)), []byte(stored)) == 1
+	now := time.Now()
+	if res.RowsAffected == 0 || !match || !k.Active(now) {
+		return model.AdminKey{}, ErrInvalidKey
+	}
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedResolution {
+		if err := db.Model(&model.AdminKey{}).Where("id = ?", k.ID).Update("last_used_at", now).Error; err != nil {
+			log.Printf("admin key %s: update last_used_at: %v", k.Prefix, err)
+		}
+		k.LastUsedAt = &now
+	}
+	return k, nil
+}
+
+// Allowed 判断密钥是否拥有权限：角色包含该权限，且密钥未限定权限或限定的权限中包含它。
+func Allowed(k model.AdminKey, s Scope) bool {
+	if !Role(k.Role).Allows(s) {
+		return false
+	}
+	return k.Scopes == "" || slices.Contains(strings.Split(k.Scopes, ","), string(s))
+}
+
+// EnsureBootstrap 将部署时配置的初始密钥登记为 admin 密钥，用于创建正式密钥。
+// key 为空时不登记，库中没有可用的 admin 密钥则返回 ErrNoAdminKey，不使用任何内置默认密钥。
+// 前缀已存在时不再写入：吊销后的初始密钥不会因重启恢复。
+func EnsureBootstrap(ctx context.Context, db *gorm.DB, key string) error {
+	if key == "" {
+		var admins []model.AdminKey
+		if err := db.WithContext(ctx).Where("role = ? AND revoked_at IS NULL", RoleAdmin).Find(&admins).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if !slices.ContainsFunc(admins, func(a model.AdminKey) bool { return a.Active(now) }) {
+			return ErrNoAdminKey
+		}
+		return nil
+	}
+	if len(key) < PrefixLen {
+		return ErrInvalidKey
+	}
+	db = db.WithContext(ctx)
+	var existing model.AdminKey
+	res := db.Where("prefix = ?", key[:PrefixLen]).Limit(1).Find(&existing)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 1 {
+		if existing.KeyHash != hashKey(key) {
+			log.Printf("admin bootstrap key ignored: prefix %s already used by key %d", existing.Prefix, existing.ID)
+		}
+		return nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		k := model.AdminKey{
+			Name:    bootstrapName,
+			Prefix:  key[:PrefixLen],
+			KeyHash: hashKey(key),
+			Role:    string(RoleAdmin),
+		}
+		if err := tx.Create(&k).Error; err != nil {
+			return err
+		}
+		return recordEvent(ctx, tx, audit.ActionKeyCreate, k, nil)
+	})
+	if storage.IsUniqueViolation(err) {
+		// 多实例同时启动，已由其他实例写入。
+		return nil
+	}
+	return err
+}
+
+func issue(db *gorm.DB, name string, role Role, scopes string, ttl time.Duration, rotatedFrom *uint) (Issued, error) {
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		expiresAt = &t
+	}
+	for attempt := 1; ; attempt++ {
+		key, err := newKey()
+		if err != nil {
+			return Issued{}, err
+		}
+		k := model.AdminKey{
+			Name:          name,
+			Prefix:        key[:PrefixLen],
+			KeyHash:       hashKey(key),
+			Role:          string(role),
+			Scopes:        scopes,
+			ExpiresAt:     expiresAt,
+			RotatedFromID: rotatedFrom,
+		}
+		err = db.Create(&k).Error
+		if err == nil {
+			return Issued{AdminKey: k, Key: key}, nil
+		}
+		if !storage.IsUniqueViolation(err) || attempt >= issueAttempts {
+			return Issued{}, err
+		}
+	}
+}
+
+// recordEvent 写入以密钥为目标的审计事件，附带名称、前缀、角色与权限。
+func recordEvent(ctx context.Context, tx *gorm.DB, action string, k model.AdminKey, detail map[string]any) error {
+	e := audit.New(ctx, action, audit.TargetAdminKey, strconv.FormatUint(uint64(k.ID), 10))
+	e.Detail = map[string]any{"name": k.Name, "prefix": k.Prefix, "role": k.Role, "scopes": k.Scopes}
+	for name, v := range detail {
+		e.Detail[name] = v
+	}
+	return audit.Record(ctx, tx, e)
+}
+
+func getForUpdate(tx *gorm.DB, id uint) (model.AdminKey, error) {
+	var k model.AdminKey
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&k, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.AdminKey{}, ErrKeyNotFound
+		}
+		return model.AdminKey{}, err
+	}
+	return k, nil
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 36)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return keyMarker + hex.EncodeToString(b[:4]) + "_" + base64.RawURLEncoding.EncodeToString(b[4:]), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
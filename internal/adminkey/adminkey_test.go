@@ -0,0 +1,40 @@
+package adminkey_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flash_sale/internal/adminkey"
+	"flash_sale/internal/config"
+	"flash_sale/internal/storage/storagetest"
+)
+
+func TestEnsureBootstrap(t *testing.T) {
+	ctx := context.Background()
+	db := storagetest.OpenMigrated(t, config.DBDriverSQLite)
+
+	// 未配置初始密钥且库中没有 admin 密钥：拒绝启动，也不登记任何密钥。
+	if err := adminkey.EnsureBootstrap(ctx, db, ""); !errors.Is(err, adminkey.ErrNoAdminKey) {
+		t.Fatalf("EnsureBootstrap(\"\") = %v, want ErrNoAdminKey", err)
+	}
+	if _, err := adminkey.Authenticate(ctx, db, "dev-admin-token"); !errors.Is(err, adminkey.ErrInvalidKey) {
+		t.Fatalf("Authenticate(dev-admin-token) = %v, want ErrInvalidKey", err)
+	}
+	if keys, err := adminkey.List(ctx, db); err != nil || len(keys) != 0 {
+		t.Fatalf("keys = %v, err = %v, want none", keys, err)
+	}
+
+	const key = "bootstrap-0123456789"
+	if err := adminkey.EnsureBootstrap(ctx, db, key); err != nil {
+		t.Fatalf("EnsureBootstrap: %v", err)
+	}
+	k, err := adminkey.Authenticate(ctx, db, key)
+	if err != nil || adminkey.Role(k.Role) != adminkey.RoleAdmin {
+		t.Fatalf("Authenticate = %+v, %v", k, err)
+	}
+	// 已有可用的 admin 密钥后，不配置初始密钥也可启动。
+	if err := adminkey.EnsureBootstrap(ctx, db, ""); err != nil {
+		t.Fatalf("EnsureBootstrap(\"\") with admin key: %v", err)
+	}
+}
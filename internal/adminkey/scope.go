@@ -0,0 +1,70 @@
+package adminkey
+
+import (
+	"slices"
+	"strings"
+)
+
+// Role 为管理密钥的角色，权限逐级包含：viewer ⊂ operator ⊂ admin。
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// Scope 为管理接口的权限点，每个管理路由声明所需的 Scope。
+type Scope string
+
+const (
+	ScopeProductsWrite      Scope = "products:write"
+	ScopeStockPreload       Scope = "stock:preload"
+	ScopeReconcile          Scope = "reconcile:run"
+	ScopeDLQRead            Scope = "dlq:read"
+	ScopeDLQRedrive         Scope = "dlq:redrive"
+	ScopeCampaignsRead      Scope = "campaigns:read"
+	ScopeCampaignsWrite     Scope = "campaigns:write"
+	ScopeRegistrationsRead  Scope = "registrations:read"
+	ScopeRegistrationsWrite Scope = "registrations:write"
+	ScopeLotteriesWrite     Scope = "lotteries:write"
+	ScopeRiskRead           Scope = "risk:read"
+	ScopeRiskWrite          Scope = "risk:write"
+	ScopeKeysManage         Scope = "keys:manage"
+	ScopeAuditRead          Scope = "audit:read"
+)
+
+var (
+	viewerScopes   = []Scope{ScopeDLQRead, ScopeCampaignsRead, ScopeRegistrationsRead, ScopeRiskRead, ScopeAuditRead}
+	operatorScopes = append(slices.Clone(viewerScopes),
+		ScopeProductsWrite, ScopeStockPreload, ScopeReconcile, ScopeDLQRedrive,
+		ScopeCampaignsWrite, ScopeRegistrationsWrite, ScopeLotteriesWrite, ScopeRiskWrite)
+	adminScopes = append(slices.Clone(operatorScopes), ScopeKeysManage)
+
+	roleScopes = map[Role][]Scope{
+		RoleViewer:   viewerScopes,
+		RoleOperator: operatorScopes,
+		RoleAdmin:    adminScopes,
+	}
+)
+
+// Allows 判断角色是否拥有权限。
+func (r Role) Allows(s Scope) bool {
+	return slices.Contains(roleScopes[r], s)
+}
+
+// parseScopes 校验权限列表（去重、保持顺序）并拼为逗号分隔的字符串，要求均为角色拥有的权限。
+func parseScopes(role Role, scopes []string) (string, error) {
+	var out []string
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if s == "" || slices.Contains(out, s) {
+			continue
+		}
+		if !role.Allows(Scope(s)) {
+			return "", ErrInvalidScope
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, ","), nil
+}
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+
+	"gorm.io/gorm"
+)
+
+// 事件的 Action，按“对象.动作”命名。
+const (
+	ActionProductCreate   = "product.create"
+	ActionStockPreload    = "stock.preload"
+	ActionStockCompensate = "stock.compensate"
+	ActionStockCorrect    = "stock.correct"
+	ActionStockClear      = "stock.clear"
+	ActionCampaignCreate  = "campaign.create"
+	ActionCampaignStock   = "campaign.update_stock"
+	ActionRegistrationSet = "registration.set_required"
+	ActionLotteryCreate   = "lottery.create"
+	ActionLotteryDraw     = "lottery.draw"
+	ActionBlacklistAdd    = "blacklist.add"
+	ActionBlacklistRemove = "blacklist.remove"
+	ActionDLQRedrive      = "dlq.redrive"
+	ActionKeyCreate       = "admin_key.create"
+	ActionKeyRotate       = "admin_key.rotate"
+	ActionKeyRevoke       = "admin_key.revoke"
+)
+
+// 事件的 TargetType。库存类事件的目标为库存单元，TargetID 为其 Redis 键。
+const (
+	TargetProduct   = "product"
+	TargetStock     = "stock"
+	TargetCampaign  = "campaign"
+	TargetLottery   = "lottery"
+	TargetBlacklist = "blacklist"
+	TargetDLQ       = "dlq"
+	TargetAdminKey  = "admin_key"
+)
+
+// ActorSystem 为 ctx 中未设置操作者时的默认值。
+const ActorSystem = "system"
+
+type ctxKey int
+
+const (
+	actorKey ctxKey = iota
+	requestIDKey
+)
+
+// WithActor 设置后续事件的操作者，如 admin_key:<前缀>、user:<用户ID>、system:<任务>、cli:<命令>。
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// WithRequestID 设置后续事件关联的 HTTP 请求 ID。
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// Actor 返回 ctx 中的操作者，未设置时为 system。
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return ActorSystem
+}
+
+// RequestID 返回 ctx 中的 HTTP 请求 ID。
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// New 构造事件，操作者与请求 ID 取自 ctx。
+func New(ctx context.Context, action, targetType, targetID string) model.AuditEvent {
+	return model.AuditEvent{
+		Actor:      Actor(ctx),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  RequestID(ctx),
+	}
+}
+
+// NewStock 构造库存类事件，目标为库存单元（skuID=0 为商品级库存）。
+func NewStock(ctx context.Context, action string, productID, skuID uint, before, after *int64) model.AuditEvent {
+	e := New(ctx, action, TargetStock, rediskey.StockKey(productID, skuID))
+	e.ProductID, e.SKUID = productID, skuID
+	e.StockBefore, e.StockAfter = before, after
+	return e
+}
+
+// Record 通过 db（可为事务句柄）追加事件。
+func Record(ctx context.Context, db *gorm.DB, e model.AuditEvent) error {
+	return repository.NewGormStore(db).Audit().Append(ctx, &e)
+}
+
+// Prepare 在一个事务中以 pending 写入 events，用于无法与 DB 同事务的操作（Redis / Broker）：
+// 写入成功后才执行操作，执行后以 Settle 或 Fail 更新结果，不会出现没有审计事件的操作。
+func Prepare(ctx context.Context, store repository.Store, events []model.AuditEvent) error {
+	return store.Transaction(ctx, func(tx repository.Store) error {
+		for i := range events {
+			events[i].Status = model.AuditStatusPending
+			if err := tx.Audit().Append(ctx, &events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Settle 在一个事务中更新 Prepare 写入的 events（调用方已填入执行后得知的 StockBefore、Detail 等），
+// Status 仍为 pending 的标记为 applied。
+func Settle(ctx context.Context, store repository.Store, events []model.AuditEvent) error {
+	return store.Transaction(ctx, func(tx repository.Store) error {
+		for i := range events {
+			if events[i].Status == model.AuditStatusPending {
+				events[i].Status = model.AuditStatusApplied
+			}
+			if err := tx.Audit().Settle(ctx, &events[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Fail 将 Prepare 写入的 events 标记为 failed 并在 Detail 中记下错误；更新失败时事件保持 pending，只记录日志。
+func Fail(ctx context.Context, store repository.Store, events []model.AuditEvent, cause error) {
+	for i := range events {
+		if events[i].Detail == nil {
+			events[i].Detail = map[string]any{}
+		}
+		events[i].Detail["error"] = cause.Error()
+		events[i].Status = model.AuditStatusFailed
+	}
+	if err := Settle(ctx, store, events); err != nil {
+		log.Printf("audit: mark %d event(s) failed: %v", len(events), err)
+	}
+}
+
+// Compensate 幂等回补库存并记录 stock.compensate 事件。
+// 写事件失败时返回错误：调用方重试不会重复加库存，但会补写事件（同一 request_id 只记录一次）。
+func Compensate(ctx context.Context, inventory repository.Inventory, events repository.AuditRepository, requestID string, productID, skuID uint, quantity int64) error {
+	comp, err := inventory.CompensateStock(ctx, requestID, productID, skuID, quantity)
+	if err != nil {
+		return err
+	}
+	return RecordCompensation(ctx, events, requestID, productID, skuID, quantity, comp)
+}
+
+// RecordCompensation 记录回补结果；回补前后库存无法得知（回补标记由旧版本写入）时跳过。
+func RecordCompensation(ctx context.Context, events repository.AuditRepository, requestID string, productID, skuID uint, quantity int64, comp rediskey.Compensation) error {
+	if comp.StockAfter == nil {
+		return nil
+	}
+	before := *comp.StockAfter - quantity
+	e := NewStock(ctx, ActionStockCompensate, productID, skuID, &before, comp.StockAfter)
+	e.RequestID = requestID
+	e.Detail = map[string]any{"quantity": quantity}
+	dedup := fmt.Sprintf("%s:%s", ActionStockCompensate, requestID)
+	e.DedupKey = &dedup
+	return events.Append(ctx, &e)
+}
@@ -0,0 +1,65 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/config"
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	"flash_sale/internal/storage/storagetest"
+)
+
+func TestPrepareSettleFail(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "test")
+	db := storagetest.OpenMigrated(t, config.DBDriverSQLite)
+	store := repository.NewGormStore(db)
+
+	load := func(id uint) model.AuditEvent {
+		t.Helper()
+		var e model.AuditEvent
+		if err := db.First(&e, id).Error; err != nil {
+			t.Fatalf("load %d: %v", id, err)
+		}
+		return e
+	}
+
+	target := int64(10)
+	events := []model.AuditEvent{
+		audit.NewStock(ctx, audit.ActionStockPreload, 1, 0, nil, &target),
+		audit.NewStock(ctx, audit.ActionStockPreload, 1, 2, nil, &target),
+	}
+	if err := audit.Prepare(ctx, store, events); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	// 操作执行前事件已落库，记有目标库存。
+	for _, e := range events {
+		if got := load(e.ID); got.Status != model.AuditStatusPending || got.StockAfter == nil || *got.StockAfter != 10 || got.Actor != "test" {
+			t.Fatalf("prepared = %+v", got)
+		}
+	}
+
+	before := int64(4)
+	events[0].StockBefore = &before
+	events[1].Status = model.AuditStatusSkipped
+	if err := audit.Settle(ctx, store, events); err != nil {
+		t.Fatalf("Settle: %v", err)
+	}
+	if got := load(events[0].ID); got.Status != model.AuditStatusApplied || got.StockBefore == nil || *got.StockBefore != 4 {
+		t.Fatalf("settled = %+v", got)
+	}
+	if got := load(events[1].ID); got.Status != model.AuditStatusSkipped {
+		t.Fatalf("skipped = %+v", got)
+	}
+
+	failed := []model.AuditEvent{audit.New(ctx, audit.ActionBlacklistAdd, audit.TargetBlacklist, "ip")}
+	if err := audit.Prepare(ctx, store, failed); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	audit.Fail(ctx, store, failed, errors.New("redis down"))
+	if got := load(failed[0].ID); got.Status != model.AuditStatusFailed || got.Detail["error"] != "redis down" {
+		t.Fatalf("failed = %+v", got)
+	}
+}
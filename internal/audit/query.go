@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"flash_sale/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// exportBatch 为导出时每批读取的行数。
+const exportBatch = 500
+
+// Filter 为查询条件，零值字段不参与过滤。
+type Filter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	Status     string
+	ProductID  uint
+	// Since / Until 按创建时间过滤，区间为 [Since, Until)。
+	Since time.Time
+	Until time.Time
+}
+
+func (f Filter) apply(db *gorm.DB) *gorm.DB {
+	for _, c := range []struct {
+		cond  string
+		value string
+	}{
+		{"actor = ?", f.Actor},
+		{"action = ?", f.Action},
+		{"target_type = ?", f.TargetType},
+		{"target_id = ?", f.TargetID},
+		{"request_id = ?", f.RequestID},
+		{"status = ?", f.Status},
+	} {
+		if c.value != "" {
+			db = db.Where(c.cond, c.value)
+		}
+	}
+	if f.ProductID != 0 {
+		db = db.Where("product_id = ?", f.ProductID)
+	}
+	if !f.Since.IsZero() {
+		db = db.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		db = db.Where("created_at < ?", f.Until)
+	}
+	return db
+}
+
+// List 按 ID 倒序返回最多 limit 条事件；beforeID 非 0 时只返回 ID 更小的事件（翻页游标）。
+func List(ctx context.Context, db *gorm.DB, f Filter, beforeID uint, limit int) ([]model.AuditEvent, error) {
+	q := f.apply(db.WithContext(ctx))
+	if beforeID != 0 {
+		q = q.Where("id < ?", beforeID)
+	}
+	var list []model.AuditEvent
+	err := q.Order("id DESC").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// Export 按 ID 正序把全部匹配的事件以 JSON Lines 写入 w，分批读取，返回写出的条数。
+func Export(ctx context.Context, db *gorm.DB, f Filter, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	var afterID uint
+	total := 0
+	for {
+		var batch []model.AuditEvent
+		if err := f.apply(db.WithContext(ctx)).
+			Where("id > ?", afterID).
+			Order("id ASC").
+			Limit(exportBatch).
+			Find(&batch).Error; err != nil {
+			return total, err
+		}
+		for i := range batch {
+			if err := enc.Encode(&batch[i]); err != nil {
+				return total, err
+			}
+		}
+		total += len(batch)
+		if len(batch) < exportBatch {
+			return total, nil
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+}
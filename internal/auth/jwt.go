@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken 表示令牌格式、签名或声明不合法。
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired 表示令牌已过期（或尚未生效）。
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// 支持的签名算法。
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+)
+
+// Claims 为校验通过的令牌声明，UserID 取自 sub。
+type Claims struct {
+	UserID    int64
+	Issuer    string
+	ExpiresAt time.Time
+}
+
+// Verifier 校验 Bearer JWT：HS256 按配置的共享密钥（可配置多个以便轮换），
+// RS256 按本地 JWKS 文件中的公钥（按 kid 选择）。必须带 exp，iss / aud 配置后才校验。
+type Verifier struct {
+	hmacKeys [][]byte
+	rsaKeys  map[string]*rsa.PublicKey
+
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+// NewVerifier 创建校验器；jwksFile 为空表示不启用 RS256。至少需要一种密钥。
+func NewVerifier(hs256Secrets []string, jwksFile, issuer, audience string, leeway time.Duration) (*Verifier, error) {
+	v := &Verifier{
+		issuer:   issuer,
+		audience: audience,
+		leeway:   leeway,
+	}
+	for _, s := range hs256Secrets {
+		if s != "" {
+			v.hmacKeys = append(v.hmacKeys, []byte(s))
+		}
+	}
+	if jwksFile != "" {
+		keys, err := LoadJWKS(jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKeys = keys
+	}
+	if len(v.hmacKeys) == 0 && len(v.rsaKeys) == 0 {
+		return nil, errors.New("jwt verifier: no HS256 secret or RS256 key configured")
+	}
+	return v, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+type payload struct {
+	Sub string          `json:"sub"`
+	Iss string          `json:"iss"`
+	Aud json.RawMessage `json:"aud"`
+	Exp *json.Number    `json:"exp"`
+	Nbf *json.Number    `json:"nbf"`
+}
+
+// Verify 校验令牌签名与声明，返回用户身份。
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidToken
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch h.Alg {
+	case AlgHS256:
+		if !v.verifyHS256(signed, sig) {
+			return Claims{}, ErrInvalidToken
+		}
+	case AlgRS256:
+		if !v.verifyRS256(h.Kid, signed, sig) {
+			return Claims{}, ErrInvalidToken
+		}
+	default:
+		// 拒绝 none 及未启用的算法，防止算法混淆。
+		return Claims{}, ErrInvalidToken
+	}
+
+	var p payload
+	if err := decodeSegment(parts[1], &p); err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	return v.checkClaims(p, time.Now())
+}
+
+func (v *Verifier) verifyHS256(signed, sig []byte) bool {
+	for _, key := range v.hmacKeys {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if hmac.Equal(sig, mac.Sum(nil)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Verifier) verifyRS256(kid string, signed, sig []byte) bool {
+	sum := sha256.Sum256(signed)
+	if kid != "" {
+		key, ok := v.rsaKeys[kid]
+		return ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil
+	}
+	// 未带 kid 时依次尝试（JWKS 中通常只有少量密钥）。
+	for _, key := range v.rsaKeys {
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Verifier) checkClaims(p payload, now time.Time) (Claims, error) {
+	if p.Exp == nil {
+		return Claims{}, ErrInvalidToken
+	}
+	exp, err := numericDate(*p.Exp)
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+	if !now.Before(exp.Add(v.leeway)) {
+		return Claims{}, ErrTokenExpired
+	}
+	if p.Nbf != nil {
+		nbf, err := numericDate(*p.Nbf)
+		if err != nil {
+			return Claims{}, ErrInvalidToken
+		}
+		if now.Add(v.leeway).Before(nbf) {
+			return Claims{}, ErrTokenExpired
+		}
+	}
+	if v.issuer != "" && p.Iss != v.issuer {
+		return Claims{}, ErrInvalidToken
+	}
+	if v.audience != "" && !hasAudience(p.Aud, v.audience) {
+		return Claims{}, ErrInvalidToken
+	}
+	userID, err := strconv.ParseInt(p.Sub, 10, 64)
+	if err != nil || userID <= 0 {
+		return Claims{}, ErrInvalidToken
+	}
+	return Claims{UserID: userID, Issuer: p.Iss, ExpiresAt: exp}, nil
+}
+
+// hasAudience 判断 aud（字符串或字符串数组）是否包含 want。
+func hasAudience(raw json.RawMessage, want string) bool {
+	if len(raw) == 0 {
+		return false
+	}
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return one == want
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return false
+	}
+	for _, a := range many {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func numericDate(n json.Number) (time.Time, error) {
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(f), 0), nil
+}
+
+func decodeSegment(seg string, out any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// SignHS256 用共享密钥签发 HS256 令牌，供本地调试与压测使用。
+func SignHS256(secret string, userID int64, issuer, audience string, ttl time.Duration) (string, error) {
+	if secret == "" {
+		return "", errors.New("empty secret")
+	}
+	now := time.Now()
+	claims := map[string]any{
+		"sub": strconv.FormatInt(userID, 10),
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	if issuer != "" {
+		claims["iss"] = issuer
+	}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+	h, err := json.Marshal(header{Alg: AlgHS256, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("marshal claims: %w", err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signToken 按 header 中的 alg 用 key（HS256 为 []byte，RS256 为 *rsa.PrivateKey，none 忽略）签发令牌。
+func signToken(t *testing.T, h header, claims map[string]any, key any) string {
+	t.Helper()
+	hb, err := json.Marshal(h)
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	pb, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(pb)
+
+	var sig []byte
+	switch h.Alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case AlgRS256:
+		sum := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatalf("sign rs256: %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeJWKS 把公钥写入临时 JWKS 文件并返回路径。
+func writeJWKS(t *testing.T, keys map[string]*rsa.PublicKey) string {
+	t.Helper()
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	for kid, pub := range keys {
+		set.Keys = append(set.Keys, jwk{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: AlgRS256,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal jwks: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+	return path
+}
+
+func TestVerifierVerify(t *testing.T) {
+	current, previous, unknown := []byte("current-secret"), []byte("previous-secret"), []byte("other-secret")
+	rsaKey1, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	rsaKey2, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	rsaOther, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	jwksFile := writeJWKS(t, map[string]*rsa.PublicKey{"k1": &rsaKey1.PublicKey, "k2": &rsaKey2.PublicKey})
+
+	v, err := NewVerifier([]string{string(current), string(previous)}, jwksFile, "flash-sale", "buyers", 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	now := time.Now()
+	hs := header{Alg: AlgHS256, Typ: "JWT"}
+	claims := func(mutate func(c map[string]any)) map[string]any {
+		c := map[string]any{
+			"sub": "10001",
+			"iss": "flash-sale",
+			"aud": "buyers",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		if mutate != nil {
+			mutate(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"hs256 current secret", signToken(t, hs, claims(nil), current), nil},
+		{"hs256 rotated secret", signToken(t, hs, claims(nil), previous), nil},
+		{"hs256 unknown secret", signToken(t, hs, claims(nil), unknown), ErrInvalidToken},
+		{"rs256 with kid", signToken(t, header{Alg: AlgRS256, Kid: "k2"}, claims(nil), rsaKey2), nil},
+		{"rs256 without kid", signToken(t, header{Alg: AlgRS256}, claims(nil), rsaKey2), nil},
+		{"rs256 wrong kid", signToken(t, header{Alg: AlgRS256, Kid: "k1"}, claims(nil), rsaKey2), ErrInvalidToken},
+		{"rs256 unknown kid", signToken(t, header{Alg: AlgRS256, Kid: "k9"}, claims(nil), rsaKey1), ErrInvalidToken},
+		{"rs256 unknown key", signToken(t, header{Alg: AlgRS256}, claims(nil), rsaOther), ErrInvalidToken},
+		{"alg none", signToken(t, header{Alg: "none"}, claims(nil), nil), ErrInvalidToken},
+		{"alg unknown", signToken(t, header{Alg: "HS512"}, claims(nil), current), ErrInvalidToken},
+		{"malformed", "not-a-jwt", ErrInvalidToken},
+		{"missing exp", signToken(t, hs, claims(func(c map[string]any) { delete(c, "exp") }), current), ErrInvalidToken},
+		{"expired", signToken(t, hs, claims(func(c map[string]any) { c["exp"] = now.Add(-time.Minute).Unix() }), current), ErrTokenExpired},
+		{"expired within leeway", signToken(t, hs, claims(func(c map[string]any) { c["exp"] = now.Add(-10 * time.Second).Unix() }), current), nil},
+		{"not yet valid", signToken(t, hs, claims(func(c map[string]any) { c["nbf"] = now.Add(time.Minute).Unix() }), current), ErrTokenExpired},
+		{"nbf within leeway", signToken(t, hs, claims(func(c map[string]any) { c["nbf"] = now.Add(10 * time.Second).Unix() }), current), nil},
+		{"issuer mismatch", signToken(t, hs, claims(func(c map[string]any) { c["iss"] = "other" }), current), ErrInvalidToken},
+		{"audience mismatch", signToken(t, hs, claims(func(c map[string]any) { c["aud"] = "admins" }), current), ErrInvalidToken},
+		{"audience list", signToken(t, hs, claims(func(c map[string]any) { c["aud"] = []string{"admins", "buyers"} }), current), nil},
+		{"audience missing", signToken(t, hs, claims(func(c map[string]any) { delete(c, "aud") }), current), ErrInvalidToken},
+		{"sub not numeric", signToken(t, hs, claims(func(c map[string]any) { c["sub"] = "alice" }), current), ErrInvalidToken},
+		{"sub not positive", signToken(t, hs, claims(func(c map[string]any) { c["sub"] = "0" }), current), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify(): %v", err)
+			}
+			if got.UserID != 10001 || got.Issuer != "flash-sale" {
+				t.Fatalf("claims = %+v", got)
+			}
+		})
+	}
+}
+
+func TestVerifierWithoutIssuerAudience(t *testing.T) {
+	v, err := NewVerifier([]string{"secret"}, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	token, err := SignHS256("secret", 42, "", "", time.Minute)
+	if err != nil {
+		t.Fatalf("SignHS256: %v", err)
+	}
+	claims, err := v.Verify(token)
+	if err != nil || claims.UserID != 42 {
+		t.Fatalf("Verify() = %+v, %v", claims, err)
+	}
+
+	// 未配置 JWKS 时拒绝 RS256。
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	rs := signToken(t, header{Alg: AlgRS256}, map[string]any{"sub": "42", "exp": time.Now().Add(time.Minute).Unix()}, key)
+	if _, err := v.Verify(rs); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("rs256 without jwks: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestNewVerifierRequiresKey(t *testing.T) {
+	if _, err := NewVerifier([]string{""}, "", "", "", 0); err == nil {
+		t.Fatalf("NewVerifier without keys succeeded")
+	}
+	if _, err := NewVerifier(nil, filepath.Join(t.TempDir(), "missing.json"), "", "", 0); err == nil {
+		t.Fatalf("NewVerifier with missing jwks succeeded")
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// 签名请求使用的请求头。
+const (
+	HeaderClientID  = "X-Client-Id"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// StringToSign 返回请求签名的原文：
+// METHOD \n PATH \n TIMESTAMP \n NONCE \n hex(sha256(body))
+// 其中 TIMESTAMP 为 Unix 秒，PATH 不含查询串。
+func StringToSign(method, path, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{strings.ToUpper(method), path, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// SignRequest 计算请求签名 hex(HMAC-SHA256(secret, StringToSign(...)))。
+func SignRequest(secret, method, path, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(StringToSign(method, path, timestamp, nonce, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequestSignature 以常量时间比较请求签名。
+func VerifyRequestSignature(secret, signature, method, path, timestamp, nonce string, body []byte) bool {
+	want := SignRequest(secret, method, path, timestamp, nonce, body)
+	return hmac.Equal([]byte(strings.ToLower(signature)), []byte(want))
+}
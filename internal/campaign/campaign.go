@@ -0,0 +1,206 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCampaignNotFound 表示活动不存在。
+	ErrCampaignNotFound = errors.New("campaign not found")
+	// ErrInvalidSchedule 表示活动时间窗不合法（结束早于开始或已过期）。
+	ErrInvalidSchedule = errors.New("invalid campaign schedule")
+	// ErrProductUnavailable 表示商品不存在或已归属其他活动。
+	ErrProductUnavailable = errors.New("product not found or already in a campaign")
+	// ErrStockFrozen 表示活动已开始（或已结束），库存不允许再修改。
+	ErrStockFrozen = errors.New("campaign stock is frozen")
+	// ErrStockTargetNotFound 表示要修改库存的商品/SKU 不属于该活动。
+	ErrStockTargetNotFound = errors.New("product or sku not in campaign")
+)
+
+// Create 创建活动并将商品纳入其中：商品时间窗统一改为活动时间窗，secKill 的时间校验因此与活动一致。
+// 同一事务内写入 campaign.create 审计事件。
+func Create(ctx context.Context, db *gorm.DB, name string, start, end time.Time, productIDs []uint) (model.Campaign, error) {
+	if !end.After(start) || !end.After(time.Now()) {
+		return model.Campaign{}, ErrInvalidSchedule
+	}
+	ids := make([]uint, 0, len(productIDs))
+	seen := make(map[uint]bool, len(productIDs))
+	for _, id := range productIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	c := model.Campaign{
+		Name:      name,
+		StartTime: start,
+		EndTime:   end,
+		Status:    model.CampaignScheduled,
+	}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&c).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&model.Product{}).
+			Where("id IN ? AND campaign_id IS NULL", ids).
+			Updates(map[string]any{
+				"campaign_id": c.ID,
+				"start_time":  start,
+				"end_time":    end,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != int64(len(ids)) {
+			return ErrProductUnavailable
+		}
+		e := audit.New(ctx, audit.ActionCampaignCreate, audit.TargetCampaign, strconv.FormatUint(uint64(c.ID), 10))
+		e.Detail = map[string]any{"name": name, "start_time": start, "end_time": end, "product_ids": ids}
+		return audit.Record(ctx, tx, e)
+	})
+	if err != nil {
+		return model.Campaign{}, err
+	}
+	return Get(db, c.ID)
+}
+
+// Get 查询活动详情（含商品与 SKU）。
+func Get(db *gorm.DB, id uint) (model.Campaign, error) {
+	var c model.Campaign
+	if err := db.Preload("Products.SKUs").First(&c, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Campaign{}, ErrCampaignNotFound
+		}
+		return model.Campaign{}, err
+	}
+	return c, nil
+}
+
+// List 按开始时间倒序查询活动列表（不含商品明细）。
+func List(db *gorm.DB) ([]model.Campaign, error) {
+	var list []model.Campaign
+	if err := db.Order("start_time DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateStock 修改活动内商品（skuID=0）或 SKU 的库存。
+// 仅待预热/已预热且未到开始时间时允许：已预热时同步覆盖 Redis 库存（尚未开卖，覆盖安全）；
+// 到开始时间后即冻结，不等调度器切换为进行中（secKill 到点即可下单，覆盖会抹掉已扣减的库存）。
+// 同一事务内写入 campaign.update_stock 审计事件（前后库存为 DB 库存）。
+func UpdateStock(ctx context.Context, db *gorm.DB, rdb *rd.Client, campaignID, productID, skuID uint, stock int64, ttl time.Duration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var c model.Campaign
+		if err := tx.First(&c, campaignID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCampaignNotFound
+			}
+			return err
+		}
+		if (c.Status != model.CampaignScheduled && c.Status != model.CampaignWarmed) || !time.Now().Before(c.StartTime) {
+			return ErrStockFrozen
+		}
+
+		var p model.Product
+		if err := tx.Preload("SKUs").Where("id = ? AND campaign_id = ?", productID, campaignID).First(&p).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrStockTargetNotFound
+			}
+			return err
+		}
+
+		var before int64
+		if skuID == 0 {
+			if len(p.SKUs) > 0 {
+				return ErrStockTargetNotFound
+			}
+			before = p.Stock
+			if err := tx.Model(&model.Product{}).Where("id = ?", p.ID).Update("stock", stock).Error; err != nil {
+				return err
+			}
+		} else {
+			var total int64
+			found := false
+			for _, sku := range p.SKUs {
+				if sku.ID == skuID {
+					found = true
+					before = sku.Stock
+					total += stock
+				} else {
+					total += sku.Stock
+				}
+			}
+			if !found {
+				return ErrStockTargetNotFound
+			}
+			if err := tx.Model(&model.SKU{}).Where("id = ?", skuID).Update("stock", stock).Error; err != nil {
+				return err
+			}
+			// 商品 stock 为 SKU 汇总值，保持一致。
+			if err := tx.Model(&model.Product{}).Where("id = ?", p.ID).Update("stock", total).Error; err != nil {
+				return err
+			}
+		}
+
+		// 条件更新确认活动仍未开始，避免与调度器的 warmed -> live 流转竞争。
+		res := tx.Model(&model.Campaign{}).
+			Where("id = ? AND status = ?", c.ID, c.Status).
+			Update("updated_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrStockFrozen
+		}
+
+		e := audit.NewStock(ctx, audit.ActionCampaignStock, p.ID, skuID, &before, &stock)
+		e.Detail = map[string]any{"campaign_id": c.ID, "redis_synced": c.Status == model.CampaignWarmed}
+		if err := audit.Record(ctx, tx, e); err != nil {
+			return err
+		}
+
+		if c.Status == model.CampaignWarmed {
+			// 事务期间可能已到开始时间，覆盖前再确认一次。
+			if !time.Now().Before(c.StartTime) {
+				return ErrStockFrozen
+			}
+			return rdb.Set(ctx, rediskey.StockKey(p.ID, skuID), stock, stockKeyTTL(c, ttl)).Err()
+		}
+		return nil
+	})
+}
+
+// stockEntries 返回商品的全部库存单元及 DB 初始库存：有 SKU 按 SKU，否则按商品。
+func stockEntries(products []model.Product) []rediskey.StockUnit {
+	out := make([]rediskey.StockUnit, 0, len(products))
+	for _, p := range products {
+		if len(p.SKUs) == 0 {
+			out = append(out, rediskey.StockUnit{ProductID: p.ID, Stock: p.Stock})
+			continue
+		}
+		for _, sku := range p.SKUs {
+			out = append(out, rediskey.StockUnit{ProductID: p.ID, SKUID: sku.ID, Stock: sku.Stock})
+		}
+	}
+	return out
+}
+
+// stockKeyTTL 保证库存键至少存活到活动结束后一小时，之后由调度器主动清理。
+func stockKeyTTL(c model.Campaign, ttl time.Duration) time.Duration {
+	if floor := time.Until(c.EndTime) + time.Hour; ttl < floor {
+		return floor
+	}
+	return ttl
+}
@@ -0,0 +1,62 @@
+package campaign_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"flash_sale/internal/campaign"
+	"flash_sale/internal/config"
+	"flash_sale/internal/model"
+	"flash_sale/internal/storage/storagetest"
+)
+
+func TestUpdateStockFreeze(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  model.CampaignStatus
+		startIn time.Duration
+		wantErr error
+		wantDB  int64
+	}{
+		{"scheduled before start", model.CampaignScheduled, time.Hour, nil, 50},
+		// 调度器尚未切换为进行中，但已到开始时间：secKill 已可下单，库存必须冻结。
+		{"warmed after start", model.CampaignWarmed, -time.Second, campaign.ErrStockFrozen, 10},
+		{"scheduled after start", model.CampaignScheduled, -time.Second, campaign.ErrStockFrozen, 10},
+		{"live", model.CampaignLive, -time.Minute, campaign.ErrStockFrozen, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := storagetest.OpenMigrated(t, config.DBDriverSQLite)
+
+			now := time.Now()
+			p := model.Product{Name: "test", Stock: 10, SalePrice: 100, StartTime: now, EndTime: now.Add(2 * time.Hour)}
+			if err := db.Create(&p).Error; err != nil {
+				t.Fatalf("create product: %v", err)
+			}
+			c, err := campaign.Create(ctx, db, "c", now.Add(time.Hour), now.Add(2*time.Hour), []uint{p.ID})
+			if err != nil {
+				t.Fatalf("create campaign: %v", err)
+			}
+			if err := db.Model(&model.Campaign{}).Where("id = ?", c.ID).
+				Updates(map[string]any{"status": tt.status, "start_time": now.Add(tt.startIn)}).Error; err != nil {
+				t.Fatalf("update campaign: %v", err)
+			}
+
+			// 未预热或被冻结时不会访问 Redis。
+			err = campaign.UpdateStock(ctx, db, nil, c.ID, p.ID, 0, 50, time.Hour)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateStock() = %v, want %v", err, tt.wantErr)
+			}
+			var got model.Product
+			if err := db.First(&got, p.ID).Error; err != nil {
+				t.Fatalf("load product: %v", err)
+			}
+			if got.Stock != tt.wantDB {
+				t.Fatalf("stock = %d, want %d", got.Stock, tt.wantDB)
+			}
+		})
+	}
+}
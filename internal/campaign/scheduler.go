@@ -0,0 +1,240 @@
+package campaign
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/registration"
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Scheduler 周期性推进活动生命周期：
+// - 开始前 warmupLead 预热 Redis 库存与预约集合（条件更新抢占，多实例下只预热一次）
+// - 到点切换为进行中，此后库存冻结
+// - 结束后清理 Redis 库存键
+type Scheduler struct {
+	db    *gorm.DB
+	rdb   *rd.Client
+	store repository.Store
+
+	warmupLead time.Duration
+	interval   time.Duration
+	stockTTL   time.Duration
+}
+
+func NewScheduler(db *gorm.DB, rdb *rd.Client, warmupLead, interval, stockTTL time.Duration) *Scheduler {
+	return &Scheduler{
+		db:         db,
+		rdb:        rdb,
+		store:      repository.NewGormStore(db),
+		warmupLead: warmupLead,
+		interval:   interval,
+		stockTTL:   stockTTL,
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ctx = audit.WithActor(ctx, "system:campaign")
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context) {
+	if err := s.warmDue(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("campaign warm: %v", err)
+	}
+	if err := s.activateDue(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("campaign activate: %v", err)
+	}
+	if err := s.endDue(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("campaign end: %v", err)
+	}
+}
+
+// warmDue 预热即将开始（或已开始但尚未预热）的活动。
+func (s *Scheduler) warmDue(ctx context.Context) error {
+	now := time.Now()
+	var list []model.Campaign
+	if err := s.db.WithContext(ctx).
+		Where("status = ? AND start_time <= ? AND end_time > ?", model.CampaignScheduled, now.Add(s.warmupLead), now).
+		Order("start_time ASC").
+		Find(&list).Error; err != nil {
+		return err
+	}
+
+	for _, c := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.warm(ctx, c); err != nil {
+			log.Printf("campaign warm id=%d: %v", c.ID, err)
+		}
+	}
+	return nil
+}
+
+// warm 先以 scheduled -> warmed 条件更新抢占，成功者才写 Redis，避免重复预热覆盖已扣减的库存。
+// 写 Redis 失败则回退为 scheduled，下一轮重试；重试时已到开始时间则只补写缺失的库存键（见 writeStock）。
+func (s *Scheduler) warm(ctx context.Context, c model.Campaign) error {
+	now := time.Now()
+	res := s.db.WithContext(ctx).Model(&model.Campaign{}).
+		Where("id = ? AND status = ?", c.ID, model.CampaignScheduled).
+		Updates(map[string]any{"status": model.CampaignWarmed, "warmed_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+
+	err := s.writeStock(ctx, c)
+	if err != nil {
+		if e := s.db.WithContext(ctx).Model(&model.Campaign{}).
+			Where("id = ? AND status = ?", c.ID, model.CampaignWarmed).
+			Updates(map[string]any{"status": model.CampaignScheduled, "warmed_at": nil}).Error; e != nil {
+			log.Printf("campaign warm rollback id=%d: %v", c.ID, e)
+		}
+		return err
+	}
+	log.Printf("campaign warmed id=%d start=%s", c.ID, c.StartTime.Format(time.RFC3339))
+	return nil
+}
+
+func (s *Scheduler) writeStock(ctx context.Context, c model.Campaign) error {
+	var products []model.Product
+	if err := s.db.WithContext(ctx).Preload("SKUs").Where("campaign_id = ?", c.ID).Find(&products).Error; err != nil {
+		return err
+	}
+	// 先按 DB 回填要求预约商品的预约集合：失败时尚未写库存，回退重试不涉及库存。
+	for _, p := range products {
+		if err := registration.Sync(ctx, s.db, s.rdb, p); err != nil {
+			return err
+		}
+	}
+	units := stockEntries(products)
+	if len(units) == 0 {
+		return nil
+	}
+	// 先以 pending 记下目标库存再写 Redis；审计写入或状态更新失败都返回错误，由下一轮重试。
+	events := stockEvents(ctx, audit.ActionStockPreload, c, units, false)
+	if err := audit.Prepare(ctx, s.store, events); err != nil {
+		return err
+	}
+	ttl := stockKeyTTL(c, s.stockTTL)
+	initOnly := !time.Now().Before(c.StartTime)
+	var before []*int64
+	var err error
+	if initOnly {
+		// 已到开始时间（预热延误或失败后重试）：secKill 可能已在扣减，已存在的库存键不再覆盖，只补写缺失的键。
+		before, err = rediskey.InitStock(ctx, s.rdb, units, ttl)
+	} else {
+		before, err = rediskey.OverwriteStock(ctx, s.rdb, units, ttl)
+	}
+	if err != nil {
+		audit.Fail(ctx, s.store, events, err)
+		return err
+	}
+	for i := range events {
+		events[i].StockBefore = before[i]
+		if initOnly && before[i] != nil {
+			events[i].Status = model.AuditStatusSkipped
+		}
+	}
+	return audit.Settle(ctx, s.store, events)
+}
+
+// activateDue 将已到开始时间的已预热活动切换为进行中（库存冻结）。
+func (s *Scheduler) activateDue(ctx context.Context) error {
+	return s.db.WithContext(ctx).Model(&model.Campaign{}).
+		Where("status = ? AND start_time <= ?", model.CampaignWarmed, time.Now()).
+		Update("status", model.CampaignLive).Error
+}
+
+// endDue 清理已结束活动的 Redis 库存键，然后标记为已结束。
+// DEL 本身幂等：标记失败时下一轮会重新清理。
+func (s *Scheduler) endDue(ctx context.Context) error {
+	var list []model.Campaign
+	if err := s.db.WithContext(ctx).
+		Where("status <> ? AND end_time <= ?", model.CampaignEnded, time.Now()).
+		Find(&list).Error; err != nil {
+		return err
+	}
+
+	for _, c := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.teardown(ctx, c); err != nil {
+			log.Printf("campaign teardown id=%d: %v", c.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) teardown(ctx context.Context, c model.Campaign) error {
+	var products []model.Product
+	if err := s.db.WithContext(ctx).Preload("SKUs").Where("campaign_id = ?", c.ID).Find(&products).Error; err != nil {
+		return err
+	}
+	units := stockEntries(products)
+	if len(units) > 0 {
+		// 同预热：先以 pending 记下清理，失败返回错误，活动保持未结束，由下一轮重试。
+		events := stockEvents(ctx, audit.ActionStockClear, c, units, true)
+		if err := audit.Prepare(ctx, s.store, events); err != nil {
+			return err
+		}
+		before, err := rediskey.ClearStock(ctx, s.rdb, units)
+		if err != nil {
+			audit.Fail(ctx, s.store, events, err)
+			return err
+		}
+		for i := range events {
+			events[i].StockBefore = before[i]
+			if before[i] == nil {
+				events[i].Status = model.AuditStatusSkipped
+			}
+		}
+		if err := audit.Settle(ctx, s.store, events); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(&model.Campaign{}).
+		Where("id = ? AND status = ?", c.ID, c.Status).
+		Updates(map[string]any{"status": model.CampaignEnded, "ended_at": now}).Error; err != nil {
+		return err
+	}
+	log.Printf("campaign ended id=%d keys=%d", c.ID, len(units))
+	return nil
+}
+
+// stockEvents 构造预热（cleared=false，记目标库存）或清理的库存审计事件，改动前库存在执行后填入。
+func stockEvents(ctx context.Context, action string, c model.Campaign, units []rediskey.StockUnit, cleared bool) []model.AuditEvent {
+	events := make([]model.AuditEvent, len(units))
+	for i := range units {
+		var after *int64
+		if !cleared {
+			after = &units[i].Stock
+		}
+		events[i] = audit.NewStock(ctx, action, units[i].ProductID, units[i].SKUID, nil, after)
+		events[i].Detail = map[string]any{"campaign_id": c.ID}
+	}
+	return events
+}
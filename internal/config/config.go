@@ -8,52 +8,215 @@ import (
 	"time"
 )
 
+// 消息中间件实现（BROKER）。
+const (
+	BrokerKafka  = "kafka"
+	BrokerMemory = "memory" // 进程内实现，仅用于本地开发与 CI
+)
+
+// 下单链路模式（PIPELINE_MODE）。
+const (
+	PipelineRelay  = "relay"  // Stream outbox -> Relay -> Broker -> Consumer
+	PipelineStream = "stream" // Consumer 直接消费 Stream outbox，无需 Broker
+)
+
+// 数据库驱动（DB_DRIVER）。
+const (
+	DBDriverSQLite   = "sqlite"
+	DBDriverPostgres = "postgres"
+	DBDriverMySQL    = "mysql"
+)
+
+// 事务隔离级别（DB_ISOLATION_LEVEL），为空时沿用数据库默认值。
+const (
+	IsolationReadCommitted  = "read_committed"
+	IsolationRepeatableRead = "repeatable_read"
+	IsolationSerializable   = "serializable"
+)
+
 // AppConfig 聚合运行时配置，尽量通过环境变量注入，避免硬编码。
 type AppConfig struct {
 	HTTPAddr string
-	DBPath   string
+
+	// DBDriver 选择存储后端：sqlite / postgres / mysql。
+	// DBDSN 为连接串；sqlite 下未设置 DB_DSN 时取 DB_PATH。
+	DBDriver string
+	DBDSN    string
+	// DBIsolation 为连接级默认事务隔离级别，仅对 postgres / mysql 生效。
+	DBIsolation string
+	// DBAutoMigrate 为 true 时服务启动自动执行未应用的迁移（持锁，多实例只执行一次）；
+	// 为 false 时仅校验 schema 已是最新，迁移由 cmd/migrate 单独执行。
+	DBAutoMigrate bool
 
 	RedisAddr string
 	RedisDB   int
 
+	// PipelineMode 选择下单链路：relay（经 Broker）/ stream（仅 Redis + DB）。
+	PipelineMode string
+	// StreamConsumerGroup 为 stream 模式下 Consumer 直接读取 outbox 的消费者组。
+	StreamConsumerGroup string
+
+	// Broker 选择消息中间件实现：kafka / memory。
+	// 下列 Topic、消费者组、死信配置对两种实现都生效（memory 下仅作为进程内 topic 名）。
+	Broker string
+
 	// Kafka 集群地址（逗号分隔）、Topic、消费者组
 	KafkaBrokers []string
 	KafkaTopic   string
 	KafkaGroupID string
+	// 消费端死信 topic 与单条消息最大处理次数
+	KafkaDLQTopic    string
+	KafkaMaxAttempts int
 
 	// Redis Stream outbox（API 原子入流，Relay 异步转 Kafka）
 	OrderEventStream   string
 	OrderEventGroup    string
 	OrderEventConsumer string
+	// 僵尸 pending 接管：最小空闲时长、扫描间隔、单条消息最大接管次数
+	OrderEventClaimMinIdle  time.Duration
+	OrderEventClaimInterval time.Duration
+	OrderEventMaxClaims     int
+	// stream 模式下 Consumer 单条消息最大处理次数（暂时性错误不计入），超过转入 <stream>:dlq；Relay 发布失败不计次数
+	OrderEventMaxAttempts int
 
 	// 购买接口限流与库存缓存策略
 	BuyRateLimit  int
 	BuyRateWindow time.Duration
 	StockCacheTTL time.Duration
 
-	// 预热接口的简单管理员令牌（demo 级别保护）
-	PreloadAdminToken string
+	// 管理接口的初始 API 密钥：启动时登记为 admin 角色，用于签发正式密钥；为空表示不登记。
+	// 正式密钥存于 DB（只存摘要），由 /api/admin/keys 或 cmd/adminkey 管理。
+	AdminBootstrapKey string
+
+	// 订单支付时限与超时取消任务（扫描间隔、单批数量）
+	OrderPayTimeout     time.Duration
+	OrderExpiryInterval time.Duration
+	OrderExpiryBatch    int
+
+	// 滞留 pending 请求清扫：判定阈值、扫描间隔、单批数量
+	PendingSweepThreshold time.Duration
+	PendingSweepInterval  time.Duration
+	PendingSweepBatch     int
+
+	// 结果推送（SSE / WebSocket）：单个连接最长保持时间、心跳与兜底回查间隔
+	ResultStreamTimeout   time.Duration
+	ResultStreamHeartbeat time.Duration
+	// 结果长轮询：wait 参数的上限
+	ResultWaitMax time.Duration
+
+	// 活动调度：开始前多久预热 Redis 库存、调度扫描间隔
+	CampaignWarmupLead       time.Duration
+	CampaignScheduleInterval time.Duration
+
+	// 抽签开奖 / 投递扫描间隔
+	LotteryScheduleInterval time.Duration
+
+	// 等待室：开启后下单必须携带准入凭证；每个商品每秒放行人数、放行间隔、凭证签名密钥与有效期
+	WaitingRoomEnabled       bool
+	WaitingRoomAdmitRate     int
+	WaitingRoomAdmitInterval time.Duration
+	WaitingRoomSecret        string
+	WaitingRoomTokenTTL      time.Duration
+
+	// JWT 鉴权：默认开启，用户身份取自令牌（请求中的 user_id 可省略，不一致拒绝）；
+	// 关闭后身份取自请求中的 user_id，仅用于本地调试与压测。
+	// HS256 共享密钥可配置多个（逗号分隔，便于轮换）；RS256 公钥来自本地 JWKS 文件；iss / aud 配置后才校验。
+	JWTEnabled      bool
+	JWTHS256Secrets []string
+	JWTJWKSFile     string
+	JWTIssuer       string
+	JWTAudience     string
+	// JWTLeeway 为 exp / nbf 校验允许的时钟偏差
+	JWTLeeway time.Duration
+
+	// 下单请求签名：开启后 /buy 必须携带 HMAC 签名、时间戳与 nonce。
+	// SigningKeys 为 client_id -> 密钥；SignatureMaxSkew 为可接受的时间戳偏差（nonce 保留两倍时长）。
+	SignedRequestsEnabled bool
+	SigningKeys           map[string]string
+	SignatureMaxSkew      time.Duration
+
+	// 工作量证明：开启后下单必须携带已解的挑战。难度（前导零位数）在 [PowMinDifficulty, PowMaxDifficulty] 内，
+	// 入口 QPS 超过 PowBaseQPS 后每翻一倍加 1 位；挑战签名密钥与有效期。
+	PowEnabled       bool
+	PowSecret        string
+	PowMinDifficulty int
+	PowMaxDifficulty int
+	PowBaseQPS       int
+	PowChallengeTTL  time.Duration
+
+	// 风控评估：RiskEvaluatorURL 为外部风控服务地址（为空表示只用黑名单）；评估超时后放行。
+	// 评估结论为 challenge 时复用工作量证明挑战，因此配置后即使未开启 POW_ENABLED 也会提供挑战接口。
+	RiskEvaluatorURL     string
+	RiskEvaluatorTimeout time.Duration
 }
 
 // Load 读取并校验配置，缺失时使用默认值。
 func Load() (AppConfig, error) {
 	cfg := AppConfig{
-		HTTPAddr:           getEnv("HTTP_ADDR", ":8080"),
-		DBPath:             getEnv("DB_PATH", "flash_sale.db"),
-		RedisAddr:          getEnv("REDIS_ADDR", "localhost:6379"),
-		RedisDB:            0,
-		KafkaBrokers:       splitCSV(getEnv("KAFKA_BROKERS", "localhost:9092")),
-		KafkaTopic:         getEnv("KAFKA_TOPIC", "flash-sale-orders"),
-		KafkaGroupID:       getEnv("KAFKA_GROUP_ID", "flash-sale-order-consumer"),
-		OrderEventStream:   getEnv("ORDER_EVENT_STREAM", "flash_sale:order_events"),
-		OrderEventGroup:    getEnv("ORDER_EVENT_GROUP", "flash-sale-relay-group"),
-		OrderEventConsumer: getEnv("ORDER_EVENT_CONSUMER", "flash-sale-relay-1"),
-		BuyRateLimit:       1000,
-		BuyRateWindow:      time.Second,
-		StockCacheTTL:      24 * time.Hour,
-		PreloadAdminToken:  getEnv("PRELOAD_ADMIN_TOKEN", "dev-admin-token"),
+		HTTPAddr:                 getEnv("HTTP_ADDR", ":8080"),
+		DBDriver:                 strings.ToLower(getEnv("DB_DRIVER", DBDriverSQLite)),
+		DBDSN:                    getEnv("DB_DSN", ""),
+		DBIsolation:              strings.ToLower(getEnv("DB_ISOLATION_LEVEL", "")),
+		DBAutoMigrate:            true,
+		RedisAddr:                getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisDB:                  0,
+		PipelineMode:             strings.ToLower(getEnv("PIPELINE_MODE", PipelineRelay)),
+		StreamConsumerGroup:      getEnv("STREAM_CONSUMER_GROUP", "flash-sale-order-stream-consumer"),
+		Broker:                   strings.ToLower(getEnv("BROKER", BrokerKafka)),
+		KafkaBrokers:             splitCSV(getEnv("KAFKA_BROKERS", "localhost:9092")),
+		KafkaTopic:               getEnv("KAFKA_TOPIC", "flash-sale-orders"),
+		KafkaGroupID:             getEnv("KAFKA_GROUP_ID", "flash-sale-order-consumer"),
+		KafkaDLQTopic:            getEnv("KAFKA_DLQ_TOPIC", "flash-sale-orders-dlq"),
+		KafkaMaxAttempts:         5,
+		OrderEventStream:         getEnv("ORDER_EVENT_STREAM", "flash_sale:order_events"),
+		OrderEventGroup:          getEnv("ORDER_EVENT_GROUP", "flash-sale-relay-group"),
+		OrderEventConsumer:       getEnv("ORDER_EVENT_CONSUMER", "flash-sale-relay-1"),
+		OrderEventClaimMinIdle:   30 * time.Second,
+		OrderEventClaimInterval:  5 * time.Second,
+		OrderEventMaxClaims:      5,
+		OrderEventMaxAttempts:    20,
+		BuyRateLimit:             1000,
+		BuyRateWindow:            time.Second,
+		StockCacheTTL:            24 * time.Hour,
+		AdminBootstrapKey:        getEnv("ADMIN_BOOTSTRAP_KEY", ""),
+		OrderPayTimeout:          15 * time.Minute,
+		OrderExpiryInterval:      10 * time.Second,
+		OrderExpiryBatch:         100,
+		PendingSweepThreshold:    5 * time.Minute,
+		PendingSweepInterval:     30 * time.Second,
+		PendingSweepBatch:        100,
+		ResultStreamTimeout:      30 * time.Second,
+		ResultStreamHeartbeat:    5 * time.Second,
+		ResultWaitMax:            30 * time.Second,
+		CampaignWarmupLead:       5 * time.Minute,
+		CampaignScheduleInterval: 5 * time.Second,
+		LotteryScheduleInterval:  5 * time.Second,
+		WaitingRoomAdmitRate:     200,
+		WaitingRoomAdmitInterval: time.Second,
+		WaitingRoomSecret:        getEnv("WAITING_ROOM_SECRET", ""),
+		WaitingRoomTokenTTL:      2 * time.Minute,
+		JWTEnabled:               true,
+		JWTHS256Secrets:          splitCSV(getEnv("JWT_HS256_SECRETS", "")),
+		JWTJWKSFile:              getEnv("JWT_JWKS_FILE", ""),
+		JWTIssuer:                getEnv("JWT_ISSUER", ""),
+		JWTAudience:              getEnv("JWT_AUDIENCE", ""),
+		JWTLeeway:                30 * time.Second,
+		SignatureMaxSkew:         time.Minute,
+		PowSecret:                getEnv("POW_SECRET", ""),
+		PowMinDifficulty:         16,
+		PowMaxDifficulty:         24,
+		PowBaseQPS:               500,
+		PowChallengeTTL:          2 * time.Minute,
+		RiskEvaluatorURL:         getEnv("RISK_EVALUATOR_URL", ""),
+		RiskEvaluatorTimeout:     200 * time.Millisecond,
 	}
 
+	autoMigrate, err := getEnvBool("DB_AUTO_MIGRATE", cfg.DBAutoMigrate)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid DB_AUTO_MIGRATE: %w", err)
+	}
+	cfg.DBAutoMigrate = autoMigrate
+
 	redisDB, err := getEnvInt("REDIS_DB", cfg.RedisDB)
 	if err != nil {
 		return AppConfig{}, fmt.Errorf("invalid REDIS_DB: %w", err)
@@ -87,8 +250,338 @@ func Load() (AppConfig, error) {
 	}
 	cfg.StockCacheTTL = time.Duration(stockTTLHour) * time.Hour
 
-	if len(cfg.KafkaBrokers) == 0 {
-		return AppConfig{}, fmt.Errorf("KAFKA_BROKERS must not be empty")
+	claimMinIdleSec, err := getEnvInt("ORDER_EVENT_CLAIM_MIN_IDLE_SEC", int(cfg.OrderEventClaimMinIdle.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid ORDER_EVENT_CLAIM_MIN_IDLE_SEC: %w", err)
+	}
+	if claimMinIdleSec <= 0 {
+		return AppConfig{}, fmt.Errorf("ORDER_EVENT_CLAIM_MIN_IDLE_SEC must be > 0")
+	}
+	cfg.OrderEventClaimMinIdle = time.Duration(claimMinIdleSec) * time.Second
+
+	claimIntervalSec, err := getEnvInt("ORDER_EVENT_CLAIM_INTERVAL_SEC", int(cfg.OrderEventClaimInterval.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid ORDER_EVENT_CLAIM_INTERVAL_SEC: %w", err)
+	}
+	if claimIntervalSec <= 0 {
+		return AppConfig{}, fmt.Errorf("ORDER_EVENT_CLAIM_INTERVAL_SEC must be > 0")
+	}
+	cfg.OrderEventClaimInterval = time.Duration(claimIntervalSec) * time.Second
+
+	maxClaims, err := getEnvInt("ORDER_EVENT_MAX_CLAIMS", cfg.OrderEventMaxClaims)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid ORDER_EVENT_MAX_CLAIMS: %w", err)
+	}
+	if maxClaims <= 0 {
+		return AppConfig{}, fmt.Errorf("ORDER_EVENT_MAX_CLAIMS must be > 0")
+	}
+	cfg.OrderEventMaxClaims = maxClaims
+
+	maxAttempts, err := getEnvInt("ORDER_EVENT_MAX_ATTEMPTS", cfg.OrderEventMaxAttempts)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid ORDER_EVENT_MAX_ATTEMPTS: %w", err)
+	}
+	if maxAttempts <= 0 {
+		return AppConfig{}, fmt.Errorf("ORDER_EVENT_MAX_ATTEMPTS must be > 0")
+	}
+	cfg.OrderEventMaxAttempts = maxAttempts
+
+	kafkaMaxAttempts, err := getEnvInt("KAFKA_MAX_ATTEMPTS", cfg.KafkaMaxAttempts)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid KAFKA_MAX_ATTEMPTS: %w", err)
+	}
+	if kafkaMaxAttempts <= 0 {
+		return AppConfig{}, fmt.Errorf("KAFKA_MAX_ATTEMPTS must be > 0")
+	}
+	cfg.KafkaMaxAttempts = kafkaMaxAttempts
+
+	payTimeoutSec, err := getEnvInt("ORDER_PAY_TIMEOUT_SEC", int(cfg.OrderPayTimeout.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid ORDER_PAY_TIMEOUT_SEC: %w", err)
+	}
+	if payTimeoutSec <= 0 {
+		return AppConfig{}, fmt.Errorf("ORDER_PAY_TIMEOUT_SEC must be > 0")
+	}
+	cfg.OrderPayTimeout = time.Duration(payTimeoutSec) * time.Second
+
+	expiryIntervalSec, err := getEnvInt("ORDER_EXPIRY_SCAN_INTERVAL_SEC", int(cfg.OrderExpiryInterval.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid ORDER_EXPIRY_SCAN_INTERVAL_SEC: %w", err)
+	}
+	if expiryIntervalSec <= 0 {
+		return AppConfig{}, fmt.Errorf("ORDER_EXPIRY_SCAN_INTERVAL_SEC must be > 0")
+	}
+	cfg.OrderExpiryInterval = time.Duration(expiryIntervalSec) * time.Second
+
+	expiryBatch, err := getEnvInt("ORDER_EXPIRY_BATCH", cfg.OrderExpiryBatch)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid ORDER_EXPIRY_BATCH: %w", err)
+	}
+	if expiryBatch <= 0 {
+		return AppConfig{}, fmt.Errorf("ORDER_EXPIRY_BATCH must be > 0")
+	}
+	cfg.OrderExpiryBatch = expiryBatch
+
+	sweepThresholdSec, err := getEnvInt("PENDING_SWEEP_THRESHOLD_SEC", int(cfg.PendingSweepThreshold.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid PENDING_SWEEP_THRESHOLD_SEC: %w", err)
+	}
+	if sweepThresholdSec <= 0 {
+		return AppConfig{}, fmt.Errorf("PENDING_SWEEP_THRESHOLD_SEC must be > 0")
+	}
+	cfg.PendingSweepThreshold = time.Duration(sweepThresholdSec) * time.Second
+
+	sweepIntervalSec, err := getEnvInt("PENDING_SWEEP_INTERVAL_SEC", int(cfg.PendingSweepInterval.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid PENDING_SWEEP_INTERVAL_SEC: %w", err)
+	}
+	if sweepIntervalSec <= 0 {
+		return AppConfig{}, fmt.Errorf("PENDING_SWEEP_INTERVAL_SEC must be > 0")
+	}
+	cfg.PendingSweepInterval = time.Duration(sweepIntervalSec) * time.Second
+
+	sweepBatch, err := getEnvInt("PENDING_SWEEP_BATCH", cfg.PendingSweepBatch)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid PENDING_SWEEP_BATCH: %w", err)
+	}
+	if sweepBatch <= 0 {
+		return AppConfig{}, fmt.Errorf("PENDING_SWEEP_BATCH must be > 0")
+	}
+	cfg.PendingSweepBatch = sweepBatch
+
+	streamTimeoutSec, err := getEnvInt("RESULT_STREAM_TIMEOUT_SEC", int(cfg.ResultStreamTimeout.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid RESULT_STREAM_TIMEOUT_SEC: %w", err)
+	}
+	if streamTimeoutSec <= 0 {
+		return AppConfig{}, fmt.Errorf("RESULT_STREAM_TIMEOUT_SEC must be > 0")
+	}
+	cfg.ResultStreamTimeout = time.Duration(streamTimeoutSec) * time.Second
+
+	streamHeartbeatSec, err := getEnvInt("RESULT_STREAM_HEARTBEAT_SEC", int(cfg.ResultStreamHeartbeat.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid RESULT_STREAM_HEARTBEAT_SEC: %w", err)
+	}
+	if streamHeartbeatSec <= 0 {
+		return AppConfig{}, fmt.Errorf("RESULT_STREAM_HEARTBEAT_SEC must be > 0")
+	}
+	cfg.ResultStreamHeartbeat = time.Duration(streamHeartbeatSec) * time.Second
+
+	waitMaxSec, err := getEnvInt("RESULT_WAIT_MAX_SEC", int(cfg.ResultWaitMax.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid RESULT_WAIT_MAX_SEC: %w", err)
+	}
+	if waitMaxSec <= 0 {
+		return AppConfig{}, fmt.Errorf("RESULT_WAIT_MAX_SEC must be > 0")
+	}
+	cfg.ResultWaitMax = time.Duration(waitMaxSec) * time.Second
+
+	warmupLeadMin, err := getEnvInt("CAMPAIGN_WARMUP_LEAD_MIN", int(cfg.CampaignWarmupLead.Minutes()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid CAMPAIGN_WARMUP_LEAD_MIN: %w", err)
+	}
+	if warmupLeadMin < 0 {
+		return AppConfig{}, fmt.Errorf("CAMPAIGN_WARMUP_LEAD_MIN must be >= 0")
+	}
+	cfg.CampaignWarmupLead = time.Duration(warmupLeadMin) * time.Minute
+
+	scheduleIntervalSec, err := getEnvInt("CAMPAIGN_SCHEDULE_INTERVAL_SEC", int(cfg.CampaignScheduleInterval.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid CAMPAIGN_SCHEDULE_INTERVAL_SEC: %w", err)
+	}
+	if scheduleIntervalSec <= 0 {
+		return AppConfig{}, fmt.Errorf("CAMPAIGN_SCHEDULE_INTERVAL_SEC must be > 0")
+	}
+	cfg.CampaignScheduleInterval = time.Duration(scheduleIntervalSec) * time.Second
+
+	lotteryIntervalSec, err := getEnvInt("LOTTERY_SCHEDULE_INTERVAL_SEC", int(cfg.LotteryScheduleInterval.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid LOTTERY_SCHEDULE_INTERVAL_SEC: %w", err)
+	}
+	if lotteryIntervalSec <= 0 {
+		return AppConfig{}, fmt.Errorf("LOTTERY_SCHEDULE_INTERVAL_SEC must be > 0")
+	}
+	cfg.LotteryScheduleInterval = time.Duration(lotteryIntervalSec) * time.Second
+
+	waitingRoomEnabled, err := getEnvBool("WAITING_ROOM_ENABLED", cfg.WaitingRoomEnabled)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid WAITING_ROOM_ENABLED: %w", err)
+	}
+	cfg.WaitingRoomEnabled = waitingRoomEnabled
+
+	admitRate, err := getEnvInt("WAITING_ROOM_ADMIT_RATE", cfg.WaitingRoomAdmitRate)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid WAITING_ROOM_ADMIT_RATE: %w", err)
+	}
+	if admitRate <= 0 {
+		return AppConfig{}, fmt.Errorf("WAITING_ROOM_ADMIT_RATE must be > 0")
+	}
+	cfg.WaitingRoomAdmitRate = admitRate
+
+	admitIntervalMS, err := getEnvInt("WAITING_ROOM_ADMIT_INTERVAL_MS", int(cfg.WaitingRoomAdmitInterval.Milliseconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid WAITING_ROOM_ADMIT_INTERVAL_MS: %w", err)
+	}
+	if admitIntervalMS <= 0 {
+		return AppConfig{}, fmt.Errorf("WAITING_ROOM_ADMIT_INTERVAL_MS must be > 0")
+	}
+	cfg.WaitingRoomAdmitInterval = time.Duration(admitIntervalMS) * time.Millisecond
+
+	tokenTTLSec, err := getEnvInt("WAITING_ROOM_TOKEN_TTL_SEC", int(cfg.WaitingRoomTokenTTL.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid WAITING_ROOM_TOKEN_TTL_SEC: %w", err)
+	}
+	if tokenTTLSec <= 0 {
+		return AppConfig{}, fmt.Errorf("WAITING_ROOM_TOKEN_TTL_SEC must be > 0")
+	}
+	cfg.WaitingRoomTokenTTL = time.Duration(tokenTTLSec) * time.Second
+
+	if cfg.WaitingRoomEnabled && cfg.WaitingRoomSecret == "" {
+		return AppConfig{}, fmt.Errorf("WAITING_ROOM_SECRET is required when WAITING_ROOM_ENABLED=true")
+	}
+
+	jwtEnabled, err := getEnvBool("JWT_ENABLED", cfg.JWTEnabled)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid JWT_ENABLED: %w", err)
+	}
+	cfg.JWTEnabled = jwtEnabled
+
+	jwtLeewaySec, err := getEnvInt("JWT_LEEWAY_SEC", int(cfg.JWTLeeway.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid JWT_LEEWAY_SEC: %w", err)
+	}
+	if jwtLeewaySec < 0 {
+		return AppConfig{}, fmt.Errorf("JWT_LEEWAY_SEC must be >= 0")
+	}
+	cfg.JWTLeeway = time.Duration(jwtLeewaySec) * time.Second
+
+	if cfg.JWTEnabled && len(cfg.JWTHS256Secrets) == 0 && cfg.JWTJWKSFile == "" {
+		return AppConfig{}, fmt.Errorf("JWT_HS256_SECRETS or JWT_JWKS_FILE is required when JWT_ENABLED=true (set JWT_ENABLED=false only for local debugging)")
+	}
+
+	signedEnabled, err := getEnvBool("SIGNED_REQUESTS_ENABLED", cfg.SignedRequestsEnabled)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid SIGNED_REQUESTS_ENABLED: %w", err)
+	}
+	cfg.SignedRequestsEnabled = signedEnabled
+
+	signingKeys, err := parseKeyPairs(getEnv("SIGNING_KEYS", ""))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid SIGNING_KEYS: %w", err)
+	}
+	cfg.SigningKeys = signingKeys
+
+	maxSkewSec, err := getEnvInt("SIGNATURE_MAX_SKEW_SEC", int(cfg.SignatureMaxSkew.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid SIGNATURE_MAX_SKEW_SEC: %w", err)
+	}
+	if maxSkewSec <= 0 {
+		return AppConfig{}, fmt.Errorf("SIGNATURE_MAX_SKEW_SEC must be > 0")
+	}
+	cfg.SignatureMaxSkew = time.Duration(maxSkewSec) * time.Second
+
+	if cfg.SignedRequestsEnabled && len(cfg.SigningKeys) == 0 {
+		return AppConfig{}, fmt.Errorf("SIGNING_KEYS is required when SIGNED_REQUESTS_ENABLED=true")
+	}
+
+	powEnabled, err := getEnvBool("POW_ENABLED", cfg.PowEnabled)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid POW_ENABLED: %w", err)
+	}
+	cfg.PowEnabled = powEnabled
+
+	powMin, err := getEnvInt("POW_MIN_DIFFICULTY", cfg.PowMinDifficulty)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid POW_MIN_DIFFICULTY: %w", err)
+	}
+	if powMin < 0 {
+		return AppConfig{}, fmt.Errorf("POW_MIN_DIFFICULTY must be >= 0")
+	}
+	cfg.PowMinDifficulty = powMin
+
+	powMax, err := getEnvInt("POW_MAX_DIFFICULTY", cfg.PowMaxDifficulty)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid POW_MAX_DIFFICULTY: %w", err)
+	}
+	if powMax < cfg.PowMinDifficulty || powMax > 32 {
+		return AppConfig{}, fmt.Errorf("POW_MAX_DIFFICULTY must be between POW_MIN_DIFFICULTY and 32")
+	}
+	cfg.PowMaxDifficulty = powMax
+
+	powBaseQPS, err := getEnvInt("POW_BASE_QPS", cfg.PowBaseQPS)
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid POW_BASE_QPS: %w", err)
+	}
+	if powBaseQPS <= 0 {
+		return AppConfig{}, fmt.Errorf("POW_BASE_QPS must be > 0")
+	}
+	cfg.PowBaseQPS = powBaseQPS
+
+	powTTLSec, err := getEnvInt("POW_CHALLENGE_TTL_SEC", int(cfg.PowChallengeTTL.Seconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid POW_CHALLENGE_TTL_SEC: %w", err)
+	}
+	if powTTLSec <= 0 {
+		return AppConfig{}, fmt.Errorf("POW_CHALLENGE_TTL_SEC must be > 0")
+	}
+	cfg.PowChallengeTTL = time.Duration(powTTLSec) * time.Second
+
+	riskTimeoutMS, err := getEnvInt("RISK_EVALUATOR_TIMEOUT_MS", int(cfg.RiskEvaluatorTimeout.Milliseconds()))
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid RISK_EVALUATOR_TIMEOUT_MS: %w", err)
+	}
+	if riskTimeoutMS <= 0 {
+		return AppConfig{}, fmt.Errorf("RISK_EVALUATOR_TIMEOUT_MS must be > 0")
+	}
+	cfg.RiskEvaluatorTimeout = time.Duration(riskTimeoutMS) * time.Millisecond
+
+	if cfg.AdminBootstrapKey != "" && len(cfg.AdminBootstrapKey) < 12 {
+		return AppConfig{}, fmt.Errorf("ADMIN_BOOTSTRAP_KEY must be at least 12 characters")
+	}
+
+	if (cfg.PowEnabled || cfg.RiskEvaluatorURL != "") && cfg.PowSecret == "" {
+		return AppConfig{}, fmt.Errorf("POW_SECRET is required when POW_ENABLED=true or RISK_EVALUATOR_URL is set")
+	}
+
+	switch cfg.DBDriver {
+	case DBDriverSQLite:
+		if cfg.DBDSN == "" {
+			cfg.DBDSN = getEnv("DB_PATH", "flash_sale.db")
+		}
+		if cfg.DBIsolation != "" {
+			return AppConfig{}, fmt.Errorf("DB_ISOLATION_LEVEL is not supported by %s", DBDriverSQLite)
+		}
+	case DBDriverPostgres, DBDriverMySQL:
+		if cfg.DBDSN == "" {
+			return AppConfig{}, fmt.Errorf("DB_DSN must not be empty for DB_DRIVER=%s", cfg.DBDriver)
+		}
+	default:
+		return AppConfig{}, fmt.Errorf("DB_DRIVER must be one of %s, %s, %s", DBDriverSQLite, DBDriverPostgres, DBDriverMySQL)
+	}
+	switch cfg.DBIsolation {
+	case "", IsolationReadCommitted, IsolationRepeatableRead, IsolationSerializable:
+	default:
+		return AppConfig{}, fmt.Errorf("DB_ISOLATION_LEVEL must be one of %s, %s, %s", IsolationReadCommitted, IsolationRepeatableRead, IsolationSerializable)
+	}
+
+	switch cfg.PipelineMode {
+	case PipelineRelay:
+	case PipelineStream:
+		if cfg.StreamConsumerGroup == "" || cfg.StreamConsumerGroup == cfg.OrderEventGroup {
+			return AppConfig{}, fmt.Errorf("STREAM_CONSUMER_GROUP must be non-empty and differ from ORDER_EVENT_GROUP")
+		}
+	default:
+		return AppConfig{}, fmt.Errorf("PIPELINE_MODE must be one of %s, %s", PipelineRelay, PipelineStream)
+	}
+
+	switch cfg.Broker {
+	case BrokerKafka:
+		if len(cfg.KafkaBrokers) == 0 && cfg.PipelineMode == PipelineRelay {
+			return AppConfig{}, fmt.Errorf("KAFKA_BROKERS must not be empty")
+		}
+	case BrokerMemory:
+	default:
+		return AppConfig{}, fmt.Errorf("BROKER must be one of %s, %s", BrokerKafka, BrokerMemory)
 	}
 	if cfg.KafkaTopic == "" {
 		return AppConfig{}, fmt.Errorf("KAFKA_TOPIC must not be empty")
@@ -96,6 +589,9 @@ func Load() (AppConfig, error) {
 	if cfg.KafkaGroupID == "" {
 		return AppConfig{}, fmt.Errorf("KAFKA_GROUP_ID must not be empty")
 	}
+	if cfg.KafkaDLQTopic == "" || cfg.KafkaDLQTopic == cfg.KafkaTopic {
+		return AppConfig{}, fmt.Errorf("KAFKA_DLQ_TOPIC must be non-empty and differ from KAFKA_TOPIC")
+	}
 	if cfg.OrderEventStream == "" {
 		return AppConfig{}, fmt.Errorf("ORDER_EVENT_STREAM must not be empty")
 	}
@@ -127,6 +623,32 @@ func getEnvInt(key string, fallback int) (int, error) {
 	return strconv.Atoi(v)
 }
 
+// getEnvBool 读取布尔环境变量（true/false/1/0），若为空则返回默认值。
+func getEnvBool(key string, fallback bool) (bool, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(v)
+}
+
+// parseKeyPairs 解析 "client1:secret1,client2:secret2" 形式的客户端密钥。
+func parseKeyPairs(value string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, pair := range splitCSV(value) {
+		id, secret, ok := strings.Cut(pair, ":")
+		id, secret = strings.TrimSpace(id), strings.TrimSpace(secret)
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("expected client_id:secret, got %q", pair)
+		}
+		if _, dup := out[id]; dup {
+			return nil, fmt.Errorf("duplicate client_id %q", id)
+		}
+		out[id] = secret
+	}
+	return out, nil
+}
+
 // splitCSV 将逗号分隔字符串解析为字符串切片。
 func splitCSV(value string) []string {
 	parts := strings.Split(value, ",")
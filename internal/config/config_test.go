@@ -0,0 +1,149 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadDBIsolation(t *testing.T) {
+	tests := []struct {
+		name      string
+		driver    string
+		dsn       string
+		isolation string
+		wantErr   bool
+	}{
+		{"sqlite default", DBDriverSQLite, "", "", false},
+		{"sqlite rejects isolation", DBDriverSQLite, "", "serializable", true},
+		{"postgres read committed", DBDriverPostgres, "postgres://localhost/flash_sale", "READ_COMMITTED", false},
+		{"mysql serializable", DBDriverMySQL, "root:flash@tcp(localhost:3306)/flash_sale", "serializable", false},
+		{"postgres requires dsn", DBDriverPostgres, "", "", true},
+		{"unknown isolation", DBDriverPostgres, "postgres://localhost/flash_sale", "snapshot", true},
+		{"unknown driver", "oracle", "x", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_DRIVER", tt.driver)
+			t.Setenv("DB_DSN", tt.dsn)
+			t.Setenv("DB_ISOLATION_LEVEL", tt.isolation)
+			t.Setenv("JWT_HS256_SECRETS", "test-secret")
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Load() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load(): %v", err)
+			}
+			if cfg.DBIsolation != strings.ToLower(tt.isolation) {
+				t.Fatalf("DBIsolation = %q, want %q", cfg.DBIsolation, strings.ToLower(tt.isolation))
+			}
+		})
+	}
+}
+
+func TestLoadJWT(t *testing.T) {
+	tests := []struct {
+		name        string
+		enabled     string
+		secrets     string
+		jwksFile    string
+		wantEnabled bool
+		wantErr     bool
+	}{
+		{"enabled by default", "", "s1,s2", "", true, false},
+		{"default requires key", "", "", "", false, true},
+		{"jwks only", "true", "", "/etc/flash_sale/jwks.json", true, false},
+		{"explicitly disabled", "false", "", "", false, false},
+		{"invalid flag", "maybe", "s1", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JWT_ENABLED", tt.enabled)
+			t.Setenv("JWT_HS256_SECRETS", tt.secrets)
+			t.Setenv("JWT_JWKS_FILE", tt.jwksFile)
+			cfg, err := Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Load() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load(): %v", err)
+			}
+			if cfg.JWTEnabled != tt.wantEnabled {
+				t.Fatalf("JWTEnabled = %v, want %v", cfg.JWTEnabled, tt.wantEnabled)
+			}
+		})
+	}
+}
+
+func TestLoadAdminBootstrapKey(t *testing.T) {
+	t.Setenv("JWT_HS256_SECRETS", "test-secret")
+
+	t.Setenv("ADMIN_BOOTSTRAP_KEY", "")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	// 未配置时不得回落到任何内置密钥。
+	if cfg.AdminBootstrapKey != "" {
+		t.Fatalf("AdminBootstrapKey = %q, want empty", cfg.AdminBootstrapKey)
+	}
+
+	t.Setenv("ADMIN_BOOTSTRAP_KEY", "bootstrap-0123456789")
+	if cfg, err = Load(); err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if cfg.AdminBootstrapKey != "bootstrap-0123456789" {
+		t.Fatalf("AdminBootstrapKey = %q", cfg.AdminBootstrapKey)
+	}
+}
+
+func TestLoadWaitingRoomSecret(t *testing.T) {
+	t.Setenv("JWT_HS256_SECRETS", "test-secret")
+	t.Setenv("WAITING_ROOM_ENABLED", "true")
+
+	// 未配置时不得回落到内置密钥，开启等待室必须显式设置。
+	t.Setenv("WAITING_ROOM_SECRET", "")
+	if _, err := Load(); err == nil {
+		t.Fatalf("Load() without WAITING_ROOM_SECRET: want error")
+	}
+
+	t.Setenv("WAITING_ROOM_SECRET", "room-secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if cfg.WaitingRoomSecret != "room-secret" {
+		t.Fatalf("WaitingRoomSecret = %q", cfg.WaitingRoomSecret)
+	}
+}
+
+func TestLoadPowSecret(t *testing.T) {
+	t.Setenv("JWT_HS256_SECRETS", "test-secret")
+
+	// 未配置时不得回落到内置密钥：开启工作量证明或配置风控评估器时都必须显式设置。
+	t.Setenv("POW_SECRET", "")
+	t.Setenv("POW_ENABLED", "true")
+	if _, err := Load(); err == nil {
+		t.Fatalf("Load() with POW_ENABLED and no POW_SECRET: want error")
+	}
+	t.Setenv("POW_ENABLED", "false")
+	t.Setenv("RISK_EVALUATOR_URL", "http://risk.local/evaluate")
+	if _, err := Load(); err == nil {
+		t.Fatalf("Load() with RISK_EVALUATOR_URL and no POW_SECRET: want error")
+	}
+
+	t.Setenv("POW_SECRET", "pow-secret")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load(): %v", err)
+	}
+	if cfg.PowSecret != "pow-secret" {
+		t.Fatalf("PowSecret = %q", cfg.PowSecret)
+	}
+}
@@ -0,0 +1,313 @@
+package lottery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAlreadyDrawn 表示抽签已开奖。
+var ErrAlreadyDrawn = errors.New("lottery already drawn")
+
+// Algorithm 描述开奖算法，随抽签明细公开，任何人可用公开的种子与报名名单复算。
+const Algorithm = `score = hex(sha256(seed + ":" + user_id))；按 score 升序（相同按 user_id 升序）排名，前 winners 名中签；winners = min(商品库存, 报名人数)；seed_commitment = hex(sha256(seed))`
+
+// 批量更新 / 投递时单批的请求数，控制 IN 列表与 Redis 管道大小。
+const batchSize = 500
+
+// Score 计算用户在该种子下的抽签分值（分值越小排名越靠前）。
+func Score(seed string, userID int64) string {
+	sum := sha256.Sum256([]byte(seed + ":" + strconv.FormatInt(userID, 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+type rankedEntry struct {
+	model.LotteryEntry
+	score string
+}
+
+// rank 按 Algorithm 对报名记录排序。
+func rank(seed string, entries []model.LotteryEntry) []rankedEntry {
+	out := make([]rankedEntry, len(entries))
+	for i, e := range entries {
+		out[i] = rankedEntry{LotteryEntry: e, score: Score(seed, e.UserID)}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score != out[j].score {
+			return out[i].score < out[j].score
+		}
+		return out[i].UserID < out[j].UserID
+	})
+	return out
+}
+
+// Draw 开奖：在一个事务内确定中签者，中签请求由“已报名”转为 pending，落选转为 not_selected。
+// 中签请求随后由 Dispatch 写入下单 outbox。报名未结束时返回 ErrDrawTooEarly。
+// 同一事务内写入 lottery.draw 审计事件（操作者取自 ctx）。
+func Draw(ctx context.Context, db *gorm.DB, id uint) (model.Lottery, error) {
+	var out model.Lottery
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var l model.Lottery
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&l, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrLotteryNotFound
+			}
+			return err
+		}
+		if l.Status != model.LotteryOpen {
+			return ErrAlreadyDrawn
+		}
+		now := time.Now()
+		if now.Before(l.RegisterEnd) {
+			return ErrDrawTooEarly
+		}
+
+		var prod model.Product
+		if err := tx.First(&prod, l.ProductID).Error; err != nil {
+			return err
+		}
+		var entries []model.LotteryEntry
+		if err := tx.Where("lottery_id = ?", l.ID).Order("id ASC").Find(&entries).Error; err != nil {
+			return err
+		}
+
+		ranked := rank(l.Seed, entries)
+		winners := min(int(prod.Stock), len(ranked))
+		var winnerIDs []uint
+		var winnerReqs, loserReqs []string
+		for i, e := range ranked {
+			if i < winners {
+				winnerIDs = append(winnerIDs, e.ID)
+				winnerReqs = append(winnerReqs, e.RequestID)
+			} else {
+				loserReqs = append(loserReqs, e.RequestID)
+			}
+		}
+
+		for _, ids := range chunk(winnerIDs) {
+			if err := tx.Model(&model.LotteryEntry{}).Where("id IN ?", ids).Update("selected", true).Error; err != nil {
+				return err
+			}
+		}
+		if err := updateRequests(tx, winnerReqs, map[string]any{"status": model.OrderRequestPending}); err != nil {
+			return err
+		}
+		if err := updateRequests(tx, loserReqs, map[string]any{"status": model.OrderRequestNotSelected, "error_msg": rediskey.RequestNotSelected}); err != nil {
+			return err
+		}
+
+		l.Status = model.LotteryDrawn
+		l.EntryCount = len(entries)
+		l.Winners = winners
+		l.DrawnAt = &now
+		if err := tx.Model(&model.Lottery{}).Where("id = ?", l.ID).Updates(map[string]any{
+			"status":      l.Status,
+			"entry_count": l.EntryCount,
+			"winners":     l.Winners,
+			"drawn_at":    now,
+		}).Error; err != nil {
+			return err
+		}
+		e := audit.New(ctx, audit.ActionLotteryDraw, audit.TargetLottery, strconv.FormatUint(uint64(l.ID), 10))
+		e.ProductID = l.ProductID
+		e.Detail = map[string]any{"entry_count": l.EntryCount, "winners": l.Winners}
+		if err := audit.Record(ctx, tx, e); err != nil {
+			return err
+		}
+		out = l
+		return nil
+	})
+	return out, err
+}
+
+// updateRequests 分批更新仍处于“已报名”状态的请求行。
+func updateRequests(tx *gorm.DB, requestIDs []string, values map[string]any) error {
+	for _, ids := range chunk(requestIDs) {
+		if err := tx.Model(&model.OrderRequest{}).
+			Where("request_id IN ? AND status = ?", ids, model.OrderRequestRegistered).
+			Updates(values).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dispatch 将已开奖抽签的中签请求写入下单链路：与 /buy 的 Lua 一样扣减 Redis 库存、占用限购额度，
+// 写入 pending 状态、pending 索引与 outbox 条目，之后失败 / 取消 / 超时的回补与普通下单一致；
+// 并把落选结果写入请求状态缓存（同时发布终态事件）。
+// 中途失败时整体重试：已投递的中签请求按 request_id 标记跳过，不会重复扣库存。
+func Dispatch(ctx context.Context, db *gorm.DB, rdb *rd.Client, stream string, id uint, stateTTL time.Duration) error {
+	db = db.WithContext(ctx)
+	l, err := Get(db, id)
+	if err != nil {
+		return err
+	}
+	if l.Status != model.LotteryDrawn {
+		return nil
+	}
+	var prod model.Product
+	if err := db.First(&prod, l.ProductID).Error; err != nil {
+		return err
+	}
+	// 限购计数的保留时长与 /buy 一致：覆盖到发售结束后 1 小时。
+	quotaTTL := time.Until(prod.EndTime) + time.Hour
+	if quotaTTL < time.Hour {
+		quotaTTL = 24 * time.Hour
+	}
+
+	var rows []model.OrderRequest
+	winners := db.Model(&model.LotteryEntry{}).Select("request_id").Where("lottery_id = ? AND selected = ?", l.ID, true)
+	if err := db.Where("request_id IN (?)", winners).Order("id ASC").
+		FindInBatches(&rows, batchSize, func(_ *gorm.DB, _ int) error {
+			return enqueueWinners(ctx, rdb, stream, rows, stateTTL, quotaTTL)
+		}).Error; err != nil {
+		return err
+	}
+
+	losers := db.Model(&model.LotteryEntry{}).Select("request_id").Where("lottery_id = ? AND selected = ?", l.ID, false)
+	if err := db.Where("request_id IN (?)", losers).Order("id ASC").
+		FindInBatches(&rows, batchSize, func(_ *gorm.DB, _ int) error {
+			states := make([]rediskey.RequestState, 0, len(rows))
+			for _, r := range rows {
+				states = append(states, rediskey.RequestState{RequestID: r.RequestID, Status: rediskey.RequestNotSelected})
+			}
+			return rediskey.PutRequestStates(ctx, rdb, states, stateTTL)
+		}).Error; err != nil {
+		return err
+	}
+
+	return db.Model(&model.Lottery{}).
+		Where("id = ? AND status = ?", l.ID, model.LotteryDrawn).
+		Updates(map[string]any{"status": model.LotteryDispatched, "dispatched_at": time.Now()}).Error
+}
+
+// luaEnqueueWinner 与 /buy 的 Lua 一样扣减库存、累加用户已占用数量，并写入相同的 outbox 条目、
+// pending 状态（含 outbox entry ID）与 pending 索引；投递标记已存在时跳过（Dispatch 重试）。
+// 中签人数按开奖时的 DB 库存确定，不再校验 Redis 库存：未预热时库存会被扣为负数，由对账发现。
+// KEYS: outbox stream、请求状态、pending 索引、投递标记、库存、用户已占用数量；
+// ARGV: request_id、user_id、product_id、sku_id、quantity、amount、状态 TTL（秒）、当前毫秒时间戳、标记 TTL（秒）、限购计数 TTL（秒）。
+const luaEnqueueWinner = `
+if not redis.call('SET', KEYS[4], '1', 'NX', 'EX', ARGV[9]) then
+  return 0
+end
+redis.call('DECRBY', KEYS[5], ARGV[5])
+redis.call('INCRBY', KEYS[6], ARGV[5])
+redis.call('EXPIRE', KEYS[6], ARGV[10])
+local eventID = redis.call('XADD', KEYS[1], '*',
+  'request_id', ARGV[1],
+  'product_id', ARGV[3],
+  'sku_id', ARGV[4],
+  'user_id', ARGV[2],
+  'quantity', ARGV[5],
+  'amount', ARGV[6]
+)
+redis.call('HSET', KEYS[2],
+  'request_id', ARGV[1],
+  'status', 'pending',
+  'order_no', '',
+  'reason', '',
+  'user_id', ARGV[2],
+  'product_id', ARGV[3],
+  'sku_id', ARGV[4],
+  'quantity', ARGV[5],
+  'amount', ARGV[6],
+  'event_id', eventID
+)
+redis.call('EXPIRE', KEYS[2], ARGV[7])
+redis.call('ZADD', KEYS[3], ARGV[8], ARGV[1])
+return 1
+`
+
+func enqueueWinners(ctx context.Context, rdb *rd.Client, stream string, rows []model.OrderRequest, stateTTL, quotaTTL time.Duration) error {
+	nowMs := time.Now().UnixMilli()
+	const markTTLSeconds = int64(rediskey.CompensationMarkTTL / time.Second)
+	pipe := rdb.TxPipeline()
+	for _, r := range rows {
+		pipe.Eval(ctx, luaEnqueueWinner,
+			[]string{
+				stream, rediskey.RequestStatusKey(r.RequestID), rediskey.PendingRequestsKey(), rediskey.LotteryEnqueuedKey(r.RequestID),
+				rediskey.StockKey(r.ProductID, r.SKUID), rediskey.UserPurchasedQtyKey(r.ProductID, r.UserID),
+			},
+			r.RequestID, r.UserID, r.ProductID, r.SKUID, r.Quantity, r.Amount, int64(stateTTL/time.Second), nowMs,
+			markTTLSeconds, int64(quotaTTL/time.Second),
+		)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LogEntry 为抽签明细中的一行。
+type LogEntry struct {
+	Rank     int    `json:"rank"`
+	UserID   int64  `json:"user_id"`
+	Score    string `json:"score"`
+	Selected bool   `json:"selected"`
+}
+
+// Log 为开奖后公开的审计信息：种子、承诺、算法与按排名排列的全部报名者。
+type Log struct {
+	LotteryID      uint       `json:"lottery_id"`
+	ProductID      uint       `json:"product_id"`
+	Seed           string     `json:"seed"`
+	SeedCommitment string     `json:"seed_commitment"`
+	Algorithm      string     `json:"algorithm"`
+	EntryCount     int        `json:"entry_count"`
+	Winners        int        `json:"winners"`
+	DrawnAt        *time.Time `json:"drawn_at"`
+	Entries        []LogEntry `json:"entries"`
+}
+
+// DrawLog 返回开奖明细；分值按公开算法现算，Selected 为开奖时实际落库的结果，两者可互相印证。
+func DrawLog(db *gorm.DB, id uint) (Log, error) {
+	l, err := Get(db, id)
+	if err != nil {
+		return Log{}, err
+	}
+	if l.Status == model.LotteryOpen {
+		return Log{}, ErrNotDrawn
+	}
+	var entries []model.LotteryEntry
+	if err := db.Where("lottery_id = ?", l.ID).Find(&entries).Error; err != nil {
+		return Log{}, err
+	}
+
+	out := Log{
+		LotteryID:      l.ID,
+		ProductID:      l.ProductID,
+		Seed:           l.Seed,
+		SeedCommitment: l.SeedCommitment,
+		Algorithm:      Algorithm,
+		EntryCount:     l.EntryCount,
+		Winners:        l.Winners,
+		DrawnAt:        l.DrawnAt,
+		Entries:        make([]LogEntry, 0, len(entries)),
+	}
+	for i, e := range rank(l.Seed, entries) {
+		out.Entries = append(out.Entries, LogEntry{Rank: i + 1, UserID: e.UserID, Score: e.score, Selected: e.Selected})
+	}
+	return out, nil
+}
+
+func chunk[T any](items []T) [][]T {
+	var out [][]T
+	for len(items) > batchSize {
+		out = append(out, items[:batchSize])
+		items = items[batchSize:]
+	}
+	if len(items) > 0 {
+		out = append(out, items)
+	}
+	return out
+}
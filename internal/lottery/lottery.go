@@ -0,0 +1,172 @@
+package lottery
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrLotteryNotFound 表示抽签不存在。
+	ErrLotteryNotFound = errors.New("lottery not found")
+	// ErrInvalidSchedule 表示报名窗口或开奖时间不合法。
+	ErrInvalidSchedule = errors.New("invalid lottery schedule")
+	// ErrProductUnavailable 表示商品不存在、有 SKU、已归属活动或已设置抽签。
+	ErrProductUnavailable = errors.New("product not found or not eligible for lottery")
+	// ErrRegistrationClosed 表示不在报名窗口内（或已开奖）。
+	ErrRegistrationClosed = errors.New("lottery registration closed")
+	// ErrNotDrawn 表示尚未开奖，种子与抽签明细不公开。
+	ErrNotDrawn = errors.New("lottery not drawn yet")
+	// ErrDrawTooEarly 表示报名尚未结束，不能开奖。
+	ErrDrawTooEarly = errors.New("lottery registration still open")
+)
+
+// Create 为商品创建抽签：商品发售方式改为 lottery（不再接受 /buy），中签名额为商品库存。
+// 种子在创建时生成并只公布其 SHA-256 承诺，开奖后公开种子供校验。同一事务内写入 lottery.create 审计事件。
+func Create(ctx context.Context, db *gorm.DB, productID uint, registerStart, registerEnd, drawAt time.Time) (model.Lottery, error) {
+	if !registerEnd.After(registerStart) || drawAt.Before(registerEnd) || !registerEnd.After(time.Now()) {
+		return model.Lottery{}, ErrInvalidSchedule
+	}
+	seed, err := newSeed()
+	if err != nil {
+		return model.Lottery{}, err
+	}
+
+	l := model.Lottery{
+		ProductID:      productID,
+		RegisterStart:  registerStart,
+		RegisterEnd:    registerEnd,
+		DrawAt:         drawAt,
+		Status:         model.LotteryOpen,
+		Seed:           seed,
+		SeedCommitment: Commitment(seed),
+	}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var skus int64
+		if err := tx.Model(&model.SKU{}).Where("product_id = ?", productID).Count(&skus).Error; err != nil {
+			return err
+		}
+		if skus > 0 {
+			return ErrProductUnavailable
+		}
+		res := tx.Model(&model.Product{}).
+			Where("id = ? AND campaign_id IS NULL AND sale_mode = ?", productID, model.SaleModeFCFS).
+			Update("sale_mode", model.SaleModeLottery)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrProductUnavailable
+		}
+		if err := tx.Create(&l).Error; err != nil {
+			return err
+		}
+		e := audit.New(ctx, audit.ActionLotteryCreate, audit.TargetLottery, strconv.FormatUint(uint64(l.ID), 10))
+		e.ProductID = productID
+		e.Detail = map[string]any{
+			"register_start":  registerStart,
+			"register_end":    registerEnd,
+			"draw_at":         drawAt,
+			"seed_commitment": l.SeedCommitment,
+		}
+		return audit.Record(ctx, tx, e)
+	})
+	if err != nil {
+		return model.Lottery{}, err
+	}
+	return l, nil
+}
+
+// Get 查询抽签（不含种子）。
+func Get(db *gorm.DB, id uint) (model.Lottery, error) {
+	var l model.Lottery
+	if err := db.First(&l, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Lottery{}, ErrLotteryNotFound
+		}
+		return model.Lottery{}, err
+	}
+	return l, nil
+}
+
+// Register 报名抽签，同一用户重复报名返回原报名记录。
+// 同时写入“已报名”状态的 order_requests 行，开奖前 /result 查询为 pending，开奖后为 pending（中签）或 not_selected。
+func Register(ctx context.Context, db *gorm.DB, lotteryID uint, userID int64) (model.LotteryEntry, error) {
+	db = db.WithContext(ctx)
+	l, err := Get(db, lotteryID)
+	if err != nil {
+		return model.LotteryEntry{}, err
+	}
+	now := time.Now()
+	if l.Status != model.LotteryOpen || now.Before(l.RegisterStart) || !now.Before(l.RegisterEnd) {
+		return model.LotteryEntry{}, ErrRegistrationClosed
+	}
+
+	if e, found, err := findEntry(db, lotteryID, userID); err != nil || found {
+		return e, err
+	}
+
+	var prod model.Product
+	if err := db.First(&prod, l.ProductID).Error; err != nil {
+		return model.LotteryEntry{}, err
+	}
+
+	entry := model.LotteryEntry{
+		LotteryID: lotteryID,
+		UserID:    userID,
+		RequestID: uuid.New().String(),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.OrderRequest{
+			RequestID: entry.RequestID,
+			UserID:    userID,
+			ProductID: l.ProductID,
+			Quantity:  1,
+			Amount:    prod.SalePrice,
+			Status:    model.OrderRequestRegistered,
+		}).Error
+	})
+	if err != nil {
+		// 并发重复报名：唯一索引冲突，返回先写入的记录。
+		if storage.IsUniqueViolation(err) {
+			e, _, err := findEntry(db, lotteryID, userID)
+			return e, err
+		}
+		return model.LotteryEntry{}, err
+	}
+	return entry, nil
+}
+
+func findEntry(db *gorm.DB, lotteryID uint, userID int64) (model.LotteryEntry, bool, error) {
+	var e model.LotteryEntry
+	res := db.Where("lottery_id = ? AND user_id = ?", lotteryID, userID).Limit(1).Find(&e)
+	return e, res.RowsAffected == 1, res.Error
+}
+
+// Commitment 返回种子的承诺值 hex(sha256(seed))。
+func Commitment(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSeed() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
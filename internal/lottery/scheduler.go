@@ -0,0 +1,104 @@
+package lottery
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Drawer 周期性推进抽签：到达开奖时间的抽签开奖（事务内加锁，多实例只开一次），
+// 已开奖未投递的抽签把中签请求写入下单 outbox（失败下一轮重试）。
+type Drawer struct {
+	db     *gorm.DB
+	rdb    *rd.Client
+	stream string
+
+	interval time.Duration
+	stateTTL time.Duration
+}
+
+func NewDrawer(db *gorm.DB, rdb *rd.Client, stream string, interval, stateTTL time.Duration) *Drawer {
+	return &Drawer{
+		db:       db,
+		rdb:      rdb,
+		stream:   stream,
+		interval: interval,
+		stateTTL: stateTTL,
+	}
+}
+
+func (d *Drawer) Run(ctx context.Context) {
+	ctx = audit.WithActor(ctx, "system:lottery")
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Drawer) runOnce(ctx context.Context) {
+	if err := d.drawDue(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("lottery draw: %v", err)
+	}
+	if err := d.dispatchDue(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("lottery dispatch: %v", err)
+	}
+}
+
+func (d *Drawer) drawDue(ctx context.Context) error {
+	var ids []uint
+	if err := d.db.WithContext(ctx).Model(&model.Lottery{}).
+		Where("status = ? AND draw_at <= ?", model.LotteryOpen, time.Now()).
+		Order("draw_at ASC").
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		l, err := Draw(ctx, d.db, id)
+		if err != nil {
+			if !errors.Is(err, ErrAlreadyDrawn) {
+				log.Printf("lottery draw id=%d: %v", id, err)
+			}
+			continue
+		}
+		log.Printf("lottery drawn id=%d entries=%d winners=%d", l.ID, l.EntryCount, l.Winners)
+	}
+	return nil
+}
+
+func (d *Drawer) dispatchDue(ctx context.Context) error {
+	var ids []uint
+	if err := d.db.WithContext(ctx).Model(&model.Lottery{}).
+		Where("status = ?", model.LotteryDrawn).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := Dispatch(ctx, d.db, d.rdb, d.stream, id, d.stateTTL); err != nil {
+			log.Printf("lottery dispatch id=%d: %v", id, err)
+			continue
+		}
+		log.Printf("lottery dispatched id=%d", id)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"flash_sale/internal/adminkey"
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 校验通过的管理密钥在 gin.Context 中的键。
+const adminKeyContextKey = "auth.admin_key"
+
+// RequireAdminKey 校验 X-Admin-Token 中的管理 API 密钥（库中摘要、常量时间比较，需未吊销且未过期），
+// 并把密钥写入上下文（审计事件的操作者记为 admin_key:<前缀>）；具体权限由后续的 RequireScope 检查。
+func RequireAdminKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k, err := adminkey.Authenticate(c.Request.Context(), db, c.GetHeader("X-Admin-Token"))
+		if err != nil {
+			if errors.Is(err, adminkey.ErrInvalidKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "admin token 无效"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.Set(adminKeyContextKey, k)
+		c.Request = c.Request.WithContext(audit.WithActor(c.Request.Context(), "admin_key:"+k.Prefix))
+		c.Next()
+	}
+}
+
+// RequireScope 要求当前管理密钥拥有权限 scope，需排在 RequireAdminKey 之后。
+func RequireScope(scope adminkey.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k, ok := AdminKey(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "admin token 无效"})
+			return
+		}
+		if !adminkey.Allowed(k, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 403, "msg": "权限不足，需要 " + string(scope)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminKey 返回 RequireAdminKey 校验得到的管理密钥。
+func AdminKey(c *gin.Context) (model.AdminKey, bool) {
+	v, ok := c.Get(adminKeyContextKey)
+	if !ok {
+		return model.AdminKey{}, false
+	}
+	k, ok := v.(model.AdminKey)
+	return k, ok
+}
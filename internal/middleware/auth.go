@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"flash_sale/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 校验通过的用户 ID 在 gin.Context 中的键。
+const userIDContextKey = "auth.user_id"
+
+// RequireJWT 校验 Bearer JWT，并把令牌中的用户 ID 写入上下文供后续限流与业务使用。
+// 令牌取自 Authorization: Bearer <token>；EventSource / WebSocket 无法自定义请求头，可改用 ?access_token=。
+// v 为 nil 表示未开启 JWT，直接放行（沿用请求中的 user_id）。
+func RequireJWT(v *auth.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v == nil {
+			c.Next()
+			return
+		}
+		token := bearerToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "缺少登录令牌"})
+			return
+		}
+		claims, err := v.Verify(token)
+		if err != nil {
+			msg := "登录令牌无效"
+			if errors.Is(err, auth.ErrTokenExpired) {
+				msg = "登录令牌已过期"
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": msg})
+			return
+		}
+		c.Set(userIDContextKey, claims.UserID)
+		c.Next()
+	}
+}
+
+// UserID 返回 RequireJWT 校验得到的用户 ID；未开启 JWT 时返回 false。
+func UserID(c *gin.Context) (int64, bool) {
+	v, ok := c.Get(userIDContextKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(int64)
+	return id, ok
+}
+
+func bearerToken(c *gin.Context) string {
+	h := c.GetHeader("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return c.Query("access_token")
+}
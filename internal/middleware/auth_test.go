@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash_sale/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireJWT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const secret = "test-secret"
+	v, err := auth.NewVerifier([]string{secret}, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	valid, err := auth.SignHS256(secret, 10001, "", "", time.Minute)
+	if err != nil {
+		t.Fatalf("SignHS256: %v", err)
+	}
+	expired, err := auth.SignHS256(secret, 10001, "", "", -time.Minute)
+	if err != nil {
+		t.Fatalf("SignHS256: %v", err)
+	}
+	forged, err := auth.SignHS256("other-secret", 10001, "", "", time.Minute)
+	if err != nil {
+		t.Fatalf("SignHS256: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/me", RequireJWT(v), func(c *gin.Context) {
+		id, ok := UserID(c)
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"user_id": id, "ok": ok}})
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		auth     string
+		wantCode int
+		wantMsg  string
+	}{
+		{"missing token", "/me", "", http.StatusUnauthorized, "缺少登录令牌"},
+		{"forged token", "/me", "Bearer " + forged, http.StatusUnauthorized, "登录令牌无效"},
+		{"expired token", "/me", "Bearer " + expired, http.StatusUnauthorized, "登录令牌已过期"},
+		{"bearer header", "/me", "Bearer " + valid, http.StatusOK, ""},
+		{"lowercase scheme", "/me", "bearer " + valid, http.StatusOK, ""},
+		{"access_token query", "/me?access_token=" + valid, "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var resp struct {
+				Msg  string `json:"msg"`
+				Data struct {
+					UserID int64 `json:"user_id"`
+					OK     bool  `json:"ok"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode %q: %v", w.Body.String(), err)
+			}
+			if w.Code != tt.wantCode || resp.Msg != tt.wantMsg {
+				t.Fatalf("got %d %q, want %d %q", w.Code, resp.Msg, tt.wantCode, tt.wantMsg)
+			}
+			if tt.wantCode == http.StatusOK && (!resp.Data.OK || resp.Data.UserID != 10001) {
+				t.Fatalf("user = %+v, want 10001", resp.Data)
+			}
+		})
+	}
+}
+
+func TestRequireJWTDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", RequireJWT(nil), func(c *gin.Context) {
+		_, ok := UserID(c)
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"ok": ok}})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/me", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"code":0,"data":{"ok":false}}` {
+		t.Fatalf("got %d %s, want pass-through without user", w.Code, w.Body.String())
+	}
+}
@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,17 +15,23 @@ import (
 )
 
 // 该中间件用于购买接口的分布式限流。
-// 默认优先按 user_id 维度限流，解析失败则降级按 IP 限流。
+// 默认优先按 user_id 维度限流（开启 JWT 时取令牌中的用户，不读 body），解析失败则降级按 IP 限流。
 
 // luaRateLimit：Redis 滑动窗口限流 Lua 脚本（原子操作）
-// KEYS[1]=限流key，ARGV[1]=当前时间戳，ARGV[2]=窗口开始时间戳，ARGV[3]=窗口秒数
+// KEYS[1]=限流key，KEYS[2]=当前秒的入口流量计数，ARGV[1]=当前时间戳，ARGV[2]=窗口开始时间戳，ARGV[3]=窗口秒数
 // 返回：当前窗口内的请求数（如果 >= limit 则返回 -1 表示限流）
 const luaRateLimit = `
 local key = KEYS[1]
+local qpsKey = KEYS[2]
 local now = tonumber(ARGV[1])
 local windowStart = tonumber(ARGV[2])
 local windowSec = tonumber(ARGV[3])
 local member = ARGV[4]
+local qpsBucketTTL = tonumber(ARGV[6])
+
+-- 入口总流量按秒计数（含被限流的请求），供 CurrentQPS 读取
+redis.call('INCR', qpsKey)
+redis.call('EXPIRE', qpsKey, qpsBucketTTL)
 
 -- 删除窗口外的旧记录
 redis.call('ZREMRANGEBYSCORE', key, '0', windowStart)
@@ -44,11 +52,16 @@ end
 // RedisRateLimit Redis 分布式限流（Lua 原子操作 + 按 UserID）
 func RedisRateLimit(rdb *rd.Client, limit int, window time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从 body 解析 user_id（秒杀接口的 body 里有 user_id）
-		userID, err := extractUserID(c)
-		if err != nil || userID == 0 {
-			// 解析失败时降级：按 IP 限流（防止恶意请求）
-			userID = 0
+		// 已通过 JWT 校验时按令牌中的用户限流，轮换 body 中的 user_id 无法绕过。
+		userID, ok := UserID(c)
+		if !ok {
+			// 从 body 解析 user_id（秒杀接口的 body 里有 user_id）
+			var err error
+			userID, err = extractUserID(c)
+			if err != nil || userID == 0 {
+				// 解析失败时降级：按 IP 限流（防止恶意请求）
+				userID = 0
+			}
 		}
 
 		// 限流 key：按 user_id（如果解析成功）或 IP（降级）
@@ -65,8 +78,8 @@ func RedisRateLimit(rdb *rd.Client, limit int, window time.Duration) gin.Handler
 		member := fmt.Sprintf("%d-%d", now, time.Now().UnixNano())
 
 		// Lua 原子操作：删除旧记录 + 统计 + 添加 + 设置过期
-		res, err := rdb.Eval(c.Request.Context(), luaRateLimit, []string{key},
-			now, windowStart, windowSec, member, limit).Int()
+		res, err := rdb.Eval(c.Request.Context(), luaRateLimit, []string{key, qpsBucketKey(now)},
+			now, windowStart, windowSec, member, limit, qpsBucketTTL).Int()
 
 		if err != nil {
 			// Redis 异常时选择放行：不让基础设施故障拖垮业务入口。
@@ -85,17 +98,44 @@ func RedisRateLimit(rdb *rd.Client, limit int, window time.Duration) gin.Handler
 	}
 }
 
+// qpsBucketTTL 为入口流量秒级计数的保留秒数（需大于 CurrentQPS 的统计窗口）。
+const qpsBucketTTL = 30
+
+func qpsBucketKey(sec int64) string {
+	return fmt.Sprintf("rate_limit:flash_sale:qps:%d", sec)
+}
+
+// CurrentQPS 返回最近 seconds 个完整秒内经过限流入口的平均每秒请求数（含被限流的请求）。
+func CurrentQPS(ctx context.Context, rdb *rd.Client, seconds int) (float64, error) {
+	if seconds <= 0 || seconds >= qpsBucketTTL {
+		return 0, fmt.Errorf("qps window must be in (0, %d)", qpsBucketTTL)
+	}
+	now := time.Now().Unix()
+	keys := make([]string, 0, seconds)
+	for i := 1; i <= seconds; i++ {
+		keys = append(keys, qpsBucketKey(now-int64(i)))
+	}
+	vals, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, v := range vals {
+		if s, ok := v.(string); ok {
+			n, _ := strconv.ParseInt(s, 10, 64)
+			total += n
+		}
+	}
+	return float64(total) / float64(seconds), nil
+}
+
 // extractUserID 从请求 body 中解析 user_id（不消耗 body，可重复读）
 func extractUserID(c *gin.Context) (int64, error) {
-	// 读取 body
-	bodyBytes, err := io.ReadAll(c.Request.Body)
+	bodyBytes, err := readBody(c)
 	if err != nil {
 		return 0, err
 	}
 
-	// 重置 body，让后续 handler 能继续读
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
 	// 解析 JSON 取 user_id
 	var req struct {
 		UserID int64 `json:"user_id"`
@@ -105,3 +145,13 @@ func extractUserID(c *gin.Context) (int64, error) {
 	}
 	return req.UserID, nil
 }
+
+// readBody 读取请求 body 并重置，让后续中间件与 handler 能继续读。
+func readBody(c *gin.Context) ([]byte, error) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	return bodyBytes, nil
+}
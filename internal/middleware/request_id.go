@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"regexp"
+
+	"flash_sale/internal/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 调用方传入的请求 ID 只接受常见字符，避免把任意内容写进审计与日志。
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestID 沿用请求头 X-Request-Id（不合法时重新生成），回写到响应头，
+// 并写入请求上下文供审计事件关联。
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-Id")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Header("X-Request-Id", id)
+		c.Request = c.Request.WithContext(audit.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
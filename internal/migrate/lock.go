@@ -0,0 +1,110 @@
+package migrate
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"flash_sale/internal/storage"
+)
+
+const (
+	// lockStaleAfter 锁持有者超过该时长未续期视为已崩溃，允许其他实例接管。
+	lockStaleAfter = 2 * time.Minute
+	// lockRefreshInterval 持有期间的续期间隔，需明显小于 lockStaleAfter。
+	lockRefreshInterval = 30 * time.Second
+	// lockPollInterval 等待锁时的轮询间隔。
+	lockPollInterval = time.Second
+)
+
+// migrationLockID 锁表中唯一一行的主键，依赖主键唯一约束实现互斥（三种数据库通用）。
+const migrationLockID = 1
+
+type migrationLock struct {
+	ID       uint      `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string    `gorm:"size:128;not null"`
+	LockedAt time.Time `gorm:"not null"`
+}
+
+func (migrationLock) TableName() string { return "schema_migration_locks" }
+
+// withLock 获取迁移锁后执行 fn，期间定期续期；ctx 取消时放弃等待。
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+	if err := m.acquire(ctx); err != nil {
+		return err
+	}
+
+	refreshCtx, stopRefresh := context.WithCancel(ctx)
+	defer stopRefresh()
+	go m.refresh(refreshCtx)
+
+	defer func() {
+		// 使用独立 context：调用方 ctx 已取消时也要尽量释放锁，否则其他实例需等待锁过期。
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.db.WithContext(releaseCtx).
+			Where("id = ? AND owner = ?", migrationLockID, m.owner).
+			Delete(&migrationLock{}).Error; err != nil {
+			log.Printf("migrate release lock: %v", err)
+		}
+	}()
+	return fn()
+}
+
+// acquire 插入锁行抢占；主键冲突说明已被持有，若持有者已过期则条件更新接管，否则轮询等待。
+func (m *Migrator) acquire(ctx context.Context) error {
+	waiting := false
+	for {
+		err := m.db.WithContext(ctx).Create(&migrationLock{ID: migrationLockID, Owner: m.owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			return nil
+		}
+		if !storage.IsUniqueViolation(err) {
+			return err
+		}
+
+		now := time.Now()
+		res := m.db.WithContext(ctx).Model(&migrationLock{}).
+			Where("id = ? AND locked_at < ?", migrationLockID, now.Add(-lockStaleAfter)).
+			Updates(map[string]any{"owner": m.owner, "locked_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			log.Printf("migrate: took over stale lock")
+			return nil
+		}
+
+		if !waiting {
+			log.Printf("migrate: waiting for lock held by another instance")
+			waiting = true
+		}
+		t := time.NewTimer(lockPollInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (m *Migrator) refresh(ctx context.Context) {
+	ticker := time.NewTicker(lockRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := m.db.WithContext(ctx).Model(&migrationLock{}).
+			Where("id = ? AND owner = ?", migrationLockID, m.owner).
+			Update("locked_at", time.Now()).Error; err != nil && ctx.Err() == nil {
+			log.Printf("migrate refresh lock: %v", err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrIrreversible 表示迁移未提供 Down，无法回滚。
+var ErrIrreversible = errors.New("migration is irreversible")
+
+// Migration 为一次版本化的 schema 变更。
+// Up / Down 在同一事务内执行并同步写 schema_migrations；
+// MySQL 的 DDL 会隐式提交，失败时可能残留部分变更，迁移需写成可重复执行。
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil 表示不可回滚
+}
+
+// SchemaMigration 记录已执行的迁移版本。
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:128;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+// Status 为单个迁移的执行状态。
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator 按版本号顺序执行迁移；up/down 期间持有 schema_migration_locks 中的锁，多实例同时启动时只有一个执行。
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	owner      string
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+	list := append([]Migration(nil), migrations...)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			panic(fmt.Sprintf("migrate: duplicate migration version %d", list[i].Version))
+		}
+	}
+
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:         db,
+		migrations: list,
+		owner:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+	}
+}
+
+// Up 依次执行未应用的迁移，直到 target（0 表示最新版本），返回本次执行的迁移。
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mg := range m.migrations {
+			if target > 0 && mg.Version > target {
+				break
+			}
+			if _, ok := applied[mg.Version]; ok {
+				continue
+			}
+			if err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := mg.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: mg.Version, Name: mg.Name, AppliedAt: time.Now()}).Error
+			}); err != nil {
+				return fmt.Errorf("migration %d %s up: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 按版本号倒序回滚最近 steps 个已应用的迁移，返回本次回滚的迁移。
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func() error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mg := m.migrations[i]
+			if _, ok := applied[mg.Version]; !ok {
+				continue
+			}
+			if mg.Down == nil {
+				return fmt.Errorf("migration %d %s: %w", mg.Version, mg.Name, ErrIrreversible)
+			}
+			if err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				if err := mg.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, mg.Version).Error
+			}); err != nil {
+				return fmt.Errorf("migration %d %s down: %w", mg.Version, mg.Name, err)
+			}
+			done = append(done, mg)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status 列出全部迁移及其执行状态；DB 中存在但本程序未知的版本（由更新的版本写入）也会列出。
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Status, 0, len(m.migrations))
+	known := make(map[int64]bool, len(m.migrations))
+	for _, mg := range m.migrations {
+		known[mg.Version] = true
+		st := Status{Version: mg.Version, Name: mg.Name}
+		if row, ok := applied[mg.Version]; ok {
+			at := row.AppliedAt
+			st.Applied = true
+			st.AppliedAt = &at
+		}
+		out = append(out, st)
+	}
+	for v, row := range applied {
+		if !known[v] {
+			at := row.AppliedAt
+			out = append(out, Status{Version: v, Name: row.Name, Applied: true, AppliedAt: &at})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Pending 返回尚未应用的迁移数量。
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	list, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, st := range list {
+		if !st.Applied {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := m.db.WithContext(ctx).Order("version ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[int64]SchemaMigration, len(rows))
+	for _, r := range rows {
+		out[r.Version] = r
+	}
+	return out, nil
+}
+
+// ensureTables 创建迁移记录表与锁表。
+// 多实例可能同时建表，失败后若表已存在（被其他实例建好）则忽略。
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	db := m.db.WithContext(ctx)
+	if err := db.AutoMigrate(&SchemaMigration{}, &migrationLock{}); err != nil {
+		if db.Migrator().HasTable(&SchemaMigration{}) && db.Migrator().HasTable(&migrationLock{}) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
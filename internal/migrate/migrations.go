@@ -0,0 +1,435 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrations 为全部已发布的迁移，按版本号执行。
+// 已发布的迁移不可修改，schema 变更一律追加新版本。
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		Up:      baselineUp,
+		Down:    baselineDown,
+	},
+	{
+		Version: 2,
+		Name:    "drop_legacy_order_user_product_unique",
+		Up:      dropLegacyUserProductIndex,
+		// baseline 快照本身不含该索引，且多件购买的数据已不满足该约束，回滚时不重建。
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 3,
+		Name:    "lottery",
+		Up:      lotteryUp,
+		Down:    lotteryDown,
+	},
+	{
+		Version: 4,
+		Name:    "product_registration",
+		Up:      registrationUp,
+		Down:    registrationDown,
+	},
+	{
+		Version: 5,
+		Name:    "order_request_reason_code",
+		Up:      reasonCodeUp,
+		Down:    reasonCodeDown,
+	},
+	{
+		Version: 6,
+		Name:    "admin_api_keys",
+		Up:      adminKeysUp,
+		Down:    adminKeysDown,
+	},
+	{
+		Version: 7,
+		Name:    "audit_events",
+		Up:      auditEventsUp,
+		Down:    auditEventsDown,
+	},
+	{
+		Version: 8,
+		Name:    "audit_event_status",
+		Up:      auditStatusUp,
+		Down:    auditStatusDown,
+	},
+}
+
+// 以下为版本 1 时各表结构的快照。迁移不引用 internal/model，避免模型后续变更改写历史迁移。
+// 表名与列定义与之前 AutoMigrate 生成的一致：已由旧版本建表的库执行 baseline 时只会补齐缺失的列与索引。
+
+type v1Campaign struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Name      string    `gorm:"size:128;not null"`
+	StartTime time.Time `gorm:"not null;index"`
+	EndTime   time.Time `gorm:"not null;index"`
+	Status    int       `gorm:"not null;default:0;index"`
+	WarmedAt  *time.Time
+	EndedAt   *time.Time
+}
+
+func (v1Campaign) TableName() string { return "campaigns" }
+
+type v1Product struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Name         string    `gorm:"size:128;not null"`
+	Stock        int64     `gorm:"not null;default:0"`
+	SalePrice    int64     `gorm:"not null"`
+	StartTime    time.Time `gorm:"not null"`
+	EndTime      time.Time `gorm:"not null"`
+	PerUserLimit int       `gorm:"not null;default:1"`
+	CampaignID   *uint     `gorm:"index"`
+}
+
+func (v1Product) TableName() string { return "products" }
+
+type v1SKU struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	ProductID uint   `gorm:"not null;index"`
+	Name      string `gorm:"size:128;not null"`
+	Stock     int64  `gorm:"not null;default:0"`
+	SalePrice int64  `gorm:"not null"`
+}
+
+func (v1SKU) TableName() string { return "skus" }
+
+type v1Order struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	OrderNo   string `gorm:"size:64;uniqueIndex;not null"`
+	UserID    int64  `gorm:"not null;index;index:idx_order_user_product,priority:1"`
+	ProductID uint   `gorm:"not null;index;index:idx_order_user_product,priority:2"`
+	SKUID     uint   `gorm:"column:sku_id;not null;default:0;index"`
+	Quantity  int    `gorm:"not null;default:1"`
+	Amount    int64  `gorm:"not null"`
+	Status    int    `gorm:"not null;default:0;index"`
+	RequestID string `gorm:"size:64;uniqueIndex;not null"`
+
+	Version       int64 `gorm:"not null;default:0"`
+	PaidAt        *time.Time
+	CancelledAt   *time.Time
+	ExpireAt      *time.Time `gorm:"index"`
+	StockReleased bool       `gorm:"not null;default:false;index"`
+}
+
+func (v1Order) TableName() string { return "orders" }
+
+type v1OrderTransition struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	OrderID    uint   `gorm:"not null;index"`
+	OrderNo    string `gorm:"size:64;not null;index"`
+	FromStatus int    `gorm:"not null"`
+	ToStatus   int    `gorm:"not null"`
+	Version    int64  `gorm:"not null"`
+	Operator   string `gorm:"size:64"`
+	Reason     string `gorm:"size:255"`
+}
+
+func (v1OrderTransition) TableName() string { return "order_transitions" }
+
+type v1OrderRequest struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	RequestID string `gorm:"size:64;uniqueIndex;not null"`
+	UserID    int64  `gorm:"not null;index"`
+	ProductID uint   `gorm:"not null;index"`
+	SKUID     uint   `gorm:"column:sku_id;not null;default:0"`
+	Quantity  int    `gorm:"not null;default:1"`
+	Amount    int64  `gorm:"not null"`
+	Status    int    `gorm:"not null;default:0;index"`
+	OrderNo   string `gorm:"size:64;index"`
+	ErrorMsg  string `gorm:"size:255"`
+}
+
+func (v1OrderRequest) TableName() string { return "order_requests" }
+
+type v1UserPurchase struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	UserID    int64 `gorm:"not null;uniqueIndex:idx_user_purchase,priority:1"`
+	ProductID uint  `gorm:"not null;uniqueIndex:idx_user_purchase,priority:2"`
+	Quantity  int   `gorm:"not null;default:0"`
+}
+
+func (v1UserPurchase) TableName() string { return "user_purchases" }
+
+func baselineTables() []any {
+	return []any{&v1Campaign{}, &v1Product{}, &v1SKU{}, &v1Order{}, &v1OrderRequest{}, &v1OrderTransition{}, &v1UserPurchase{}}
+}
+
+func baselineUp(tx *gorm.DB) error {
+	return tx.Migrator().AutoMigrate(baselineTables()...)
+}
+
+func baselineDown(tx *gorm.DB) error {
+	tables := baselineTables()
+	// 倒序删除，先删引用方。
+	for i, j := 0, len(tables)-1; i < j; i, j = i+1, j-1 {
+		tables[i], tables[j] = tables[j], tables[i]
+	}
+	return tx.Migrator().DropTable(tables...)
+}
+
+// dropLegacyUserProductIndex 删除早期版本一人一单的 orders(user_id, product_id) 唯一索引，限购改由 user_purchases 保证。
+func dropLegacyUserProductIndex(tx *gorm.DB) error {
+	if !tx.Migrator().HasIndex(&v1Order{}, "idx_user_product") {
+		return nil
+	}
+	return tx.Migrator().DropIndex(&v1Order{}, "idx_user_product")
+}
+
+// 版本 3：抽签发售。
+
+type v3Product struct {
+	ID       uint   `gorm:"primarykey"`
+	SaleMode string `gorm:"size:16;not null;default:'fcfs'"`
+}
+
+func (v3Product) TableName() string { return "products" }
+
+type v3Lottery struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	ProductID      uint      `gorm:"not null;uniqueIndex"`
+	RegisterStart  time.Time `gorm:"not null"`
+	RegisterEnd    time.Time `gorm:"not null"`
+	DrawAt         time.Time `gorm:"not null;index"`
+	Status         int       `gorm:"not null;default:0;index"`
+	Seed           string    `gorm:"size:64;not null"`
+	SeedCommitment string    `gorm:"size:64;not null"`
+	EntryCount     int       `gorm:"not null;default:0"`
+	Winners        int       `gorm:"not null;default:0"`
+	DrawnAt        *time.Time
+	DispatchedAt   *time.Time
+}
+
+func (v3Lottery) TableName() string { return "lotteries" }
+
+type v3LotteryEntry struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	LotteryID uint   `gorm:"not null;uniqueIndex:idx_lottery_user,priority:1"`
+	UserID    int64  `gorm:"not null;uniqueIndex:idx_lottery_user,priority:2"`
+	RequestID string `gorm:"size:64;uniqueIndex;not null"`
+	Selected  bool   `gorm:"not null;default:false"`
+}
+
+func (v3LotteryEntry) TableName() string { return "lottery_entries" }
+
+func lotteryUp(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&v3Product{}, "SaleMode") {
+		if err := tx.Migrator().AddColumn(&v3Product{}, "SaleMode"); err != nil {
+			return err
+		}
+	}
+	return tx.Migrator().AutoMigrate(&v3Lottery{}, &v3LotteryEntry{})
+}
+
+func lotteryDown(tx *gorm.DB) error {
+	if err := tx.Migrator().DropTable(&v3LotteryEntry{}, &v3Lottery{}); err != nil {
+		return err
+	}
+	if tx.Migrator().HasColumn(&v3Product{}, "SaleMode") {
+		return dropColumn(tx, "products", "sale_mode")
+	}
+	return nil
+}
+
+// 版本 4：开售前预约。
+
+type v4Product struct {
+	ID                  uint `gorm:"primarykey"`
+	RequireRegistration bool `gorm:"not null;default:false"`
+}
+
+func (v4Product) TableName() string { return "products" }
+
+type v4Registration struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+
+	ProductID uint  `gorm:"not null;uniqueIndex:idx_registration_product_user,priority:1"`
+	UserID    int64 `gorm:"not null;uniqueIndex:idx_registration_product_user,priority:2"`
+}
+
+func (v4Registration) TableName() string { return "product_registrations" }
+
+func registrationUp(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&v4Product{}, "RequireRegistration") {
+		if err := tx.Migrator().AddColumn(&v4Product{}, "RequireRegistration"); err != nil {
+			return err
+		}
+	}
+	return tx.Migrator().AutoMigrate(&v4Registration{})
+}
+
+func registrationDown(tx *gorm.DB) error {
+	if err := tx.Migrator().DropTable(&v4Registration{}); err != nil {
+		return err
+	}
+	if tx.Migrator().HasColumn(&v4Product{}, "RequireRegistration") {
+		return dropColumn(tx, "products", "require_registration")
+	}
+	return nil
+}
+
+// 版本 5：风控拒绝原因码。
+
+type v5OrderRequest struct {
+	ID         uint   `gorm:"primarykey"`
+	ReasonCode string `gorm:"size:64;index"`
+}
+
+func (v5OrderRequest) TableName() string { return "order_requests" }
+
+func reasonCodeUp(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&v5OrderRequest{}, "ReasonCode") {
+		if err := tx.Migrator().AddColumn(&v5OrderRequest{}, "ReasonCode"); err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasIndex(&v5OrderRequest{}, "ReasonCode") {
+		return tx.Migrator().CreateIndex(&v5OrderRequest{}, "ReasonCode")
+	}
+	return nil
+}
+
+func reasonCodeDown(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(&v5OrderRequest{}, "ReasonCode") {
+		if err := tx.Migrator().DropIndex(&v5OrderRequest{}, "ReasonCode"); err != nil {
+			return err
+		}
+	}
+	if tx.Migrator().HasColumn(&v5OrderRequest{}, "ReasonCode") {
+		return dropColumn(tx, "order_requests", "reason_code")
+	}
+	return nil
+}
+
+// 版本 6：管理接口 API 密钥。
+
+type v6AdminKey struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name          string `gorm:"size:64;not null"`
+	Prefix        string `gorm:"size:16;not null;uniqueIndex"`
+	KeyHash       string `gorm:"size:64;not null"`
+	Role          string `gorm:"size:16;not null"`
+	Scopes        string `gorm:"size:512;not null;default:''"`
+	ExpiresAt     *time.Time
+	RevokedAt     *time.Time `gorm:"index"`
+	LastUsedAt    *time.Time
+	RotatedFromID *uint
+}
+
+func (v6AdminKey) TableName() string { return "admin_api_keys" }
+
+func adminKeysUp(tx *gorm.DB) error {
+	return tx.Migrator().AutoMigrate(&v6AdminKey{})
+}
+
+func adminKeysDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&v6AdminKey{})
+}
+
+// 版本 7：审计事件（只追加）。
+
+type v7AuditEvent struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `gorm:"index"`
+	Actor       string    `gorm:"size:64;not null;index"`
+	Action      string    `gorm:"size:64;not null;index"`
+	TargetType  string    `gorm:"size:32;not null;index:idx_audit_events_target"`
+	TargetID    string    `gorm:"size:128;not null;index:idx_audit_events_target"`
+	ProductID   uint      `gorm:"index"`
+	SKUID       uint      `gorm:"column:sku_id"`
+	StockBefore *int64
+	StockAfter  *int64
+	RequestID   string  `gorm:"size:64;index"`
+	Detail      string  `gorm:"type:text"`
+	DedupKey    *string `gorm:"size:128;uniqueIndex"`
+}
+
+func (v7AuditEvent) TableName() string { return "audit_events" }
+
+func auditEventsUp(tx *gorm.DB) error {
+	return tx.Migrator().AutoMigrate(&v7AuditEvent{})
+}
+
+func auditEventsDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&v7AuditEvent{})
+}
+
+// 版本 8：审计事件状态。先记事件、后执行的操作以 pending 写入，已有事件均为已生效。
+
+type v8AuditEvent struct {
+	ID     uint   `gorm:"primarykey"`
+	Status string `gorm:"size:16;not null;default:applied;index"`
+}
+
+func (v8AuditEvent) TableName() string { return "audit_events" }
+
+func auditStatusUp(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&v8AuditEvent{}, "Status") {
+		if err := tx.Migrator().AddColumn(&v8AuditEvent{}, "Status"); err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasIndex(&v8AuditEvent{}, "Status") {
+		return tx.Migrator().CreateIndex(&v8AuditEvent{}, "Status")
+	}
+	return nil
+}
+
+func auditStatusDown(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(&v8AuditEvent{}, "Status") {
+		if err := tx.Migrator().DropIndex(&v8AuditEvent{}, "Status"); err != nil {
+			return err
+		}
+	}
+	if tx.Migrator().HasColumn(&v8AuditEvent{}, "Status") {
+		return dropColumn(tx, "audit_events", "status")
+	}
+	return nil
+}
+
+// dropColumn 删除列。SQLite 下 GORM 的 DropColumn 通过重建表实现，会丢失表上其余索引（包括唯一索引），
+// 因此统一使用 ALTER TABLE ... DROP COLUMN（SQLite 3.35+ 支持）；该列上的索引需先删除。
+func dropColumn(tx *gorm.DB, table, column string) error {
+	return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: column}).Error
+}
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// AdminKey 为管理接口的 API 密钥。明文只在创建 / 轮换时返回一次，库中只存 SHA-256 摘要；
+// Prefix 为明文前缀（可公开展示），用于定位密钥与日志排查。
+type AdminKey struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name    string `gorm:"size:64;not null" json:"name"`
+	Prefix  string `gorm:"size:16;not null;uniqueIndex" json:"prefix"`
+	KeyHash string `gorm:"size:64;not null" json:"-"`
+	// Role 为 viewer / operator / admin；Scopes 为逗号分隔的权限子集，为空表示角色的全部权限。
+	Role   string `gorm:"size:16;not null" json:"role"`
+	Scopes string `gorm:"size:512;not null;default:''" json:"scopes"`
+
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// RotatedFromID 为轮换前的旧密钥。
+	RotatedFromID *uint `json:"rotated_from_id,omitempty"`
+}
+
+func (AdminKey) TableName() string { return "admin_api_keys" }
+
+// Active 判断密钥在 now 时刻是否可用（未吊销且未过期）。
+func (k AdminKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
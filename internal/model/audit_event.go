@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// 审计事件状态。无法与 DB 同事务的操作（Redis / Broker）先以 pending 写入事件再执行，执行后标记为
+// applied、failed（操作返回错误，网络错误时可能已生效，需核对）或 skipped（无需改动，如库存键已存在）；
+// 与 DB 同事务的事件直接为 applied。
+const (
+	AuditStatusPending = "pending"
+	AuditStatusApplied = "applied"
+	AuditStatusFailed  = "failed"
+	AuditStatusSkipped = "skipped"
+)
+
+// AuditEvent 为管理操作与库存变更的审计事件。表只追加：除 pending 事件执行后的结果（状态、改动前库存、附加信息）外，代码中不提供修改与删除。
+type AuditEvent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	// Actor 为操作者：admin_key:<密钥前缀>、user:<用户ID>、cli:<命令>、system:<后台任务>。
+	Actor  string `gorm:"size:64;not null;index" json:"actor"`
+	Action string `gorm:"size:64;not null;index" json:"action"`
+	// TargetType / TargetID 为操作对象，如 product / 12、admin_key / 3、request / <request_id>。
+	TargetType string `gorm:"size:32;not null;index:idx_audit_events_target" json:"target_type"`
+	TargetID   string `gorm:"size:128;not null;index:idx_audit_events_target" json:"target_id"`
+
+	// 库存类事件的库存单元（SKUID=0 为商品级库存）与变更前后的库存，不涉及库存或无法得知时为 nil。
+	ProductID   uint   `gorm:"index" json:"product_id,omitempty"`
+	SKUID       uint   `gorm:"column:sku_id" json:"sku_id,omitempty"`
+	StockBefore *int64 `json:"stock_before"`
+	StockAfter  *int64 `json:"stock_after"`
+
+	// RequestID 库存回补为下单请求的 request_id，管理操作为 HTTP 请求的 X-Request-Id。
+	RequestID string         `gorm:"size:64;index" json:"request_id"`
+	Status    string         `gorm:"size:16;not null;default:applied;index" json:"status"`
+	Detail    map[string]any `gorm:"type:text;serializer:json" json:"detail,omitempty"`
+	// DedupKey 非空时唯一：可重试的写入（如库存回补）重复写入时忽略。
+	DedupKey *string `gorm:"size:128;uniqueIndex" json:"-"`
+}
+
+func (AuditEvent) TableName() string { return "audit_events" }
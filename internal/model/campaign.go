@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CampaignStatus 描述活动生命周期：待预热 -> 已预热 -> 进行中 -> 已结束。
+type CampaignStatus int
+
+const (
+	CampaignScheduled CampaignStatus = iota // 已创建，等待预热
+	CampaignWarmed                          // Redis 库存已预热，等待开始
+	CampaignLive                            // 进行中，库存冻结
+	CampaignEnded                           // 已结束，Redis 库存键已清理
+)
+
+// String 返回状态的可读名称，便于接口输出与日志。
+func (s CampaignStatus) String() string {
+	switch s {
+	case CampaignScheduled:
+		return "scheduled"
+	case CampaignWarmed:
+		return "warmed"
+	case CampaignLive:
+		return "live"
+	case CampaignEnded:
+		return "ended"
+	default:
+		return "unknown"
+	}
+}
+
+// Campaign 秒杀活动：一组商品共享同一时间窗，由调度器统一预热与清理 Redis 库存。
+type Campaign struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Name      string         `gorm:"size:128;not null" json:"name"`
+	StartTime time.Time      `gorm:"not null;index" json:"start_time"`
+	EndTime   time.Time      `gorm:"not null;index" json:"end_time"`
+	Status    CampaignStatus `gorm:"not null;default:0;index" json:"status"` // 0 待预热 1 已预热 2 进行中 3 已结束
+	WarmedAt  *time.Time     `json:"warmed_at,omitempty"`
+	EndedAt   *time.Time     `json:"ended_at,omitempty"`
+
+	Products []Product `gorm:"foreignKey:CampaignID" json:"products,omitempty"`
+}
+
+func (Campaign) TableName() string { return "campaigns" }
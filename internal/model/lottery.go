@@ -0,0 +1,74 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 商品发售方式。
+const (
+	SaleModeFCFS    = "fcfs"    // 先到先得（默认），走 /buy
+	SaleModeLottery = "lottery" // 抽签发售，报名后统一开奖
+)
+
+// LotteryStatus 描述抽签生命周期：报名中 -> 已开奖 -> 中签请求已投递。
+type LotteryStatus int
+
+const (
+	LotteryOpen       LotteryStatus = iota // 报名中 / 等待开奖
+	LotteryDrawn                           // 已开奖，中签请求待写入下单链路
+	LotteryDispatched                      // 中签请求已写入 outbox，落选结果已同步
+)
+
+// String 返回状态的可读名称，便于接口输出与日志。
+func (s LotteryStatus) String() string {
+	switch s {
+	case LotteryOpen:
+		return "open"
+	case LotteryDrawn:
+		return "drawn"
+	case LotteryDispatched:
+		return "dispatched"
+	default:
+		return "unknown"
+	}
+}
+
+// Lottery 商品的抽签发售：报名窗口内登记，开奖时以预先承诺的种子确定性地抽取中签者（数量为商品库存）。
+type Lottery struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ProductID     uint          `gorm:"not null;uniqueIndex" json:"product_id"`
+	RegisterStart time.Time     `gorm:"not null" json:"register_start"`
+	RegisterEnd   time.Time     `gorm:"not null" json:"register_end"`
+	DrawAt        time.Time     `gorm:"not null;index" json:"draw_at"`
+	Status        LotteryStatus `gorm:"not null;default:0;index" json:"status"` // 0 报名中 1 已开奖 2 已投递
+	// Seed 开奖种子，开奖前保密；SeedCommitment = hex(sha256(Seed)) 创建时即公布，开奖后可校验种子未被替换。
+	Seed           string `gorm:"size:64;not null" json:"-"`
+	SeedCommitment string `gorm:"size:64;not null" json:"seed_commitment"`
+	// EntryCount / Winners 在开奖时写入。
+	EntryCount   int        `gorm:"not null;default:0" json:"entry_count"`
+	Winners      int        `gorm:"not null;default:0" json:"winners"`
+	DrawnAt      *time.Time `json:"drawn_at,omitempty"`
+	DispatchedAt *time.Time `json:"dispatched_at,omitempty"`
+}
+
+func (Lottery) TableName() string { return "lotteries" }
+
+// LotteryEntry 抽签报名记录，每人每场一条；RequestID 即该用户在 /result 查询的请求号。
+type LotteryEntry struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	LotteryID uint   `gorm:"not null;uniqueIndex:idx_lottery_user,priority:1" json:"lottery_id"`
+	UserID    int64  `gorm:"not null;uniqueIndex:idx_lottery_user,priority:2" json:"user_id"`
+	RequestID string `gorm:"size:64;uniqueIndex;not null" json:"request_id"`
+	Selected  bool   `gorm:"not null;default:false" json:"selected"`
+}
+
+func (LotteryEntry) TableName() string { return "lottery_entries" }
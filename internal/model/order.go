@@ -6,6 +6,34 @@ import (
 	"gorm.io/gorm"
 )
 
+// OrderStatus 描述订单支付状态机：待支付 -> 已支付 / 已取消。
+type OrderStatus int
+
+const (
+	OrderStatusPendingPayment OrderStatus = iota // 待支付（建单初始态）
+	OrderStatusPaid                              // 已支付（终态）
+	OrderStatusCancelled                         // 已取消（终态）
+)
+
+// String 返回状态的可读名称，便于接口输出与日志。
+func (s OrderStatus) String() string {
+	switch s {
+	case OrderStatusPendingPayment:
+		return "pending_payment"
+	case OrderStatusPaid:
+		return "paid"
+	case OrderStatusCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// CanTransitionTo 只允许 待支付 -> 已支付 / 待支付 -> 已取消。
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	return s == OrderStatusPendingPayment && (to == OrderStatusPaid || to == OrderStatusCancelled)
+}
+
 // Order 秒杀订单
 type Order struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
@@ -14,14 +42,41 @@ type Order struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
 	OrderNo string `gorm:"size:64;uniqueIndex;not null" json:"order_no"`
-	// (user_id, product_id) 唯一索引用于 DB 兜底一人一单。
-	UserID    int64  `gorm:"not null;index;uniqueIndex:idx_user_product,priority:1" json:"user_id"`
-	ProductID uint   `gorm:"not null;index;uniqueIndex:idx_user_product,priority:2" json:"product_id"`
-	Quantity  int    `gorm:"not null;default:1" json:"quantity"`
-	Amount    int64  `gorm:"not null" json:"amount"`           // 总金额，单位分
-	Status    int    `gorm:"not null;default:0" json:"status"` // 0 待支付 1 已支付 2 已取消
-	RequestID string `gorm:"size:64;uniqueIndex;not null" json:"request_id"`
+	// 每人限购由 user_purchases 累计数量兜底，此处仅为普通联合索引。
+	UserID    int64       `gorm:"not null;index;index:idx_order_user_product,priority:1" json:"user_id"`
+	ProductID uint        `gorm:"not null;index;index:idx_order_user_product,priority:2" json:"product_id"`
+	SKUID     uint        `gorm:"column:sku_id;not null;default:0;index" json:"sku_id"` // 0 表示商品无 SKU
+	Quantity  int         `gorm:"not null;default:1" json:"quantity"`
+	Amount    int64       `gorm:"not null" json:"amount"`                 // 总金额，单位分
+	Status    OrderStatus `gorm:"not null;default:0;index" json:"status"` // 0 待支付 1 已支付 2 已取消
+	RequestID string      `gorm:"size:64;uniqueIndex;not null" json:"request_id"`
+
+	// Version 乐观锁版本号：状态流转时 WHERE version=? 并自增，防止并发覆盖。
+	Version     int64      `gorm:"not null;default:0" json:"version"`
+	PaidAt      *time.Time `json:"paid_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	// ExpireAt 支付截止时间，超时未支付由后台任务自动取消。
+	ExpireAt *time.Time `gorm:"index" json:"expire_at,omitempty"`
+	// StockReleased 标记取消后 Redis 库存/占位锁是否已归还，重启后据此补做，避免漏补或重复补。
+	StockReleased bool `gorm:"not null;default:false;index" json:"stock_released"`
 }
 
 // 显式实现结构，确定表名
 func (Order) TableName() string { return "orders" }
+
+// OrderTransition 记录订单每一次状态流转，只追加不修改。
+type OrderTransition struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	OrderID    uint        `gorm:"not null;index" json:"order_id"`
+	OrderNo    string      `gorm:"size:64;not null;index" json:"order_no"`
+	FromStatus OrderStatus `gorm:"not null" json:"from_status"`
+	ToStatus   OrderStatus `gorm:"not null" json:"to_status"`
+	// Version 为流转后的订单版本号，与 orders.version 对应。
+	Version  int64  `gorm:"not null" json:"version"`
+	Operator string `gorm:"size:64" json:"operator"` // user:<id> / system
+	Reason   string `gorm:"size:255" json:"reason"`
+}
+
+func (OrderTransition) TableName() string { return "order_transitions" }
@@ -10,9 +10,12 @@ import (
 type OrderRequestStatus int
 
 const (
-	OrderRequestPending OrderRequestStatus = iota // 已扣库存、待消费
-	OrderRequestSuccess                           // 消费成功，订单已创建
-	OrderRequestFailed                            // 消费失败，已标记失败
+	OrderRequestPending     OrderRequestStatus = iota // 已扣库存、待消费
+	OrderRequestSuccess                               // 消费成功，订单已创建
+	OrderRequestFailed                                // 消费失败，已标记失败
+	OrderRequestNotSelected                           // 抽签落选（终态）
+	OrderRequestRegistered                            // 抽签已报名，等待开奖（开奖后转为 pending 或落选）
+	OrderRequestDenied                                // 风控拒绝（终态，未扣库存）
 )
 
 // OrderRequest tracks async order creation state for queryability and retries.
@@ -25,12 +28,15 @@ type OrderRequest struct {
 	RequestID string `gorm:"size:64;uniqueIndex;not null" json:"request_id"`
 	UserID    int64  `gorm:"not null;index" json:"user_id"`
 	ProductID uint   `gorm:"not null;index" json:"product_id"`
+	SKUID     uint   `gorm:"column:sku_id;not null;default:0" json:"sku_id"`
 	Quantity  int    `gorm:"not null;default:1" json:"quantity"`
 	Amount    int64  `gorm:"not null" json:"amount"`
 	// Status + ErrorMsg 支撑接口可观测与失败排查。
 	Status   OrderRequestStatus `gorm:"not null;default:0;index" json:"status"`
 	OrderNo  string             `gorm:"size:64;index" json:"order_no"`
 	ErrorMsg string             `gorm:"size:255" json:"error_msg"`
+	// ReasonCode 为风控拒绝原因码（如 blacklist_user、risk_deny），仅 denied 状态有值。
+	ReasonCode string `gorm:"size:64;index" json:"reason_code"`
 }
 
 func (OrderRequest) TableName() string { return "order_requests" }
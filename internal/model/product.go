@@ -19,6 +19,17 @@ type Product struct {
 	SalePrice int64     `gorm:"not null" json:"sale_price"` // 单位：分
 	StartTime time.Time `gorm:"not null" json:"start_time"`
 	EndTime   time.Time `gorm:"not null" json:"end_time"`
+	// PerUserLimit 每人累计限购件数（含多次下单），默认 1 即一人一件。
+	PerUserLimit int `gorm:"not null;default:1" json:"per_user_limit"`
+	// SaleMode 发售方式：fcfs 先到先得，lottery 抽签（不可走 /buy）。
+	SaleMode string `gorm:"size:16;not null;default:'fcfs'" json:"sale_mode"`
+	// RequireRegistration 为 true 时只有开售前预约过的用户可以下单。
+	RequireRegistration bool `gorm:"not null;default:false" json:"require_registration"`
+	// CampaignID 所属活动；纳入活动后时间窗与活动一致，库存由活动调度器预热/清理。
+	CampaignID *uint `gorm:"index" json:"campaign_id,omitempty"`
+
+	// SKUs 商品规格；有 SKU 时库存与价格以 SKU 为准，Stock/SalePrice 仅作汇总展示（总库存/最低价）。
+	SKUs []SKU `gorm:"foreignKey:ProductID" json:"skus,omitempty"`
 }
 
 func (Product) TableName() string { return "products" }
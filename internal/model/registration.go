@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// Registration 商品开售前的预约记录，每人每个商品一条。
+// 商品开启 RequireRegistration 时，只有预约过的用户才能参与秒杀。
+type Registration struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	ProductID uint  `gorm:"not null;uniqueIndex:idx_registration_product_user,priority:1" json:"product_id"`
+	UserID    int64 `gorm:"not null;uniqueIndex:idx_registration_product_user,priority:2" json:"user_id"`
+}
+
+func (Registration) TableName() string { return "product_registrations" }
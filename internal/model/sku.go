@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SKU 商品规格（颜色/尺码等）：每个 SKU 独立库存、独立秒杀价。
+// 商品下没有 SKU 时沿用 Product 自身的 Stock/SalePrice（sku_id = 0）。
+type SKU struct {
+	ID        uint           `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	ProductID uint   `gorm:"not null;index" json:"product_id"`
+	Name      string `gorm:"size:128;not null" json:"name"` // 规格描述，如 "黑色 / 256G"
+	// Stock 表示初始库存（来源于 DB）；秒杀实时扣减走 Redis。
+	Stock     int64 `gorm:"not null;default:0" json:"stock"`
+	SalePrice int64 `gorm:"not null" json:"sale_price"` // 单位：分
+}
+
+func (SKU) TableName() string { return "skus" }
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// UserPurchase 记录用户在某商品上累计占用的购买数量，是 DB 层的每人限购兜底。
+// (user_id, product_id) 唯一，建单时行锁后累加，取消订单时扣回。
+type UserPurchase struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID    int64 `gorm:"not null;uniqueIndex:idx_user_purchase,priority:1" json:"user_id"`
+	ProductID uint  `gorm:"not null;uniqueIndex:idx_user_purchase,priority:2" json:"product_id"`
+	Quantity  int   `gorm:"not null;default:0" json:"quantity"`
+}
+
+func (UserPurchase) TableName() string { return "user_purchases" }
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// ResultHub 将 Redis 上的请求终态事件分发给本实例内等待该 request_id 的连接。
+// 每个实例只持有一个 pub/sub 订阅，避免每个 SSE / WebSocket 连接各占一条 Redis 连接。
+// pub/sub 为至多一次投递（断线期间的事件会丢失），调用方需定期回查状态兜底。
+type ResultHub struct {
+	rdb *rd.Client
+
+	mu      sync.Mutex
+	waiters map[string]map[chan rediskey.RequestState]struct{}
+}
+
+func NewResultHub(rdb *rd.Client) *ResultHub {
+	return &ResultHub{
+		rdb:     rdb,
+		waiters: make(map[string]map[chan rediskey.RequestState]struct{}),
+	}
+}
+
+// Subscribe 登记对 requestID 终态的等待，返回的 channel 最多收到一次事件；调用方结束时必须调用 cancel。
+func (h *ResultHub) Subscribe(requestID string) (<-chan rediskey.RequestState, func()) {
+	ch := make(chan rediskey.RequestState, 1)
+
+	h.mu.Lock()
+	set, ok := h.waiters[requestID]
+	if !ok {
+		set = make(map[chan rediskey.RequestState]struct{})
+		h.waiters[requestID] = set
+	}
+	set[ch] = struct{}{}
+	h.mu.Unlock()
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if set, ok := h.waiters[requestID]; ok {
+			delete(set, ch)
+			if len(set) == 0 {
+				delete(h.waiters, requestID)
+			}
+		}
+	}
+	return ch, cancel
+}
+
+// Run 订阅终态事件频道并分发，直到 ctx 取消；订阅异常时退避重建。
+func (h *ResultHub) Run(ctx context.Context) {
+	for {
+		if err := h.listen(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("result hub: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (h *ResultHub) listen(ctx context.Context) error {
+	pubsub := h.rdb.Subscribe(ctx, rediskey.RequestEventsChannel())
+	defer pubsub.Close()
+	// 等待订阅确认，连接失败时尽早返回重试。
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var state rediskey.RequestState
+			if err := json.Unmarshal([]byte(m.Payload), &state); err != nil || state.RequestID == "" {
+				log.Printf("result hub: invalid event %q", m.Payload)
+				continue
+			}
+			h.dispatch(state)
+		}
+	}
+}
+
+func (h *ResultHub) dispatch(state rediskey.RequestState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.waiters[state.RequestID] {
+		// 缓冲为 1 且终态只有一个，非阻塞发送即可。
+		select {
+		case ch <- state:
+		default:
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// ExpiryWorker 周期性取消超时未支付订单，并归还 Redis 库存与限购额度。
+// 重启安全：取消走乐观锁状态机，归还以 orders.stock_released 为准补做，
+// 库存回补本身按 request_id 幂等，因此不会重复回补。
+type ExpiryWorker struct {
+	db  *gorm.DB
+	rdb *rd.Client
+
+	interval  time.Duration
+	batchSize int
+}
+
+func NewExpiryWorker(db *gorm.DB, rdb *rd.Client, interval time.Duration, batchSize int) *ExpiryWorker {
+	return &ExpiryWorker{
+		db:        db,
+		rdb:       rdb,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (w *ExpiryWorker) Run(ctx context.Context) {
+	ctx = audit.WithActor(ctx, "system:expiry")
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ExpiryWorker) runOnce(ctx context.Context) {
+	if err := w.cancelExpired(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("order expiry cancel: %v", err)
+	}
+	// 先取消再归还：本轮刚取消的订单也会在同一轮完成回补。
+	if err := w.releaseCancelled(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("order expiry release: %v", err)
+	}
+}
+
+// cancelExpired 将超过 expire_at 仍待支付的订单流转为已取消。
+func (w *ExpiryWorker) cancelExpired(ctx context.Context) error {
+	var list []model.Order
+	if err := w.db.WithContext(ctx).
+		Where("status = ? AND expire_at IS NOT NULL AND expire_at < ?", model.OrderStatusPendingPayment, time.Now()).
+		Order("id ASC").
+		Limit(w.batchSize).
+		Find(&list).Error; err != nil {
+		return err
+	}
+
+	for _, o := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := Cancel(w.db, o.OrderNo, 0, "payment_timeout"); err != nil {
+			// 并发下已被支付/取消属于正常竞争，跳过即可。
+			if errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrVersionConflict) {
+				continue
+			}
+			log.Printf("order expiry cancel order_no=%s: %v", o.OrderNo, err)
+		}
+	}
+	return nil
+}
+
+// releaseCancelled 为已取消但尚未归还预占的订单补做 Redis 回补。
+func (w *ExpiryWorker) releaseCancelled(ctx context.Context) error {
+	var list []model.Order
+	if err := w.db.WithContext(ctx).
+		Where("status = ? AND stock_released = ?", model.OrderStatusCancelled, false).
+		Order("id ASC").
+		Limit(w.batchSize).
+		Find(&list).Error; err != nil {
+		return err
+	}
+
+	for _, o := range list {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := ReleaseReservation(ctx, w.db, w.rdb, o); err != nil {
+			log.Printf("order expiry release order_no=%s: %v", o.OrderNo, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrderNotFound 表示 order_no 不存在。
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrNotOwner 表示操作人不是订单所属用户。
+	ErrNotOwner = errors.New("order does not belong to user")
+	// ErrInvalidTransition 表示当前状态不允许流转到目标状态。
+	ErrInvalidTransition = errors.New("invalid order status transition")
+	// ErrVersionConflict 表示多次重试后仍被并发更新抢先。
+	ErrVersionConflict = errors.New("order version conflict")
+	// ErrOrderExpired 表示订单已过支付截止时间，不再允许支付。
+	ErrOrderExpired = errors.New("order payment window expired")
+)
+
+// maxTransitionAttempts 乐观锁冲突时的最大重试次数。
+const maxTransitionAttempts = 3
+
+// SystemOperator 表示由后台任务（而非用户）触发的流转。
+const SystemOperator = "system"
+
+// Pay 将订单从待支付流转为已支付。userID 必须与订单所属用户一致。
+func Pay(db *gorm.DB, orderNo string, userID int64) (model.Order, error) {
+	return Transition(db, orderNo, userID, model.OrderStatusPaid, "paid")
+}
+
+// Cancel 将订单从待支付流转为已取消。userID=0 表示系统取消（不校验归属）。
+func Cancel(db *gorm.DB, orderNo string, userID int64, reason string) (model.Order, error) {
+	return Transition(db, orderNo, userID, model.OrderStatusCancelled, reason)
+}
+
+// Transition 在事务内完成“状态校验 + 乐观锁更新 + 写流转历史”。
+// 乐观锁：UPDATE ... WHERE version=? 未命中说明被并发修改，重新加载后再判定。
+func Transition(db *gorm.DB, orderNo string, userID int64, to model.OrderStatus, reason string) (model.Order, error) {
+	var out model.Order
+	for attempt := 0; attempt < maxTransitionAttempts; attempt++ {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var o model.Order
+			if err := tx.Where("order_no = ?", orderNo).First(&o).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrOrderNotFound
+				}
+				return err
+			}
+			if userID > 0 && o.UserID != userID {
+				return ErrNotOwner
+			}
+			if !o.Status.CanTransitionTo(to) {
+				return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, o.Status, to)
+			}
+
+			now := time.Now()
+			if to == model.OrderStatusPaid && o.ExpireAt != nil && now.After(*o.ExpireAt) {
+				return ErrOrderExpired
+			}
+			updates := map[string]any{
+				"status":  to,
+				"version": o.Version + 1,
+			}
+			switch to {
+			case model.OrderStatusPaid:
+				updates["paid_at"] = now
+			case model.OrderStatusCancelled:
+				updates["cancelled_at"] = now
+			}
+			res := tx.Model(&model.Order{}).
+				Where("id = ? AND status = ? AND version = ?", o.ID, o.Status, o.Version).
+				Updates(updates)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrVersionConflict
+			}
+
+			// 取消即释放 DB 侧限购额度，与 Redis 侧额度归还保持一致。
+			if to == model.OrderStatusCancelled {
+				if err := tx.Model(&model.UserPurchase{}).
+					Where("user_id = ? AND product_id = ? AND quantity >= ?", o.UserID, o.ProductID, o.Quantity).
+					Update("quantity", gorm.Expr("quantity - ?", o.Quantity)).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Create(&model.OrderTransition{
+				OrderID:    o.ID,
+				OrderNo:    o.OrderNo,
+				FromStatus: o.Status,
+				ToStatus:   to,
+				Version:    o.Version + 1,
+				Operator:   operatorOf(userID),
+				Reason:     reason,
+			}).Error; err != nil {
+				return err
+			}
+
+			return tx.Where("id = ?", o.ID).First(&out).Error
+		})
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return model.Order{}, err
+		}
+		return out, nil
+	}
+	return model.Order{}, ErrVersionConflict
+}
+
+// ListTransitions 按时间顺序返回订单的流转历史。
+func ListTransitions(db *gorm.DB, orderNo string) ([]model.OrderTransition, error) {
+	var list []model.OrderTransition
+	err := db.Where("order_no = ?", orderNo).Order("id ASC").Find(&list).Error
+	return list, err
+}
+
+// ReleaseReservation 取消后归还 Redis 预占：
+// - 按 request_id 幂等回补库存（重复调用不会多加）
+// - 按 request_id 幂等归还 Redis 限购额度
+// - 最后在同一事务内记录 stock.compensate 审计事件并标记 orders.stock_released，未标记的已取消订单会被后台任务补做
+// 审计事件的操作者取自 ctx（见 audit.WithActor）。
+func ReleaseReservation(ctx context.Context, db *gorm.DB, rdb *rd.Client, o model.Order) error {
+	if o.Status != model.OrderStatusCancelled || o.StockReleased {
+		return nil
+	}
+	comp, err := rediskey.CompensateStockOnce(ctx, rdb, o.RequestID, o.ProductID, o.SKUID, int64(o.Quantity))
+	if err != nil {
+		return fmt.Errorf("compensate stock: %w", err)
+	}
+	if _, err := rediskey.ReleaseUserQuotaOnce(ctx, rdb, o.RequestID, o.ProductID, o.UserID, int64(o.Quantity)); err != nil {
+		return fmt.Errorf("release user quota: %w", err)
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := audit.RecordCompensation(ctx, repository.NewGormStore(tx).Audit(), o.RequestID, o.ProductID, o.SKUID, int64(o.Quantity), comp); err != nil {
+			return fmt.Errorf("audit compensation: %w", err)
+		}
+		return tx.Model(&model.Order{}).
+			Where("id = ? AND stock_released = ?", o.ID, false).
+			Update("stock_released", true).Error
+	})
+}
+
+func operatorOf(userID int64) string {
+	if userID <= 0 {
+		return SystemOperator
+	}
+	return fmt.Sprintf("user:%d", userID)
+}
@@ -0,0 +1,176 @@
+package pow
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"flash_sale/internal/middleware"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrInvalidSolution 表示挑战缺失、签名不符、已过期、与商品 / 用户不匹配或解不满足难度。
+	ErrInvalidSolution = errors.New("invalid proof of work")
+	// ErrChallengeUsed 表示挑战已被使用过（每个挑战只能下单一次）。
+	ErrChallengeUsed = errors.New("proof of work already used")
+)
+
+// Algorithm 描述客户端需要完成的计算，随挑战下发。
+const Algorithm = `找到 solution 使 sha256(challenge + ":" + solution) 的前 difficulty 个二进制位为 0`
+
+// 统计入口 QPS 的窗口（秒）与 solution 的最大长度。
+const (
+	qpsWindowSec   = 3
+	maxSolutionLen = 64
+)
+
+// Challenge 为下发给客户端的工作量证明挑战。
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	Algorithm  string    `json:"algorithm"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Gate 为下单前的工作量证明关卡（hashcash 风格，无需外部验证码服务）：
+// 难度随入口 QPS 自适应——不超过 baseQPS 时为 minBits，此后 QPS 每翻一倍加 1 位，最高 maxBits。
+// 挑战为 HMAC 签名的无状态串，绑定商品与用户；校验通过后在 Redis SET NX 登记，只能使用一次。
+type Gate struct {
+	rdb    *rd.Client
+	secret []byte
+
+	minBits int
+	maxBits int
+	baseQPS float64
+	ttl     time.Duration
+}
+
+func NewGate(rdb *rd.Client, secret string, minBits, maxBits int, baseQPS float64, ttl time.Duration) *Gate {
+	return &Gate{
+		rdb:     rdb,
+		secret:  []byte(secret),
+		minBits: minBits,
+		maxBits: maxBits,
+		baseQPS: baseQPS,
+		ttl:     ttl,
+	}
+}
+
+// Issue 为用户签发某商品的挑战，难度按当前入口 QPS 计算。
+func (g *Gate) Issue(ctx context.Context, productID uint, userID int64) (Challenge, error) {
+	qps, err := middleware.CurrentQPS(ctx, g.rdb, qpsWindowSec)
+	if err != nil {
+		// 读不到流量数据时按最高难度下发，宁可慢也不放开。
+		log.Printf("pow: read qps: %v", err)
+		qps = math.Inf(1)
+	}
+	difficulty := g.difficulty(qps)
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Challenge{}, err
+	}
+	expiresAt := time.Now().Add(g.ttl)
+	payload := fmt.Sprintf("%d.%d.%d.%d.%s", productID, userID, difficulty, expiresAt.UnixMilli(), hex.EncodeToString(id))
+	return Challenge{
+		Challenge:  payload + "." + g.sign(payload),
+		Difficulty: difficulty,
+		Algorithm:  Algorithm,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+func (g *Gate) difficulty(qps float64) int {
+	d := g.minBits
+	if qps > g.baseQPS {
+		d += int(math.Log2(qps / g.baseQPS))
+	}
+	return min(d, g.maxBits)
+}
+
+// Verify 校验下单携带的挑战与解，通过后登记为已使用。
+func (g *Gate) Verify(ctx context.Context, challenge, solution string, productID uint, userID int64) error {
+	if challenge == "" || solution == "" || len(solution) > maxSolutionLen {
+		return ErrInvalidSolution
+	}
+	i := strings.LastIndexByte(challenge, '.')
+	if i < 0 {
+		return ErrInvalidSolution
+	}
+	payload, sig := challenge[:i], challenge[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(g.sign(payload))) {
+		return ErrInvalidSolution
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 5 {
+		return ErrInvalidSolution
+	}
+	pid, err1 := strconv.ParseUint(parts[0], 10, 64)
+	uid, err2 := strconv.ParseInt(parts[1], 10, 64)
+	difficulty, err3 := strconv.Atoi(parts[2])
+	exp, err4 := strconv.ParseInt(parts[3], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		return ErrInvalidSolution
+	}
+	now := time.Now()
+	if uint(pid) != productID || uid != userID || now.UnixMilli() >= exp {
+		return ErrInvalidSolution
+	}
+	if LeadingZeroBits(challenge, solution) < difficulty {
+		return ErrInvalidSolution
+	}
+
+	// 登记保留到挑战过期，过期后的挑战本身已无法通过校验。
+	fresh, err := g.rdb.SetNX(ctx, rediskey.PowUsedKey(parts[4]), 1, time.UnixMilli(exp).Sub(now)).Result()
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrChallengeUsed
+	}
+	return nil
+}
+
+func (g *Gate) sign(payload string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// LeadingZeroBits 返回 sha256(challenge + ":" + solution) 的前导零位数。
+func LeadingZeroBits(challenge, solution string) int {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// Solve 穷举求解挑战，供压测与调试客户端使用。
+func Solve(challenge string, difficulty int) string {
+	for i := uint64(0); ; i++ {
+		s := strconv.FormatUint(i, 36)
+		if LeadingZeroBits(challenge, s) >= difficulty {
+			return s
+		}
+	}
+}
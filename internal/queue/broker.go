@@ -0,0 +1,40 @@
+package queue
+
+import "context"
+
+// Message 是与具体消息中间件无关的消息结构。
+// Partition/Offset（或 Redis Stream 的 ID）由实现填充，用于提交位点与死信定位。
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	ID        string
+	Key       []byte
+	Value     []byte
+}
+
+// Publisher 向某个 topic 同步写入消息，返回 nil 表示已被中间件确认。
+type Publisher interface {
+	Publish(ctx context.Context, key, value []byte) error
+	Close() error
+}
+
+// Subscriber 以消费者组身份拉取消息，业务处理成功后再 Commit（at-least-once）。
+type Subscriber interface {
+	Fetch(ctx context.Context) (Message, error)
+	Commit(ctx context.Context, m Message) error
+	Close() error
+}
+
+// TopicReader 按分区 + offset 顺序浏览 topic，不影响任何消费者组位点（死信查询用）。
+type TopicReader interface {
+	Read(ctx context.Context, partition int, offset int64, limit int) ([]Message, error)
+}
+
+// Broker 为 Relay / Consumer / 死信按 topic 创建读写端。
+// 实现：KafkaBroker（生产）与 MemoryBroker（本地开发、CI，无需 Kafka）。
+type Broker interface {
+	Publisher(topic string) Publisher
+	Subscriber(topic, group string) Subscriber
+	TopicReader(topic string) TopicReader
+}
@@ -9,57 +9,57 @@ import (
 	"strings"
 	"time"
 
+	"flash_sale/internal/audit"
 	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	"flash_sale/internal/storage"
 	rediskey "flash_sale/pkg/redis"
-
-	rd "github.com/redis/go-redis/v9"
-	"github.com/segmentio/kafka-go"
-	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
-// errDuplicatePurchase 表示业务层的一人一单冲突。
-var errDuplicatePurchase = errors.New("duplicate purchase")
 var requestStateTTL = 24 * time.Hour
 
-// Consumer 负责消费 Kafka 下单消息并落库。
-// 依赖 DB（订单与状态）+ Redis（失败回补库存）。
+// Consumer 负责消费下单消息并落库。
+// 依赖 Subscriber（Kafka / 内存 / Redis Stream 直连）+ Store（订单与状态）+ 请求状态缓存 + 库存缓存层（失败回补库存与限购额度）。
 type Consumer struct {
-	r   *kafka.Reader
-	db  *gorm.DB
-	rdb *rd.Client
+	sub       Subscriber
+	store     repository.Store
+	states    repository.RequestStateCache
+	inventory repository.Inventory
+
+	// payTimeout 决定新订单的支付截止时间（expire_at）。
+	payTimeout time.Duration
+
+	// dlq + maxAttempts：毒消息与非暂时性错误耗尽重试后写入死信，再提交位点；暂时性错误不计入上限。
+	dlq         DeadLetterSink
+	maxAttempts int
 }
 
 // NewConsumer 创建消费者。
-// 注意：这里使用手动提交 offset（CommitInterval=0），
-// 只有业务处理成功后才 commit，避免“先提交后失败”导致消息丢处理。
-func NewConsumer(brokers []string, topic, groupID string, db *gorm.DB, rdb *rd.Client) *Consumer {
+// 注意：Subscriber 需手动 Commit，只有业务处理成功（或已写入死信）后才提交，
+// 避免“先提交后失败”导致消息丢处理。
+func NewConsumer(sub Subscriber, store repository.Store, states repository.RequestStateCache, inventory repository.Inventory, payTimeout time.Duration, dlq DeadLetterSink, maxAttempts int) *Consumer {
 	return &Consumer{
-		r: kafka.NewReader(kafka.ReaderConfig{
-			Brokers:  brokers,
-			Topic:    topic,
-			GroupID:  groupID,
-			MinBytes: 1e3,
-			MaxBytes: 1e6,
-			// We commit offsets manually after successful processing.
-			CommitInterval: 0,
-			StartOffset:    kafka.FirstOffset,
-		}),
-		db:  db,
-		rdb: rdb,
+		sub:         sub,
+		store:       store,
+		states:      states,
+		inventory:   inventory,
+		payTimeout:  payTimeout,
+		dlq:         dlq,
+		maxAttempts: maxAttempts,
 	}
 }
 
-// Close 释放 reader 资源。
-func (c *Consumer) Close() error { return c.r.Close() }
+// Close 释放 subscriber 资源。
+func (c *Consumer) Close() error { return c.sub.Close() }
 
-// Run 持续拉取消息 -> 处理 -> 提交 offset。
+// Run 持续拉取消息 -> 处理 -> 提交位点。
 func (c *Consumer) Run(ctx context.Context) {
+	ctx = audit.WithActor(ctx, "system:consumer")
 	for {
 		// 1) 拉取一条消息（不自动提交）
-		m, err := c.r.FetchMessage(ctx)
+		m, err := c.sub.Fetch(ctx)
 		if err != nil {
-			if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, errBrokerClosed) {
 				return // graceful stop
 			}
 			log.Printf("consumer fetch message: %v", err)
@@ -67,15 +67,13 @@ func (c *Consumer) Run(ctx context.Context) {
 			continue
 		}
 
-		// 2) 业务处理失败时不提交 offset，让 Kafka 后续重投
-		if err := c.processMessage(ctx, m); err != nil {
-			log.Printf("consumer process message key=%s: %v", string(m.Key), err)
-			time.Sleep(300 * time.Millisecond)
-			continue // do not commit, Kafka will redeliver
+		// 2) 业务处理：同一条消息原地有界重试，耗尽后写死信；只有停机才会放弃（不提交）
+		if err := c.processWithRetry(ctx, m); err != nil {
+			return
 		}
 
-		// 3) 仅在处理成功后提交 offset
-		if err := c.r.CommitMessages(ctx, m); err != nil {
+		// 3) 仅在处理成功后提交位点
+		if err := c.sub.Commit(ctx, m); err != nil {
 			if ctx.Err() != nil || errors.Is(err, context.Canceled) {
 				return
 			}
@@ -86,33 +84,75 @@ func (c *Consumer) Run(ctx context.Context) {
 	}
 }
 
+// processWithRetry 对单条消息原地重试：
+// - 毒消息（脏 JSON / 校验失败）直接写入死信
+// - 暂时性错误（DB / Redis 不可用、超时、死锁，见 storage.IsTransient）不计次数，退避后一直重试
+// - 其余错误（如商品不存在）按尝试次数退避重试，达到 maxAttempts 后写入死信
+// 故障期间宁可阻塞消费，也不把有效订单写进死信；仅在 ctx 取消时返回错误，此时不提交位点，由 Broker 重投。
+func (c *Consumer) processWithRetry(ctx context.Context, m Message) error {
+	for attempt := 1; ; attempt++ {
+		err := c.processMessage(ctx, m)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("consumer process message key=%s attempt=%d: %v", string(m.Key), attempt, err)
+
+		if errors.Is(err, errPoisonMessage) {
+			return c.publishDeadLetter(ctx, m, err, attempt)
+		}
+		if !storage.IsTransient(err) && attempt >= c.maxAttempts {
+			return c.publishDeadLetter(ctx, m, err, attempt)
+		}
+		if !sleepCtx(ctx, retryBackoff(attempt)) {
+			return ctx.Err()
+		}
+	}
+}
+
+// publishDeadLetter 写死信失败时持续重试：宁可阻塞也不能在未留痕的情况下提交 offset。
+func (c *Consumer) publishDeadLetter(ctx context.Context, m Message, cause error, attempts int) error {
+	for {
+		err := c.dlq.Publish(ctx, m, cause, attempts)
+		if err == nil {
+			log.Printf("consumer dead-lettered message key=%s attempts=%d: %v", string(m.Key), attempts, cause)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("consumer publish dead letter key=%s: %v", string(m.Key), err)
+		if !sleepCtx(ctx, time.Second) {
+			return ctx.Err()
+		}
+	}
+}
+
 // processMessage 负责单条消息的业务流转：
 // - 消息校验
 // - 建单并异步写请求状态
 // - 必要时失败回补库存
-func (c *Consumer) processMessage(ctx context.Context, m kafka.Message) error {
+func (c *Consumer) processMessage(ctx context.Context, m Message) error {
 	var msg OrderMessage
 	if err := json.Unmarshal(m.Value, &msg); err != nil {
-		log.Printf("consumer invalid json payload: %v", err)
-		return nil // poison message, skip
+		return fmt.Errorf("%w: invalid json: %v", errPoisonMessage, err)
 	}
 	if err := msg.Validate(); err != nil {
-		log.Printf("consumer invalid payload: %v", err)
-		return nil // poison message, skip
+		return fmt.Errorf("%w: invalid payload: %v", errPoisonMessage, err)
 	}
 
-	orderNo, err := c.createOrderAndMarkSuccess(msg)
+	orderNo, err := c.createOrderAndMarkSuccess(ctx, msg)
 	if err != nil {
-		if errors.Is(err, errDuplicatePurchase) {
-			if markErr := c.markRequestFailed(msg, "duplicate_purchase"); markErr != nil {
+		if errors.Is(err, repository.ErrPurchaseLimitExceeded) {
+			if markErr := c.markRequestFailed(ctx, msg, "purchase_limit_exceeded"); markErr != nil {
 				return markErr
 			}
-			if stateErr := rediskey.PutRequestState(ctx, c.rdb, msg.RequestID, rediskey.RequestFailed, "", "duplicate_purchase", requestStateTTL); stateErr != nil {
-				log.Printf("consumer sync redis failed state request_id=%s: %v", msg.RequestID, stateErr)
-			}
+			c.putState(ctx, rediskey.RequestState{RequestID: msg.RequestID, Status: rediskey.RequestFailed, Reason: "purchase_limit_exceeded"})
 			return c.compensateStockOnce(ctx, msg)
 		}
-		if errorsLikeUnique(err) {
+		if errors.Is(err, repository.ErrDuplicate) {
 			// Duplicate by request_id, sync state then continue.
 			_, syncErr := c.syncRequestStatusFromOrder(ctx, msg.RequestID)
 			return syncErr
@@ -121,91 +161,80 @@ func (c *Consumer) processMessage(ctx context.Context, m kafka.Message) error {
 	}
 
 	if orderNo != "" {
-		if err := rediskey.PutRequestState(ctx, c.rdb, msg.RequestID, rediskey.RequestSuccess, orderNo, "", requestStateTTL); err != nil {
-			log.Printf("consumer sync redis success state request_id=%s: %v", msg.RequestID, err)
-		}
+		c.putState(ctx, rediskey.RequestState{RequestID: msg.RequestID, Status: rediskey.RequestSuccess, OrderNo: orderNo})
 	}
 	return nil
 }
 
 // createOrderAndMarkSuccess 在事务里做“建单 + 状态更新”。
 // 事务目标：保证订单写入与请求状态的原子一致。
-func (c *Consumer) createOrderAndMarkSuccess(msg OrderMessage) (string, error) {
+func (c *Consumer) createOrderAndMarkSuccess(ctx context.Context, msg OrderMessage) (string, error) {
 	var resultOrderNo string
 
-	err := c.db.Transaction(func(tx *gorm.DB) error {
-		if err := upsertPendingRequest(tx, msg); err != nil {
+	err := c.store.Transaction(ctx, func(tx repository.Store) error {
+		if err := tx.Requests().UpsertPending(ctx, pendingRequestOf(msg)); err != nil {
 			return err
 		}
 
-		var req model.OrderRequest
 		// 行级锁住 request_id 对应记录，避免并发消费者竞态（即使概率低，也显式防护）。
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("request_id = ?", msg.RequestID).
-			First(&req).Error; err != nil {
+		req, err := tx.Requests().GetForUpdate(ctx, msg.RequestID)
+		if err != nil {
 			return err
 		}
 
 		if req.Status == model.OrderRequestSuccess {
 			resultOrderNo = req.OrderNo
 			if resultOrderNo == "" {
-				var exist model.Order
-				if e := tx.Where("request_id = ?", msg.RequestID).First(&exist).Error; e == nil {
+				if exist, e := tx.Orders().GetByRequestID(ctx, msg.RequestID); e == nil {
 					resultOrderNo = exist.OrderNo
 				}
 			}
 			return nil
 		}
-		if req.Status == model.OrderRequestFailed {
+		if req.Status == model.OrderRequestFailed || req.Status == model.OrderRequestNotSelected || req.Status == model.OrderRequestDenied {
 			return nil
 		}
 
 		orderNo := buildOrderNo(msg.RequestID)
+		expireAt := time.Now().Add(c.payTimeout)
 		order := &model.Order{
 			RequestID: msg.RequestID,
 			OrderNo:   orderNo,
 			UserID:    msg.UserID,
 			ProductID: msg.ProductID,
+			SKUID:     msg.SKUID,
 			Quantity:  msg.Quantity,
 			Amount:    msg.Amount,
-			Status:    0,
+			Status:    model.OrderStatusPendingPayment,
+			ExpireAt:  &expireAt,
 		}
 
-		if err := tx.Create(order).Error; err != nil {
-			if errorsLikeUnique(err) {
+		if err := tx.Orders().Create(ctx, order); err != nil {
+			if errors.Is(err, repository.ErrDuplicate) {
 				// request_id 唯一冲突：幂等消费，直接同步为成功。
-				var exist model.Order
-				if e := tx.Where("request_id = ?", msg.RequestID).First(&exist).Error; e == nil {
+				if exist, e := tx.Orders().GetByRequestID(ctx, msg.RequestID); e == nil {
 					resultOrderNo = exist.OrderNo
-					res := tx.Model(&model.OrderRequest{}).
-						Where("request_id = ?", msg.RequestID).
-						Updates(map[string]any{
-							"status":    model.OrderRequestSuccess,
-							"order_no":  exist.OrderNo,
-							"error_msg": "",
-						})
-					return res.Error
-				}
-
-				// user_id + product_id 唯一冲突：判定为重复购买。
-				var userProductOrder model.Order
-				if e := tx.Where("user_id = ? AND product_id = ?", msg.UserID, msg.ProductID).First(&userProductOrder).Error; e == nil {
-					return errDuplicatePurchase
+					return tx.Requests().MarkSuccess(ctx, msg.RequestID, exist.OrderNo)
 				}
-
-				return err
 			}
 			return err
 		}
 
+		// 订单写入成功后再累加限购数量：超限则整个事务回滚（订单一并撤销）。
+		prod, err := tx.Products().Get(ctx, msg.ProductID)
+		if err != nil {
+			return err
+		}
+		limit := prod.PerUserLimit
+		if limit <= 0 {
+			limit = 1
+		}
+		if err := tx.Orders().ReserveUserQuota(ctx, msg.UserID, msg.ProductID, msg.Quantity, limit); err != nil {
+			return err
+		}
+
 		resultOrderNo = orderNo
-		return tx.Model(&model.OrderRequest{}).
-			Where("request_id = ?", msg.RequestID).
-			Updates(map[string]any{
-				"status":    model.OrderRequestSuccess,
-				"order_no":  orderNo,
-				"error_msg": "",
-			}).Error
+		return tx.Requests().MarkSuccess(ctx, msg.RequestID, orderNo)
 	})
 	if err != nil {
 		return "", err
@@ -213,64 +242,60 @@ func (c *Consumer) createOrderAndMarkSuccess(msg OrderMessage) (string, error) {
 	return resultOrderNo, nil
 }
 
-func upsertPendingRequest(tx *gorm.DB, msg OrderMessage) error {
-	row := &model.OrderRequest{
+// pendingRequestOf 由消息还原 pending 状态的请求行。
+func pendingRequestOf(msg OrderMessage) model.OrderRequest {
+	return model.OrderRequest{
 		RequestID: msg.RequestID,
 		UserID:    msg.UserID,
 		ProductID: msg.ProductID,
+		SKUID:     msg.SKUID,
 		Quantity:  msg.Quantity,
 		Amount:    msg.Amount,
 		Status:    model.OrderRequestPending,
 	}
-	return tx.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "request_id"}},
-		DoNothing: true,
-	}).Create(row).Error
 }
 
 // markRequestFailed 仅允许 pending -> failed，防止覆盖终态。
-func (c *Consumer) markRequestFailed(msg OrderMessage, reason string) error {
-	return c.db.Transaction(func(tx *gorm.DB) error {
-		if err := upsertPendingRequest(tx, msg); err != nil {
+func (c *Consumer) markRequestFailed(ctx context.Context, msg OrderMessage, reason string) error {
+	return c.store.Transaction(ctx, func(tx repository.Store) error {
+		if err := tx.Requests().UpsertPending(ctx, pendingRequestOf(msg)); err != nil {
 			return err
 		}
-		return tx.Model(&model.OrderRequest{}).
-			Where("request_id = ? AND status = ?", msg.RequestID, model.OrderRequestPending).
-			Updates(map[string]any{
-				"status":    model.OrderRequestFailed,
-				"error_msg": reason,
-			}).Error
+		_, err := tx.Requests().MarkFailed(ctx, msg.RequestID, reason)
+		return err
 	})
 }
 
 // syncRequestStatusFromOrder 在幂等场景下，用已有订单反推请求状态为 success。
 func (c *Consumer) syncRequestStatusFromOrder(ctx context.Context, requestID string) (string, error) {
-	var order model.Order
-	if err := c.db.Where("request_id = ?", requestID).First(&order).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+	order, err := c.store.Orders().GetByRequestID(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			return "", nil
 		}
 		return "", err
 	}
 
-	if err := c.db.Model(&model.OrderRequest{}).
-		Where("request_id = ?", requestID).
-		Updates(map[string]any{
-			"status":    model.OrderRequestSuccess,
-			"order_no":  order.OrderNo,
-			"error_msg": "",
-		}).Error; err != nil {
+	if err := c.store.Requests().MarkSuccess(ctx, requestID, order.OrderNo); err != nil {
 		return "", err
 	}
-	if err := rediskey.PutRequestState(ctx, c.rdb, requestID, rediskey.RequestSuccess, order.OrderNo, "", requestStateTTL); err != nil {
-		log.Printf("consumer sync redis success state request_id=%s: %v", requestID, err)
-	}
+	c.putState(ctx, rediskey.RequestState{RequestID: requestID, Status: rediskey.RequestSuccess, OrderNo: order.OrderNo})
 	return order.OrderNo, nil
 }
 
-// compensateStockOnce 失败时回补库存（按 request_id 最多回补一次）。
+// putState 同步请求状态缓存；DB 已是事实来源，失败只记录日志。
+func (c *Consumer) putState(ctx context.Context, state rediskey.RequestState) {
+	if err := c.states.Put(ctx, state, requestStateTTL); err != nil {
+		log.Printf("consumer sync %s state request_id=%s: %v", state.Status, state.RequestID, err)
+	}
+}
+
+// compensateStockOnce 失败时回补库存并归还限购额度（均按 request_id 最多执行一次），并记录回补审计事件。
 func (c *Consumer) compensateStockOnce(ctx context.Context, msg OrderMessage) error {
-	_, err := rediskey.CompensateStockOnce(ctx, c.rdb, msg.RequestID, msg.ProductID, int64(msg.Quantity))
+	if err := audit.Compensate(ctx, c.inventory, c.store.Audit(), msg.RequestID, msg.ProductID, msg.SKUID, int64(msg.Quantity)); err != nil {
+		return err
+	}
+	_, err := c.inventory.ReleaseQuota(ctx, msg.RequestID, msg.ProductID, msg.UserID, int64(msg.Quantity))
 	return err
 }
 
@@ -280,11 +305,23 @@ func buildOrderNo(requestID string) string {
 	return fmt.Sprintf("SK%s", base)
 }
 
-// errorsLikeUnique 兼容不同数据库驱动的唯一冲突报错文本。
-func errorsLikeUnique(err error) bool {
-	if err == nil {
+// retryBackoff 线性退避，上限 5s。
+func retryBackoff(attempt int) time.Duration {
+	d := time.Duration(attempt) * 300 * time.Millisecond
+	if d > 5*time.Second {
+		d = 5 * time.Second
+	}
+	return d
+}
+
+// sleepCtx 可被 ctx 打断的 sleep，返回 false 表示 ctx 已取消。
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
 		return false
+	case <-t.C:
+		return true
 	}
-	s := err.Error()
-	return strings.Contains(s, "UNIQUE") || strings.Contains(s, "unique")
 }
@@ -0,0 +1,246 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+)
+
+type consumerFixture struct {
+	store     *repository.MemoryStore
+	states    *repository.MemoryStateCache
+	inventory *repository.MemoryInventory
+	dlq       *memoryDeadLetters
+	consumer  *Consumer
+	product   model.Product
+}
+
+// memoryDeadLetters 记录写入死信的消息。
+type memoryDeadLetters struct {
+	mu      sync.Mutex
+	entries []deadLetterEntry
+}
+
+type deadLetterEntry struct {
+	msg      Message
+	cause    error
+	attempts int
+}
+
+func (d *memoryDeadLetters) Publish(_ context.Context, m Message, cause error, attempts int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, deadLetterEntry{msg: m, cause: cause, attempts: attempts})
+	return nil
+}
+
+func (d *memoryDeadLetters) list() []deadLetterEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]deadLetterEntry(nil), d.entries...)
+}
+
+// newConsumerFixture 以内存仓储、内存状态缓存与内存库存搭建消费者；商品每人限购 2，库存已被本次下单扣到 5。
+// wrap 非 nil 时消费者使用其包装后的仓储。
+func newConsumerFixture(t *testing.T, maxAttempts int, wrap func(*repository.MemoryStore) repository.Store) *consumerFixture {
+	t.Helper()
+	f := &consumerFixture{
+		store:  repository.NewMemoryStore(),
+		states: repository.NewMemoryStateCache(),
+		dlq:    &memoryDeadLetters{},
+	}
+	f.inventory = repository.NewMemoryInventory(f.states)
+	var store repository.Store = f.store
+	if wrap != nil {
+		store = wrap(f.store)
+	}
+
+	f.product = model.Product{Name: "test", Stock: 6, SalePrice: 100, PerUserLimit: 2, SaleMode: model.SaleModeFCFS}
+	if err := f.store.Products().Create(context.Background(), &f.product); err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	f.inventory.SetStock(f.product.ID, 0, 5)
+
+	f.consumer = NewConsumer(nil, store, f.states, f.inventory, 15*time.Minute, f.dlq, maxAttempts)
+	return f
+}
+
+func (f *consumerFixture) message(t *testing.T, requestID string, userID int64, quantity int) Message {
+	t.Helper()
+	b, err := json.Marshal(OrderMessage{
+		RequestID: requestID,
+		ProductID: f.product.ID,
+		UserID:    userID,
+		Quantity:  quantity,
+		Amount:    f.product.SalePrice * int64(quantity),
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return Message{Key: []byte(requestID), Value: b}
+}
+
+func TestConsumerCreatesOrder(t *testing.T) {
+	f := newConsumerFixture(t, 3, nil)
+	ctx := context.Background()
+
+	m := f.message(t, "req-1", 10001, 1)
+	if err := f.consumer.processMessage(ctx, m); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	// 重复投递幂等：不重复建单，也不重复累加限购。
+	if err := f.consumer.processMessage(ctx, m); err != nil {
+		t.Fatalf("process redelivery: %v", err)
+	}
+
+	order, err := f.store.Orders().GetByRequestID(ctx, "req-1")
+	if err != nil {
+		t.Fatalf("order not created: %v", err)
+	}
+	if order.OrderNo != buildOrderNo("req-1") || order.Status != model.OrderStatusPendingPayment || order.ExpireAt == nil {
+		t.Fatalf("order = %+v", order)
+	}
+	req, err := f.store.Requests().Get(ctx, "req-1")
+	if err != nil || req.Status != model.OrderRequestSuccess || req.OrderNo != order.OrderNo {
+		t.Fatalf("request = %+v, err = %v", req, err)
+	}
+	if st, found, _ := f.states.Get(ctx, "req-1"); !found || st.Status != rediskey.RequestSuccess || st.OrderNo != order.OrderNo {
+		t.Fatalf("state = %+v found=%v", st, found)
+	}
+	if got := f.store.UserPurchased(10001, f.product.ID); got != 1 {
+		t.Fatalf("purchased = %d, want 1", got)
+	}
+	if got := f.inventory.Stock(f.product.ID, 0); got != 5 {
+		t.Fatalf("stock = %d, want 5 (no compensation)", got)
+	}
+}
+
+func TestConsumerPurchaseLimitCompensates(t *testing.T) {
+	f := newConsumerFixture(t, 3, nil)
+	ctx := context.Background()
+
+	if err := f.consumer.processMessage(ctx, f.message(t, "req-1", 10001, 2)); err != nil {
+		t.Fatalf("process first: %v", err)
+	}
+	// 缓存层与 DB 不一致时（如 Redis 限购计数丢失），DB 限购兜底：请求失败并归还库存。
+	m := f.message(t, "req-2", 10001, 1)
+	for i := 0; i < 2; i++ {
+		if err := f.consumer.processMessage(ctx, m); err != nil {
+			t.Fatalf("process over limit: %v", err)
+		}
+	}
+
+	if _, err := f.store.Orders().GetByRequestID(ctx, "req-2"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("order over limit: err = %v, want ErrNotFound", err)
+	}
+	req, err := f.store.Requests().Get(ctx, "req-2")
+	if err != nil || req.Status != model.OrderRequestFailed || req.ErrorMsg != "purchase_limit_exceeded" {
+		t.Fatalf("request = %+v, err = %v", req, err)
+	}
+	if st, _, _ := f.states.Get(ctx, "req-2"); st.Status != rediskey.RequestFailed {
+		t.Fatalf("state = %+v, want failed", st)
+	}
+	if got := f.store.UserPurchased(10001, f.product.ID); got != 2 {
+		t.Fatalf("purchased = %d, want 2 (rolled back)", got)
+	}
+	if got := f.inventory.Stock(f.product.ID, 0); got != 6 {
+		t.Fatalf("stock = %d, want 6 (compensated once)", got)
+	}
+}
+
+func TestConsumerSkipsTerminalRequest(t *testing.T) {
+	f := newConsumerFixture(t, 3, nil)
+	ctx := context.Background()
+
+	m := f.message(t, "req-1", 10001, 1)
+	if err := f.store.Requests().UpsertPending(ctx, model.OrderRequest{RequestID: "req-1", UserID: 10001, ProductID: f.product.ID, Quantity: 1, Amount: 100}); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if _, err := f.store.Requests().MarkFailed(ctx, "req-1", reasonLostInPipeline); err != nil {
+		t.Fatalf("mark failed: %v", err)
+	}
+
+	if err := f.consumer.processMessage(ctx, m); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if _, err := f.store.Orders().GetByRequestID(ctx, "req-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("order for failed request: err = %v, want ErrNotFound", err)
+	}
+}
+
+// flakyStore 在前 failures 次事务中返回 err，之后委托给内存仓储。
+type flakyStore struct {
+	*repository.MemoryStore
+	err error
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (s *flakyStore) Transaction(ctx context.Context, fn func(tx repository.Store) error) error {
+	s.mu.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mu.Unlock()
+		return s.err
+	}
+	s.mu.Unlock()
+	return s.MemoryStore.Transaction(ctx, fn)
+}
+
+func TestConsumerRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		failures  int
+		wantOrder bool
+		wantDead  int
+	}{
+		// 暂时性错误不计入 maxAttempts，恢复后正常建单。
+		{"transient", context.DeadlineExceeded, 2, true, 0},
+		// 其余错误达到 maxAttempts 后写入死信。
+		{"permanent", errors.New("boom"), 5, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newConsumerFixture(t, 2, func(s *repository.MemoryStore) repository.Store {
+				return &flakyStore{MemoryStore: s, err: tt.err, failures: tt.failures}
+			})
+			ctx := context.Background()
+
+			if err := f.consumer.processWithRetry(ctx, f.message(t, "req-1", 10001, 1)); err != nil {
+				t.Fatalf("processWithRetry: %v", err)
+			}
+			_, err := f.store.Orders().GetByRequestID(ctx, "req-1")
+			if gotOrder := err == nil; gotOrder != tt.wantOrder {
+				t.Fatalf("order created = %v, want %v (err %v)", gotOrder, tt.wantOrder, err)
+			}
+			dead := f.dlq.list()
+			if len(dead) != tt.wantDead {
+				t.Fatalf("dead letters = %d, want %d", len(dead), tt.wantDead)
+			}
+			if len(dead) > 0 && dead[0].attempts != 2 {
+				t.Fatalf("dead letter attempts = %d, want 2", dead[0].attempts)
+			}
+		})
+	}
+}
+
+func TestConsumerPoisonMessage(t *testing.T) {
+	f := newConsumerFixture(t, 3, nil)
+
+	if err := f.consumer.processWithRetry(context.Background(), Message{Key: []byte("bad"), Value: []byte("{")}); err != nil {
+		t.Fatalf("processWithRetry: %v", err)
+	}
+	dead := f.dlq.list()
+	if len(dead) != 1 || dead[0].attempts != 1 || !errors.Is(dead[0].cause, errPoisonMessage) {
+		t.Fatalf("dead letters = %+v, want one poison message", dead)
+	}
+}
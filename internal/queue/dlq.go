@@ -0,0 +1,336 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// ErrDeadLetterNotFound 表示指定的死信不存在。
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// ErrAlreadyRedriven 表示该死信已经重投过。
+var ErrAlreadyRedriven = errors.New("dead letter already redriven")
+
+// errPoisonMessage 标记无论重试多少次都不可能成功的消息（脏 JSON、字段校验失败）。
+var errPoisonMessage = errors.New("poison message")
+
+// 死信流中的元数据字段统一加 dlq_ 前缀，其余字段为原始消息字段，便于原样重投。
+const (
+	dlqFieldSourceID = "dlq_source_id"
+	dlqFieldError    = "dlq_error"
+	dlqFieldAttempts = "dlq_attempts"
+	dlqFieldFailedAt = "dlq_failed_at"
+)
+
+// DeadLetterSink 接收 Consumer 处理失败的消息：BrokerDLQ（经 Relay 的链路）或 StreamDLQ（Stream 直连模式）。
+type DeadLetterSink interface {
+	Publish(ctx context.Context, m Message, cause error, attempts int) error
+}
+
+// DeadLetter 是 Redis Stream 死信与 Broker 死信的统一视图。
+type DeadLetter struct {
+	// ID：stream 死信为 entry ID；Broker 死信为 "partition:offset"。
+	ID       string    `json:"id"`
+	Source   string    `json:"source"` // stream / broker
+	SourceID string    `json:"source_id"`
+	Key      string    `json:"key,omitempty"`
+	Payload  string    `json:"payload"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+	Redriven bool      `json:"redriven"`
+}
+
+// luaRedriveStream 写回源 stream 并删除死信；请求状态仍在时记录新的 outbox entry ID（清扫任务据此定位）。
+// KEYS: 源 stream、死信流、死信请求集合、请求状态；ARGV: 死信 ID、request_id、原始字段键值对。
+const luaRedriveStream = `
+local eventID = redis.call('XADD', KEYS[1], '*', unpack(ARGV, 3))
+redis.call('XDEL', KEYS[2], ARGV[1])
+if ARGV[2] ~= '' then
+  redis.call('SREM', KEYS[3], ARGV[2])
+  if redis.call('EXISTS', KEYS[4]) == 1 then
+    redis.call('HSET', KEYS[4], 'event_id', eventID)
+  end
+end
+return eventID
+`
+
+// StreamDLQ 管理 Relay 的 Redis Stream 死信（<stream>:dlq）。
+type StreamDLQ struct {
+	rdb    *rd.Client
+	stream string
+}
+
+func NewStreamDLQ(rdb *rd.Client, stream string) *StreamDLQ {
+	return &StreamDLQ{rdb: rdb, stream: stream}
+}
+
+// Publish 将 Consumer 处理失败的消息写入死信流（并登记请求），字段格式与 Relay 死信一致，便于统一重投。
+// 原消息的 XACK + XDEL 由随后的 Commit 完成。
+func (q *StreamDLQ) Publish(ctx context.Context, m Message, cause error, attempts int) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(m.Value, &fields); err != nil || len(fields) == 0 {
+		fields = map[string]interface{}{"payload": string(m.Value)}
+	}
+	values := make(map[string]interface{}, len(fields)+4)
+	for k, v := range fields {
+		if f, ok := v.(float64); ok {
+			// JSON 数字统一按整数写回，保证重投后 parseOrderEvent 可解析。
+			v = strconv.FormatInt(int64(f), 10)
+		}
+		values[k] = v
+	}
+	values[dlqFieldSourceID] = m.ID
+	values[dlqFieldError] = cause.Error()
+	values[dlqFieldAttempts] = attempts
+	values[dlqFieldFailedAt] = time.Now().Format(time.RFC3339Nano)
+
+	pipe := q.rdb.TxPipeline()
+	pipe.XAdd(ctx, &rd.XAddArgs{Stream: rediskey.DeadLetterStreamKey(q.stream), Values: values})
+	if requestID, err := getStreamString(values, "request_id"); err == nil {
+		pipe.SAdd(ctx, rediskey.DeadLetteredRequestsKey(), requestID)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// deadLetterStreamEntry 将 stream 条目原始字段连同失败原因、尝试次数写入死信流，
+// 并在同一事务中登记请求、ACK + 删除原消息、清理接管计数。
+func deadLetterStreamEntry(ctx context.Context, rdb *rd.Client, stream, group string, xm rd.XMessage, reason string, attempts int64) error {
+	values := make(map[string]interface{}, len(xm.Values)+4)
+	for k, v := range xm.Values {
+		values[k] = v
+	}
+	values[dlqFieldSourceID] = xm.ID
+	values[dlqFieldError] = reason
+	values[dlqFieldAttempts] = attempts
+	values[dlqFieldFailedAt] = time.Now().Format(time.RFC3339Nano)
+
+	pipe := rdb.TxPipeline()
+	pipe.XAdd(ctx, &rd.XAddArgs{Stream: rediskey.DeadLetterStreamKey(stream), Values: values})
+	if requestID, err := getStreamString(xm.Values, "request_id"); err == nil {
+		pipe.SAdd(ctx, rediskey.DeadLetteredRequestsKey(), requestID)
+	}
+	pipe.XAck(ctx, stream, group, xm.ID)
+	pipe.XDel(ctx, stream, xm.ID)
+	pipe.HDel(ctx, rediskey.StreamClaimCountKey(stream), xm.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// List 从 start（含）开始按写入顺序返回最多 count 条死信，start 为空表示从头开始。
+func (q *StreamDLQ) List(ctx context.Context, start string, count int64) ([]DeadLetter, error) {
+	if start == "" {
+		start = "-"
+	}
+	msgs, err := q.rdb.XRangeN(ctx, rediskey.DeadLetterStreamKey(q.stream), start, "+", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DeadLetter, 0, len(msgs))
+	for _, xm := range msgs {
+		out = append(out, streamDeadLetter(xm))
+	}
+	return out, nil
+}
+
+// Get 查询单条死信。
+func (q *StreamDLQ) Get(ctx context.Context, id string) (DeadLetter, error) {
+	xm, err := q.get(ctx, id)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	return streamDeadLetter(xm), nil
+}
+
+// Redrive 将死信的原始字段重新写回源 stream，并原子地删除死信、撤销请求登记、更新请求状态中的 outbox entry ID。
+// 返回新写入的 stream entry ID。
+func (q *StreamDLQ) Redrive(ctx context.Context, id string) (string, error) {
+	xm, err := q.get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	requestID, _ := getStreamString(xm.Values, "request_id")
+	args := []interface{}{id, requestID}
+	for k, v := range xm.Values {
+		if !strings.HasPrefix(k, "dlq_") {
+			args = append(args, k, v)
+		}
+	}
+	return q.rdb.Eval(ctx, luaRedriveStream,
+		[]string{q.stream, rediskey.DeadLetterStreamKey(q.stream), rediskey.DeadLetteredRequestsKey(), rediskey.RequestStatusKey(requestID)},
+		args...,
+	).Text()
+}
+
+func (q *StreamDLQ) get(ctx context.Context, id string) (rd.XMessage, error) {
+	msgs, err := q.rdb.XRangeN(ctx, rediskey.DeadLetterStreamKey(q.stream), id, id, 1).Result()
+	if err != nil {
+		return rd.XMessage{}, err
+	}
+	if len(msgs) == 0 {
+		return rd.XMessage{}, ErrDeadLetterNotFound
+	}
+	return msgs[0], nil
+}
+
+func streamDeadLetter(xm rd.XMessage) DeadLetter {
+	payload := make(map[string]string, len(xm.Values))
+	for k := range xm.Values {
+		if strings.HasPrefix(k, "dlq_") {
+			continue
+		}
+		payload[k], _ = getStreamString(xm.Values, k)
+	}
+	b, _ := json.Marshal(payload)
+
+	out := DeadLetter{
+		ID:      xm.ID,
+		Source:  "stream",
+		Payload: string(b),
+	}
+	out.SourceID, _ = getStreamString(xm.Values, dlqFieldSourceID)
+	out.Key = payload["request_id"]
+	out.Error, _ = getStreamString(xm.Values, dlqFieldError)
+	if s, err := getStreamString(xm.Values, dlqFieldAttempts); err == nil {
+		out.Attempts, _ = strconv.Atoi(s)
+	}
+	if s, err := getStreamString(xm.Values, dlqFieldFailedAt); err == nil {
+		out.FailedAt, _ = time.Parse(time.RFC3339Nano, s)
+	}
+	return out
+}
+
+// brokerDeadLetterEnvelope 是写入死信 topic 的消息体，保留原始 payload 与失败上下文。
+type brokerDeadLetterEnvelope struct {
+	Payload   string    `json:"payload"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	Topic     string    `json:"topic"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// BrokerDLQ 负责消费端死信的写入、查询与重投，底层为 Broker 上的死信 topic。
+type BrokerDLQ struct {
+	pub    Publisher
+	reader TopicReader
+	rdb    *rd.Client
+	topic  string
+	// source 为重投目标（原始下单 topic）。
+	source Publisher
+}
+
+func NewBrokerDLQ(broker Broker, topic string, rdb *rd.Client, source Publisher) *BrokerDLQ {
+	return &BrokerDLQ{
+		pub:    broker.Publisher(topic),
+		reader: broker.TopicReader(topic),
+		rdb:    rdb,
+		topic:  topic,
+		source: source,
+	}
+}
+
+// Close 释放死信写入端资源。
+func (q *BrokerDLQ) Close() error { return q.pub.Close() }
+
+// Publish 将处理失败的原始消息连同错误与尝试次数写入死信 topic。
+func (q *BrokerDLQ) Publish(ctx context.Context, m Message, cause error, attempts int) error {
+	b, err := json.Marshal(brokerDeadLetterEnvelope{
+		Payload:   string(m.Value),
+		Error:     cause.Error(),
+		Attempts:  attempts,
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		FailedAt:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return q.pub.Publish(ctx, m.Key, b)
+}
+
+// List 从指定分区的 offset 开始读取最多 limit 条死信。
+func (q *BrokerDLQ) List(ctx context.Context, partition int, offset int64, limit int) ([]DeadLetter, error) {
+	msgs, err := q.reader.Read(ctx, partition, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DeadLetter, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, q.toDeadLetter(ctx, m))
+	}
+	return out, nil
+}
+
+// Get 查询单条死信。
+func (q *BrokerDLQ) Get(ctx context.Context, partition int, offset int64) (DeadLetter, error) {
+	list, err := q.List(ctx, partition, offset, 1)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	if len(list) == 0 || list[0].ID != brokerDeadLetterID(partition, offset) {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return list[0], nil
+}
+
+// Redrive 将死信中的原始 payload 重新发布到下单 topic。
+// 死信 topic 不可删除，因此用 Redis 集合记录已重投的 partition:offset，保证最多重投一次。
+func (q *BrokerDLQ) Redrive(ctx context.Context, partition int, offset int64) error {
+	dl, err := q.Get(ctx, partition, offset)
+	if err != nil {
+		return err
+	}
+
+	key := rediskey.DLQRedrivenKey(q.topic)
+	added, err := q.rdb.SAdd(ctx, key, dl.ID).Result()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return ErrAlreadyRedriven
+	}
+	if err := q.source.Publish(ctx, []byte(dl.Key), []byte(dl.Payload)); err != nil {
+		// 发布失败撤销标记，允许再次重投。
+		_ = q.rdb.SRem(ctx, key, dl.ID).Err()
+		return err
+	}
+	return nil
+}
+
+func (q *BrokerDLQ) toDeadLetter(ctx context.Context, m Message) DeadLetter {
+	out := DeadLetter{
+		ID:     brokerDeadLetterID(m.Partition, m.Offset),
+		Source: "broker",
+		Key:    string(m.Key),
+	}
+	var env brokerDeadLetterEnvelope
+	if err := json.Unmarshal(m.Value, &env); err != nil {
+		out.Payload = string(m.Value)
+		out.Error = fmt.Sprintf("invalid dead letter envelope: %v", err)
+	} else {
+		out.SourceID = brokerDeadLetterID(env.Partition, env.Offset)
+		out.Payload = env.Payload
+		out.Error = env.Error
+		out.Attempts = env.Attempts
+		out.FailedAt = env.FailedAt
+	}
+	out.Redriven, _ = q.rdb.SIsMember(ctx, rediskey.DLQRedrivenKey(q.topic), out.ID).Result()
+	return out
+}
+
+func brokerDeadLetterID(partition int, offset int64) string {
+	return fmt.Sprintf("%d:%d", partition, offset)
+}
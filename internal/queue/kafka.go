@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaBroker 是基于 segmentio/kafka-go 的 Broker 实现。
+type KafkaBroker struct {
+	brokers []string
+}
+
+func NewKafkaBroker(brokers []string) *KafkaBroker {
+	return &KafkaBroker{brokers: brokers}
+}
+
+// Publisher 创建生产者并配置可靠性参数：
+// - Hash + Key: 相同 key 尽量落到同一分区，便于讨论有序性。
+// - RequireAll: 等待 ISR 副本确认，降低消息丢失风险。
+// - MaxAttempts/Timeout: 控制重试与超时边界。
+func (b *KafkaBroker) Publisher(topic string) Publisher {
+	return &kafkaPublisher{
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(b.brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  5,
+			WriteTimeout: 5 * time.Second,
+			ReadTimeout:  5 * time.Second,
+			BatchTimeout: 50 * time.Millisecond,
+		},
+	}
+}
+
+// Subscriber 创建消费者。
+// 注意：这里使用手动提交 offset（CommitInterval=0），
+// 只有业务处理成功后才 commit，避免“先提交后失败”导致消息丢处理。
+func (b *KafkaBroker) Subscriber(topic, group string) Subscriber {
+	return &kafkaSubscriber{
+		r: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  b.brokers,
+			Topic:    topic,
+			GroupID:  group,
+			MinBytes: 1e3,
+			MaxBytes: 1e6,
+			// We commit offsets manually after successful processing.
+			CommitInterval: 0,
+			StartOffset:    kafka.FirstOffset,
+		}),
+	}
+}
+
+// TopicReader 直连分区 leader 按 offset 读取。
+func (b *KafkaBroker) TopicReader(topic string) TopicReader {
+	return &kafkaTopicReader{brokers: b.brokers, topic: topic}
+}
+
+// kafkaPublisher 封装 Kafka 写入器。
+type kafkaPublisher struct {
+	w *kafka.Writer
+}
+
+// Publish 同步写入一条消息。
+func (p *kafkaPublisher) Publish(ctx context.Context, key, value []byte) error {
+	return p.w.WriteMessages(ctx, kafka.Message{
+		Key:   key,
+		Value: value,
+	})
+}
+
+// Close 释放 writer 资源。
+func (p *kafkaPublisher) Close() error { return p.w.Close() }
+
+// kafkaSubscriber 封装 Kafka 消费者组 reader。
+type kafkaSubscriber struct {
+	r *kafka.Reader
+}
+
+// Fetch 拉取一条消息（不自动提交）。
+func (s *kafkaSubscriber) Fetch(ctx context.Context) (Message, error) {
+	m, err := s.r.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	return fromKafkaMessage(m), nil
+}
+
+// Commit 提交该消息所在分区的 offset。
+func (s *kafkaSubscriber) Commit(ctx context.Context, m Message) error {
+	return s.r.CommitMessages(ctx, kafka.Message{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+	})
+}
+
+// Close 释放 reader 资源。
+func (s *kafkaSubscriber) Close() error { return s.r.Close() }
+
+// kafkaTopicReader 不加入消费者组，直接读取分区数据。
+type kafkaTopicReader struct {
+	brokers []string
+	topic   string
+}
+
+func (t *kafkaTopicReader) Read(ctx context.Context, partition int, offset int64, limit int) ([]Message, error) {
+	conn, err := kafka.DialLeader(ctx, "tcp", t.brokers[0], t.topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return nil, err
+	}
+	if offset < first {
+		offset = first
+	}
+	if offset >= last || limit <= 0 {
+		return []Message{}, nil
+	}
+	if _, err := conn.Seek(offset, kafka.SeekAbsolute); err != nil {
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	batch := conn.ReadBatch(1, 10e6)
+	defer batch.Close()
+
+	out := make([]Message, 0, limit)
+	for len(out) < limit {
+		m, err := batch.ReadMessage()
+		if err != nil {
+			break
+		}
+		msg := fromKafkaMessage(m)
+		msg.Topic = t.topic
+		msg.Partition = partition
+		out = append(out, msg)
+		if m.Offset+1 >= last {
+			break
+		}
+	}
+	return out, nil
+}
+
+func fromKafkaMessage(m kafka.Message) Message {
+	return Message{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       m.Key,
+		Value:     m.Value,
+	}
+}
@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errBrokerClosed 表示 MemoryBroker 的读写端已关闭。
+var errBrokerClosed = errors.New("memory broker closed")
+
+// MemoryBroker 是进程内的 Broker 实现：每个 topic 是一个只追加的单分区日志，
+// 消费者组各自维护位点，新消息通过 channel 广播唤醒等待中的 Fetch。
+// 数据不落盘、进程退出即丢失，仅用于本地开发与 CI（只需 Redis + DB 即可跑通全链路）。
+type MemoryBroker struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	msgs []Message
+	// notify 在每次追加后被 close 并替换，等待者据此被唤醒。
+	notify chan struct{}
+	// cursors 记录各消费者组下一条待拉取的 offset。
+	cursors map[string]int64
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{topics: make(map[string]*memoryTopic)}
+}
+
+func (b *MemoryBroker) Publisher(topic string) Publisher {
+	return &memoryPublisher{b: b, topic: topic}
+}
+
+func (b *MemoryBroker) Subscriber(topic, group string) Subscriber {
+	return &memorySubscriber{b: b, topic: topic, group: group, done: make(chan struct{})}
+}
+
+func (b *MemoryBroker) TopicReader(topic string) TopicReader {
+	return &memoryTopicReader{b: b, topic: topic}
+}
+
+// topicLocked 返回（必要时创建）topic，调用方需持有 b.mu。
+func (b *MemoryBroker) topicLocked(name string) *memoryTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{notify: make(chan struct{}), cursors: make(map[string]int64)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+type memoryPublisher struct {
+	b     *MemoryBroker
+	topic string
+}
+
+func (p *memoryPublisher) Publish(ctx context.Context, key, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.b.mu.Lock()
+	defer p.b.mu.Unlock()
+
+	t := p.b.topicLocked(p.topic)
+	t.msgs = append(t.msgs, Message{
+		Topic:  p.topic,
+		Offset: int64(len(t.msgs)),
+		Key:    append([]byte(nil), key...),
+		Value:  append([]byte(nil), value...),
+	})
+	close(t.notify)
+	t.notify = make(chan struct{})
+	return nil
+}
+
+func (p *memoryPublisher) Close() error { return nil }
+
+type memorySubscriber struct {
+	b     *MemoryBroker
+	topic string
+	group string
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Fetch 返回组内下一条消息；没有新消息时阻塞直到有消息、ctx 取消或 Close。
+// 与 Kafka 一致，拉取即推进组内读取位置，未 Commit 的消息由调用方原地重试。
+func (s *memorySubscriber) Fetch(ctx context.Context) (Message, error) {
+	for {
+		s.b.mu.Lock()
+		t := s.b.topicLocked(s.topic)
+		cursor := t.cursors[s.group]
+		if cursor < int64(len(t.msgs)) {
+			m := t.msgs[cursor]
+			t.cursors[s.group] = cursor + 1
+			s.b.mu.Unlock()
+			return m, nil
+		}
+		wait := t.notify
+		s.b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-s.done:
+			return Message{}, errBrokerClosed
+		case <-wait:
+		}
+	}
+}
+
+// Commit 在内存实现中无需持久化位点。
+func (s *memorySubscriber) Commit(ctx context.Context, m Message) error { return nil }
+
+func (s *memorySubscriber) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+type memoryTopicReader struct {
+	b     *MemoryBroker
+	topic string
+}
+
+// Read 内存 topic 只有一个分区（0）。
+func (r *memoryTopicReader) Read(ctx context.Context, partition int, offset int64, limit int) ([]Message, error) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+
+	out := []Message{}
+	if partition != 0 || limit <= 0 {
+		return out, nil
+	}
+	t := r.b.topicLocked(r.topic)
+	if offset < 0 {
+		offset = 0
+	}
+	for i := offset; i < int64(len(t.msgs)) && len(out) < limit; i++ {
+		out = append(out, t.msgs[i])
+	}
+	return out, nil
+}
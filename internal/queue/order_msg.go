@@ -1,11 +1,16 @@
 package queue
 
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
 
-// OrderMessage 是写入 Kafka 的订单创建事件。
+// OrderMessage 是写入 Broker 的订单创建事件。
 type OrderMessage struct {
 	RequestID string `json:"request_id"`
 	ProductID uint   `json:"product_id"`
+	SKUID     uint   `json:"sku_id"` // 0 表示商品无 SKU
 	UserID    int64  `json:"user_id"`
 	Quantity  int    `json:"quantity"`
 	Amount    int64  `json:"amount"` // 分
@@ -30,3 +35,13 @@ func (m OrderMessage) Validate() error {
 	}
 	return nil
 }
+
+// publishOrder 同步写入一条下单消息。
+// 这里使用 request_id 作为消息 key，保证同请求天然幂等标识。
+func publishOrder(ctx context.Context, pub Publisher, msg OrderMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return pub.Publish(ctx, []byte(msg.RequestID), b)
+}
@@ -9,32 +9,53 @@ import (
 	"strings"
 	"time"
 
+	rediskey "flash_sale/pkg/redis"
+
 	rd "github.com/redis/go-redis/v9"
 )
 
-// Relay 将 Redis Stream 事件异步转发到 Kafka。
-// 语义：发布 Kafka 成功后才 ACK Stream，失败则保留消息等待重试。
+// ClaimPolicy 控制 Relay 接管其他（已宕机）实例 pending 消息的策略。
+type ClaimPolicy struct {
+	// MinIdle 消息在 pending 列表中空闲超过该时长才会被接管。
+	MinIdle time.Duration
+	// Interval 两次接管扫描之间的最小间隔。
+	Interval time.Duration
+	// MaxClaims 单条消息最多被接管的次数，超过则视为毒消息转入死信流。
+	MaxClaims int
+}
+
+// Relay 将 Redis Stream 事件异步转发到 Broker（Kafka / 内存）。
+// 语义：发布成功后才 ACK Stream，失败则保留消息、退避后重试；只有无法解析的脏消息与反复被接管的毒消息转入死信。
 type Relay struct {
-	rdb      *rd.Client
-	producer *Producer
+	rdb       *rd.Client
+	publisher Publisher
 
 	stream   string
 	group    string
 	consumer string
+
+	claim       ClaimPolicy
+	claimCursor string
+	lastClaim   time.Time
+
+	// failures 连续发布失败的次数，只用于退避，不作为转入死信的依据。
+	failures int
 }
 
-func NewRelay(rdb *rd.Client, producer *Producer, stream, group, consumer string) *Relay {
+func NewRelay(rdb *rd.Client, publisher Publisher, stream, group, consumer string, claim ClaimPolicy) *Relay {
 	return &Relay{
-		rdb:      rdb,
-		producer: producer,
-		stream:   stream,
-		group:    group,
-		consumer: consumer,
+		rdb:         rdb,
+		publisher:   publisher,
+		stream:      stream,
+		group:       group,
+		consumer:    consumer,
+		claim:       claim,
+		claimCursor: "0-0",
 	}
 }
 
 func (r *Relay) Run(ctx context.Context) {
-	if err := r.ensureGroup(ctx); err != nil {
+	if err := ensureStreamGroup(ctx, r.rdb, r.stream, r.group); err != nil {
 		log.Printf("relay ensure group: %v", err)
 		return
 	}
@@ -44,6 +65,17 @@ func (r *Relay) Run(ctx context.Context) {
 			return
 		}
 
+		// 定期接管其他实例遗留的僵尸 pending（实例宕机后其未 ACK 消息不会被自动转移）。
+		if time.Since(r.lastClaim) >= r.claim.Interval {
+			r.lastClaim = time.Now()
+			if err := r.reclaimStale(ctx); err != nil {
+				if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+					return
+				}
+				log.Printf("relay reclaim stale: %v", err)
+			}
+		}
+
 		// 先尝试处理当前消费者历史 pending，避免遗留消息长期堆积。
 		msgs, err := r.readGroup(ctx, "0", 0)
 		if err != nil {
@@ -68,17 +100,23 @@ func (r *Relay) Run(ctx context.Context) {
 
 		for _, xm := range msgs {
 			if err := r.processOne(ctx, xm); err != nil {
-				// 发布失败不 ACK，消息会继续保留用于重试。
-				log.Printf("relay process message id=%s: %v", xm.ID, err)
-				time.Sleep(200 * time.Millisecond)
+				// Broker / Redis 故障：不 ACK、不计入死信，消息保留在 pending 中退避后重试。
+				// 故障期间宁可阻塞转发，也不把已扣库存的有效请求写进死信。
+				r.failures++
+				log.Printf("relay process message id=%s failures=%d: %v", xm.ID, r.failures, err)
+				if !sleepCtx(ctx, retryBackoff(r.failures)) {
+					return
+				}
 				break
 			}
+			r.failures = 0
 		}
 	}
 }
 
-func (r *Relay) ensureGroup(ctx context.Context) error {
-	err := r.rdb.XGroupCreateMkStream(ctx, r.stream, r.group, "0").Err()
+// ensureStreamGroup 创建消费者组（stream 不存在时一并创建），组已存在视为成功。
+func ensureStreamGroup(ctx context.Context, rdb *rd.Client, stream, group string) error {
+	err := rdb.XGroupCreateMkStream(ctx, stream, group, "0").Err()
 	if err == nil {
 		return nil
 	}
@@ -89,10 +127,15 @@ func (r *Relay) ensureGroup(ctx context.Context) error {
 }
 
 func (r *Relay) readGroup(ctx context.Context, streamID string, block time.Duration) ([]rd.XMessage, error) {
-	streams, err := r.rdb.XReadGroup(ctx, &rd.XReadGroupArgs{
-		Group:    r.group,
-		Consumer: r.consumer,
-		Streams:  []string{r.stream, streamID},
+	return readStreamGroup(ctx, r.rdb, r.stream, r.group, r.consumer, streamID, block)
+}
+
+// readStreamGroup 以消费者组身份读取：streamID="0" 读本消费者 pending，">" 读新消息。
+func readStreamGroup(ctx context.Context, rdb *rd.Client, stream, group, consumer, streamID string, block time.Duration) ([]rd.XMessage, error) {
+	streams, err := rdb.XReadGroup(ctx, &rd.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, streamID},
 		Count:    16,
 		Block:    block,
 		NoAck:    false,
@@ -110,20 +153,77 @@ func (r *Relay) readGroup(ctx context.Context, streamID string, block time.Durat
 	return out, nil
 }
 
+// reclaimStale 通过 XAUTOCLAIM 接管空闲超过 MinIdle 的 pending 消息并立即处理。
+// 每次接管都会累加接管计数，超过 MaxClaims 的消息转入死信流，避免在实例间无限漂移。
+func (r *Relay) reclaimStale(ctx context.Context) error {
+	msgs, next, err := r.rdb.XAutoClaim(ctx, &rd.XAutoClaimArgs{
+		Stream:   r.stream,
+		Group:    r.group,
+		MinIdle:  r.claim.MinIdle,
+		Start:    r.claimCursor,
+		Count:    16,
+		Consumer: r.consumer,
+	}).Result()
+	if err != nil {
+		if errors.Is(err, rd.Nil) {
+			return nil
+		}
+		return err
+	}
+	// 游标回到 0-0 表示本轮已扫完整个 pending 列表。
+	r.claimCursor = next
+	if r.claimCursor == "" {
+		r.claimCursor = "0-0"
+	}
+
+	for _, xm := range msgs {
+		claims, err := r.rdb.HIncrBy(ctx, rediskey.StreamClaimCountKey(r.stream), xm.ID, 1).Result()
+		if err != nil {
+			return err
+		}
+		log.Printf("relay claimed stale message id=%s claims=%d", xm.ID, claims)
+
+		if r.claim.MaxClaims > 0 && claims > int64(r.claim.MaxClaims) {
+			if err := r.deadLetter(ctx, xm, fmt.Sprintf("claimed %d times", claims), claims); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.processOne(ctx, xm); err != nil {
+			// 与常规路径一致：失败不 ACK，消息仍归本实例 pending，稍后重试。
+			log.Printf("relay process claimed message id=%s: %v", xm.ID, err)
+			return nil
+		}
+	}
+	return nil
+}
+
+// deadLetter 将消息转入死信流并 ACK + 删除原消息。
+func (r *Relay) deadLetter(ctx context.Context, xm rd.XMessage, reason string, attempts int64) error {
+	err := deadLetterStreamEntry(ctx, r.rdb, r.stream, r.group, xm, reason, attempts)
+	if err == nil {
+		log.Printf("relay dead-lettered message id=%s attempts=%d: %s", xm.ID, attempts, reason)
+	}
+	return err
+}
+
 func (r *Relay) processOne(ctx context.Context, xm rd.XMessage) error {
 	msg, err := parseOrderEvent(xm.Values)
 	if err != nil {
-		// 脏消息直接 ACK 丢弃，避免阻塞队列。
-		if ackErr := r.ackAndDelete(ctx, xm.ID); ackErr != nil {
-			return fmt.Errorf("parse failed: %v, ack failed: %w", err, ackErr)
-		}
-		return nil
+		// 脏消息重试也不会成功，直接转入死信流，避免阻塞队列。
+		return r.deadLetter(ctx, xm, fmt.Sprintf("parse: %v", err), 1)
+	}
+
+	// 发布前登记：消息一旦进入 Broker 就离开了 outbox，清扫任务据此知道请求仍在链路中。
+	// 先登记再发布，避免 Consumer 已落终态（并移除登记）之后才登记。
+	if err := r.rdb.SAdd(ctx, rediskey.RelayedRequestsKey(), msg.RequestID).Err(); err != nil {
+		return err
 	}
 
 	pubCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
-	if err := r.producer.Publish(pubCtx, msg); err != nil {
-		return err
+	if err := publishOrder(pubCtx, r.publisher, msg); err != nil {
+		return fmt.Errorf("publish: %w", err)
 	}
 	return r.ackAndDelete(ctx, xm.ID)
 }
@@ -132,6 +232,7 @@ func (r *Relay) ackAndDelete(ctx context.Context, id string) error {
 	pipe := r.rdb.TxPipeline()
 	pipe.XAck(ctx, r.stream, r.group, id)
 	pipe.XDel(ctx, r.stream, id)
+	pipe.HDel(ctx, rediskey.StreamClaimCountKey(r.stream), id)
 	_, err := pipe.Exec(ctx)
 	return err
 }
@@ -162,6 +263,13 @@ func parseOrderEvent(values map[string]interface{}) (OrderMessage, error) {
 	if err != nil {
 		return OrderMessage{}, fmt.Errorf("invalid product_id %q", productStr)
 	}
+	// sku_id 可缺省：兼容引入 SKU 之前写入 stream 的事件。
+	var skuID64 uint64
+	if skuStr, err := getStreamString(values, "sku_id"); err == nil {
+		if skuID64, err = strconv.ParseUint(skuStr, 10, 64); err != nil {
+			return OrderMessage{}, fmt.Errorf("invalid sku_id %q", skuStr)
+		}
+	}
 	userID, err := strconv.ParseInt(userStr, 10, 64)
 	if err != nil {
 		return OrderMessage{}, fmt.Errorf("invalid user_id %q", userStr)
@@ -178,6 +286,7 @@ func parseOrderEvent(values map[string]interface{}) (OrderMessage, error) {
 	msg := OrderMessage{
 		RequestID: requestID,
 		ProductID: uint(productID64),
+		SKUID:     uint(skuID64),
 		UserID:    userID,
 		Quantity:  quantity,
 		Amount:    amount,
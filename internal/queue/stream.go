@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// StreamSubscriber 让 Consumer 直接以消费者组身份读取 Redis Stream outbox，跳过 Relay 与 Kafka。
+// 语义与 Broker 一致：Fetch 不 ACK，业务事务提交后 Commit 才 XACK + XDEL（at-least-once）。
+// 多副本时通过 XAUTOCLAIM 接管宕机实例遗留的 pending 消息；与 Relay 一致累加接管计数，
+// 超过 ClaimPolicy.MaxClaims 的消息直接转入死信流，避免在实例间无限漂移。
+type StreamSubscriber struct {
+	rdb      *rd.Client
+	stream   string
+	group    string
+	consumer string
+
+	claim       ClaimPolicy
+	claimCursor string
+	lastClaim   time.Time
+
+	groupReady bool
+	buf        []Message
+}
+
+func NewStreamSubscriber(rdb *rd.Client, stream, group, consumer string, claim ClaimPolicy) *StreamSubscriber {
+	return &StreamSubscriber{
+		rdb:         rdb,
+		stream:      stream,
+		group:       group,
+		consumer:    consumer,
+		claim:       claim,
+		claimCursor: "0-0",
+	}
+}
+
+// Fetch 依次尝试：缓冲区 -> 接管僵尸 pending -> 本消费者 pending -> 阻塞读新消息。
+func (s *StreamSubscriber) Fetch(ctx context.Context) (Message, error) {
+	if !s.groupReady {
+		if err := ensureStreamGroup(ctx, s.rdb, s.stream, s.group); err != nil {
+			return Message{}, err
+		}
+		s.groupReady = true
+	}
+
+	for len(s.buf) == 0 {
+		if err := ctx.Err(); err != nil {
+			return Message{}, err
+		}
+		msgs, err := s.read(ctx)
+		if err != nil {
+			return Message{}, err
+		}
+		for _, xm := range msgs {
+			s.buf = append(s.buf, s.toMessage(xm))
+		}
+	}
+
+	m := s.buf[0]
+	s.buf = s.buf[1:]
+	return m, nil
+}
+
+func (s *StreamSubscriber) read(ctx context.Context) ([]rd.XMessage, error) {
+	if time.Since(s.lastClaim) >= s.claim.Interval {
+		s.lastClaim = time.Now()
+		msgs, next, err := s.rdb.XAutoClaim(ctx, &rd.XAutoClaimArgs{
+			Stream:   s.stream,
+			Group:    s.group,
+			MinIdle:  s.claim.MinIdle,
+			Start:    s.claimCursor,
+			Count:    16,
+			Consumer: s.consumer,
+		}).Result()
+		if err != nil && !errors.Is(err, rd.Nil) {
+			return nil, err
+		}
+		s.claimCursor = next
+		if s.claimCursor == "" {
+			s.claimCursor = "0-0"
+		}
+		if len(msgs) > 0 {
+			log.Printf("stream subscriber claimed %d stale messages", len(msgs))
+			if msgs, err = s.admitClaimed(ctx, msgs); err != nil || len(msgs) > 0 {
+				return msgs, err
+			}
+		}
+	}
+
+	msgs, err := readStreamGroup(ctx, s.rdb, s.stream, s.group, s.consumer, "0", 0)
+	if err != nil || len(msgs) > 0 {
+		return msgs, err
+	}
+	return readStreamGroup(ctx, s.rdb, s.stream, s.group, s.consumer, ">", 2*time.Second)
+}
+
+// admitClaimed 累加接管计数，超过 MaxClaims 的消息转入死信流，返回其余可交给 Consumer 的消息。
+func (s *StreamSubscriber) admitClaimed(ctx context.Context, msgs []rd.XMessage) ([]rd.XMessage, error) {
+	out := msgs[:0]
+	for _, xm := range msgs {
+		claims, err := s.rdb.HIncrBy(ctx, rediskey.StreamClaimCountKey(s.stream), xm.ID, 1).Result()
+		if err != nil {
+			return nil, err
+		}
+		if s.claim.MaxClaims > 0 && claims > int64(s.claim.MaxClaims) {
+			reason := fmt.Sprintf("claimed %d times", claims)
+			if err := deadLetterStreamEntry(ctx, s.rdb, s.stream, s.group, xm, reason, claims); err != nil {
+				return nil, err
+			}
+			log.Printf("stream subscriber dead-lettered message id=%s claims=%d", xm.ID, claims)
+			continue
+		}
+		out = append(out, xm)
+	}
+	return out, nil
+}
+
+// toMessage 将 stream 字段转换为与 Broker 一致的 JSON OrderMessage。
+// 无法解析的条目保留原始字段 JSON，交由 Consumer 判定为毒消息并写入死信。
+func (s *StreamSubscriber) toMessage(xm rd.XMessage) Message {
+	m := Message{Topic: s.stream, ID: xm.ID}
+	if msg, err := parseOrderEvent(xm.Values); err == nil {
+		m.Key = []byte(msg.RequestID)
+		m.Value, _ = json.Marshal(msg)
+		return m
+	}
+	raw := make(map[string]string, len(xm.Values))
+	for k := range xm.Values {
+		raw[k], _ = getStreamString(xm.Values, k)
+	}
+	m.Key = []byte(raw["request_id"])
+	m.Value, _ = json.Marshal(raw)
+	return m
+}
+
+// Commit 在同一事务中 XACK + XDEL，并清理接管/重试计数。
+func (s *StreamSubscriber) Commit(ctx context.Context, m Message) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.XAck(ctx, s.stream, s.group, m.ID)
+	pipe.XDel(ctx, s.stream, m.ID)
+	pipe.HDel(ctx, rediskey.StreamClaimCountKey(s.stream), m.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Close 无需释放资源（Redis 客户端由调用方管理）。
+func (s *StreamSubscriber) Close() error { return nil }
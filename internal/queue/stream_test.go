@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"context"
+	"testing"
+
+	"flash_sale/internal/storage/storagetest"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// TestStreamSubscriberMaxClaims 反复被接管的消息超过 MaxClaims 后转入死信流，不再交给 Consumer。
+func TestStreamSubscriberMaxClaims(t *testing.T) {
+	ctx := context.Background()
+	rdb := storagetest.OpenRedis(t)
+	const stream, group = "stream:test", "consumers"
+
+	if err := ensureStreamGroup(ctx, rdb, stream, group); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	id, err := rdb.XAdd(ctx, &rd.XAddArgs{Stream: stream, Values: map[string]interface{}{"request_id": "req-1"}}).Result()
+	if err != nil {
+		t.Fatalf("xadd: %v", err)
+	}
+	// 模拟已宕机的实例：读到消息后未 ACK，消息留在它的 pending 列表中。
+	if _, err := readStreamGroup(ctx, rdb, stream, group, "dead", ">", 0); err != nil {
+		t.Fatalf("read as dead consumer: %v", err)
+	}
+
+	s := NewStreamSubscriber(rdb, stream, group, "alive", ClaimPolicy{MaxClaims: 1})
+	m, err := s.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if m.ID != id {
+		t.Fatalf("fetched %s, want claimed %s", m.ID, id)
+	}
+
+	// 未提交即再次被接管：第 2 次超过上限，转入死信流。
+	msgs, err := s.read(ctx)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("read %d messages, want 0", len(msgs))
+	}
+	dead, err := rdb.XRange(ctx, rediskey.DeadLetterStreamKey(stream), "-", "+").Result()
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("dead letters = %d (%v), want 1", len(dead), err)
+	}
+	if got, _ := getStreamString(dead[0].Values, dlqFieldSourceID); got != id {
+		t.Fatalf("dead letter source = %s, want %s", got, id)
+	}
+	if ok, _ := rdb.SIsMember(ctx, rediskey.DeadLetteredRequestsKey(), "req-1").Result(); !ok {
+		t.Fatalf("request not registered as dead-lettered")
+	}
+	if n, _ := rdb.XLen(ctx, stream).Result(); n != 0 {
+		t.Fatalf("source stream length = %d, want 0", n)
+	}
+	if pending, _ := rdb.XPending(ctx, stream, group).Result(); pending.Count != 0 {
+		t.Fatalf("pending = %d, want 0", pending.Count)
+	}
+}
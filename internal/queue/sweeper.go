@@ -0,0 +1,251 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// reasonLostInPipeline 是清扫任务判定请求丢失时写入的失败原因。
+const reasonLostInPipeline = "lost_in_pipeline"
+
+// PendingSweeper 收敛长时间停留在 pending 的请求（例如 Redis 故障切换后 outbox 条目丢失）。
+// 候选来源：Redis pending 时间索引 + DB 中超时未终态的 order_requests；
+// 仍在 outbox、已交给 Relay 发布到 Broker 或停在死信中的请求视为仍在链路中，跳过（见 inFlightRequestIDs）。
+// 对每个候选：已有订单则补齐为成功；否则先在 DB 落 failed（之后 Consumer 即使收到该消息也不会再建单），
+// 再按 request_id 幂等回补库存与限购额度。
+type PendingSweeper struct {
+	db        *gorm.DB
+	store     repository.Store
+	states    repository.RequestStateCache
+	inventory repository.Inventory
+	rdb       *rd.Client
+	stream    string
+
+	threshold time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+func NewPendingSweeper(db *gorm.DB, rdb *rd.Client, stream string, threshold, interval time.Duration, batchSize int) *PendingSweeper {
+	return &PendingSweeper{
+		db:        db,
+		store:     repository.NewGormStore(db),
+		states:    repository.NewRedisStateCache(rdb),
+		inventory: repository.NewRedisInventory(rdb, stream),
+		rdb:       rdb,
+		stream:    stream,
+		threshold: threshold,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (s *PendingSweeper) Run(ctx context.Context) {
+	ctx = audit.WithActor(ctx, "system:sweeper")
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sweep(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("pending sweeper: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *PendingSweeper) sweep(ctx context.Context) error {
+	cutoff := time.Now().Add(-s.threshold)
+
+	ids, err := s.rdb.ZRangeByScore(ctx, rediskey.PendingRequestsKey(), &rd.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(cutoff.UnixMilli(), 10),
+		Count: int64(s.batchSize),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	var stale []string
+	if err := s.db.WithContext(ctx).Model(&model.OrderRequest{}).
+		Where("status = ? AND updated_at < ?", model.OrderRequestPending, cutoff).
+		Order("id ASC").
+		Limit(s.batchSize).
+		Pluck("request_id", &stale).Error; err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(ids)+len(stale))
+	candidates := make([]string, 0, len(ids)+len(stale))
+	for _, id := range append(ids, stale...) {
+		if !seen[id] {
+			seen[id] = true
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	inFlight, err := s.inFlightRequestIDs(ctx, candidates)
+	if err != nil {
+		return err
+	}
+	for _, id := range candidates {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if inFlight[id] {
+			continue
+		}
+		if err := s.resolve(ctx, id); err != nil {
+			log.Printf("pending sweeper resolve request_id=%s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// inFlightRequestIDs 找出候选中仍在链路里的请求（排队中、已交给 Broker 或等待人工重投，均不算丢失）：
+//   - 请求状态中记录的 outbox entry 仍在 outbox 中（未读取或已读取未确认，按 ID 定位，不扫描整个流）
+//   - 已登记为交给 Relay 发布（之后可能仍在 Broker 中等待消费，或停在 Broker 死信 topic）
+//   - 已登记为停在 Redis 死信流
+func (s *PendingSweeper) inFlightRequestIDs(ctx context.Context, candidates []string) (map[string]bool, error) {
+	pipe := s.rdb.Pipeline()
+	eventIDs := make([]*rd.StringCmd, len(candidates))
+	relayed := make([]*rd.BoolCmd, len(candidates))
+	deadLettered := make([]*rd.BoolCmd, len(candidates))
+	for i, id := range candidates {
+		eventIDs[i] = pipe.HGet(ctx, rediskey.RequestStatusKey(id), "event_id")
+		relayed[i] = pipe.SIsMember(ctx, rediskey.RelayedRequestsKey(), id)
+		deadLettered[i] = pipe.SIsMember(ctx, rediskey.DeadLetteredRequestsKey(), id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, rd.Nil) {
+		return nil, err
+	}
+
+	out := make(map[string]bool)
+	entries := make(map[string]*rd.XMessageSliceCmd)
+	pipe = s.rdb.Pipeline()
+	for i, id := range candidates {
+		if relayed[i].Val() || deadLettered[i].Val() {
+			out[id] = true
+			continue
+		}
+		if eventID := eventIDs[i].Val(); eventID != "" {
+			entries[id] = pipe.XRangeN(ctx, s.stream, eventID, eventID, 1)
+		}
+	}
+	if len(entries) == 0 {
+		return out, nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for id, cmd := range entries {
+		if len(cmd.Val()) > 0 {
+			out[id] = true
+		}
+	}
+	return out, nil
+}
+
+// resolve 将单个滞留请求收敛到终态。
+func (s *PendingSweeper) resolve(ctx context.Context, requestID string) error {
+	// 1) 订单已存在：补齐请求状态为成功。
+	o, err := s.store.Orders().GetByRequestID(ctx, requestID)
+	if err == nil {
+		if err := s.store.Requests().MarkSuccess(ctx, requestID, o.OrderNo); err != nil {
+			return err
+		}
+		return s.states.Put(ctx, rediskey.RequestState{RequestID: requestID, Status: rediskey.RequestSuccess, OrderNo: o.OrderNo}, requestStateTTL)
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	// 2) DB 已是终态：Redis 状态落后，直接同步。
+	req, err := s.store.Requests().Get(ctx, requestID)
+	found := err == nil
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	if found && req.Status == model.OrderRequestFailed {
+		return s.states.Put(ctx, repository.RequestStateOf(req), requestStateTTL)
+	}
+
+	// 3) 判定丢失：需要请求明细（Redis 状态或 DB 行）才能回补。
+	msg, ok, err := s.loadMessage(ctx, requestID, req, found)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Printf("pending sweeper drop request_id=%s: request detail expired, cannot compensate", requestID)
+		return s.rdb.ZRem(ctx, rediskey.PendingRequestsKey(), requestID).Err()
+	}
+
+	// 4) 先在 DB 落 failed：条件更新未命中说明已被 Consumer 抢先处理，下一轮再同步。
+	var marked bool
+	if err := s.store.Transaction(ctx, func(tx repository.Store) error {
+		if err := tx.Requests().UpsertPending(ctx, pendingRequestOf(msg)); err != nil {
+			return err
+		}
+		var err error
+		marked, err = tx.Requests().MarkFailed(ctx, requestID, reasonLostInPipeline)
+		return err
+	}); err != nil {
+		return err
+	}
+	if !marked {
+		return nil
+	}
+
+	// 5) 幂等回补库存（记录审计事件）与限购额度，最后更新 Redis 状态。
+	if err := audit.Compensate(ctx, s.inventory, s.store.Audit(), msg.RequestID, msg.ProductID, msg.SKUID, int64(msg.Quantity)); err != nil {
+		return err
+	}
+	if _, err := s.inventory.ReleaseQuota(ctx, msg.RequestID, msg.ProductID, msg.UserID, int64(msg.Quantity)); err != nil {
+		return err
+	}
+	log.Printf("pending sweeper failed request_id=%s reason=%s", requestID, reasonLostInPipeline)
+	return s.states.Put(ctx, rediskey.RequestState{RequestID: requestID, Status: rediskey.RequestFailed, Reason: reasonLostInPipeline}, requestStateTTL)
+}
+
+// loadMessage 优先用 DB 行还原请求明细，其次用 Redis 请求状态中的字段（由下单 Lua 写入）。
+func (s *PendingSweeper) loadMessage(ctx context.Context, requestID string, req model.OrderRequest, found bool) (OrderMessage, bool, error) {
+	if found {
+		return OrderMessage{
+			RequestID: req.RequestID,
+			ProductID: req.ProductID,
+			SKUID:     req.SKUID,
+			UserID:    req.UserID,
+			Quantity:  req.Quantity,
+			Amount:    req.Amount,
+		}, true, nil
+	}
+	fields, err := s.rdb.HGetAll(ctx, rediskey.RequestStatusKey(requestID)).Result()
+	if err != nil {
+		return OrderMessage{}, false, err
+	}
+	values := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		values[k] = v
+	}
+	msg, err := parseOrderEvent(values)
+	if err != nil {
+		return OrderMessage{}, false, nil
+	}
+	return msg, true, nil
+}
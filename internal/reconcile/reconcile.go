@@ -0,0 +1,533 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/order"
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 对账结果状态。
+const (
+	StatusOK      = "ok"      // Redis 库存与 DB 推算一致，且无待回补请求
+	StatusDrift   = "drift"   // 存在差异或待回补请求
+	StatusMissing = "missing" // Redis 库存键不存在（未预热或活动已清理）
+)
+
+// streamScanBatch 扫描 outbox / 死信流时每批读取的条数。
+const streamScanBatch = 500
+
+// luaCompareAndSetStock 仅当库存仍为对账时读到的值才覆盖，避免覆盖对账期间的新扣减；保留原 TTL。
+const luaCompareAndSetStock = `
+local current = redis.call('GET', KEYS[1])
+if current ~= ARGV[1] then
+  return 0
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+  redis.call('SET', KEYS[1], ARGV[2], 'PX', ttl)
+else
+  redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`
+
+// Item 为单个库存单元（无 SKU 的商品，或某个 SKU）的对账结果。
+// 期望 Redis 库存 = DB 初始库存 - 有效订单件数 - 未落终态请求件数；失败/取消的请求应已回补，不计入。
+type Item struct {
+	ProductID    uint   `json:"product_id"`
+	SKUID        uint   `json:"sku_id"`
+	StockKey     string `json:"stock_key"`
+	InitialStock int64  `json:"initial_stock"`
+	// Sold 待支付 + 已支付订单件数。
+	Sold int64 `json:"sold"`
+	// Pending 未落终态的请求件数：pending 的 order_requests，以及尚未落库的 outbox / 死信流事件、
+	// 已交给 Broker 未消费（含停在 Broker 死信 topic）的请求。
+	Pending int64 `json:"pending"`
+	// Uncompensated 已失败/已取消但 Redis 尚未回补的件数。
+	Uncompensated int64  `json:"uncompensated"`
+	Expected      int64  `json:"expected"`
+	Actual        *int64 `json:"actual"` // nil 表示 Redis 库存键不存在
+	Diff          int64  `json:"diff"`   // actual - expected，负数表示 Redis 少于应有库存
+	Status        string `json:"status"`
+
+	PendingRequestIDs       []string `json:"pending_request_ids,omitempty"`
+	UncompensatedRequestIDs []string `json:"uncompensated_request_ids,omitempty"`
+
+	Repaired    bool   `json:"repaired,omitempty"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// Report 为一次对账的完整结果。
+type Report struct {
+	Apply     bool      `json:"apply"`
+	CheckedAt time.Time `json:"checked_at"`
+	Items     []Item    `json:"items"`
+	Drifted   int       `json:"drifted"`
+	// UnresolvedRequestIDs 已交给 Broker 或停在死信中、但请求状态已过期的请求：无法判定其商品与件数，
+	// 期望库存可能偏高，此时不做 compare-and-set 校正。
+	UnresolvedRequestIDs []string `json:"unresolved_request_ids,omitempty"`
+}
+
+// Reconciler 对比 Redis 库存与 DB（products/skus、orders、order_requests）推算出的应有库存。
+// Broker 中尚未消费的消息既不在 outbox 也不在 DB，按 Relay 登记的请求集合与请求状态计入未落终态件数。
+type Reconciler struct {
+	db     *gorm.DB
+	rdb    *rd.Client
+	stream string
+}
+
+func NewReconciler(db *gorm.DB, rdb *rd.Client, stream string) *Reconciler {
+	return &Reconciler{db: db, rdb: rdb, stream: stream}
+}
+
+type unitKey struct {
+	productID uint
+	skuID     uint
+}
+
+// reservation 是一条已在 Redis 扣减过库存的请求。
+type reservation struct {
+	RequestID string
+	UserID    int64
+	ProductID uint
+	SKUID     uint `gorm:"column:sku_id"`
+	Quantity  int64
+	// order 非空表示来自已取消订单（修复时走 order.ReleaseReservation）。
+	order *model.Order
+}
+
+func (r reservation) unit() unitKey { return unitKey{r.ProductID, r.SKUID} }
+
+// Run 对指定商品（为空表示全部）对账。apply=true 时修复：
+// 1) 对未回补的失败请求/取消订单按 request_id 幂等回补库存与限购额度；
+// 2) 仍有差异、无未落终态请求且无法判定的请求时，以 compare-and-set 将 Redis 库存校正为期望值。
+func (r *Reconciler) Run(ctx context.Context, productIDs []uint, apply bool) (Report, error) {
+	items, uncompensated, unresolved, err := r.check(ctx, productIDs)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if apply {
+		for i := range items {
+			if items[i].Status != StatusDrift {
+				continue
+			}
+			if err := r.repair(ctx, &items[i], uncompensated[unitKey{items[i].ProductID, items[i].SKUID}], unresolved); err != nil {
+				items[i].RepairError = err.Error()
+			}
+		}
+		// 修复后重新对账，报告反映修复后的真实状态。
+		fixed, _, unresolvedAfter, err := r.check(ctx, productIDs)
+		if err != nil {
+			return Report{}, err
+		}
+		for i := range fixed {
+			if i >= len(items) || fixed[i].StockKey != items[i].StockKey {
+				break
+			}
+			fixed[i].Repaired = items[i].Repaired
+			fixed[i].RepairError = items[i].RepairError
+		}
+		items, unresolved = fixed, unresolvedAfter
+	}
+
+	out := Report{Apply: apply, CheckedAt: time.Now(), Items: items, UnresolvedRequestIDs: unresolved}
+	for _, it := range items {
+		if it.Status == StatusDrift {
+			out.Drifted++
+		}
+	}
+	return out, nil
+}
+
+func (r *Reconciler) check(ctx context.Context, productIDs []uint) ([]Item, map[unitKey][]reservation, []string, error) {
+	db := r.db.WithContext(ctx)
+
+	var products []model.Product
+	q := db.Preload("SKUs").Order("id ASC")
+	if len(productIDs) > 0 {
+		q = q.Where("id IN ?", productIDs)
+	}
+	if err := q.Find(&products).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	if len(products) == 0 {
+		return []Item{}, nil, nil, nil
+	}
+	ids := make([]uint, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+
+	sold, err := r.soldByUnit(db, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pending, unresolved, err := r.pendingReservations(ctx, db, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	uncompensated, err := r.uncompensatedReservations(ctx, db, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	items := make([]Item, 0, len(products))
+	for _, p := range products {
+		if len(p.SKUs) == 0 {
+			items = append(items, Item{ProductID: p.ID, InitialStock: p.Stock})
+			continue
+		}
+		for _, sku := range p.SKUs {
+			items = append(items, Item{ProductID: p.ID, SKUID: sku.ID, InitialStock: sku.Stock})
+		}
+	}
+
+	pipe := r.rdb.Pipeline()
+	gets := make([]*rd.StringCmd, len(items))
+	for i := range items {
+		items[i].StockKey = rediskey.StockKey(items[i].ProductID, items[i].SKUID)
+		gets[i] = pipe.Get(ctx, items[i].StockKey)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, rd.Nil) {
+		return nil, nil, nil, err
+	}
+
+	for i := range items {
+		it := &items[i]
+		u := unitKey{it.ProductID, it.SKUID}
+		it.Sold = sold[u]
+		for _, res := range pending[u] {
+			it.Pending += res.Quantity
+			it.PendingRequestIDs = append(it.PendingRequestIDs, res.RequestID)
+		}
+		for _, res := range uncompensated[u] {
+			it.Uncompensated += res.Quantity
+			it.UncompensatedRequestIDs = append(it.UncompensatedRequestIDs, res.RequestID)
+		}
+		it.Expected = it.InitialStock - it.Sold - it.Pending
+
+		actual, err := gets[i].Int64()
+		switch {
+		case errors.Is(err, rd.Nil):
+			it.Status = StatusMissing
+			continue
+		case err != nil:
+			return nil, nil, nil, err
+		}
+		it.Actual = &actual
+		it.Diff = actual - it.Expected
+		if it.Diff == 0 && it.Uncompensated == 0 {
+			it.Status = StatusOK
+		} else {
+			it.Status = StatusDrift
+		}
+	}
+	return items, uncompensated, unresolved, nil
+}
+
+// soldByUnit 统计待支付 + 已支付订单件数。
+func (r *Reconciler) soldByUnit(db *gorm.DB, productIDs []uint) (map[unitKey]int64, error) {
+	var rows []struct {
+		ProductID uint
+		SKUID     uint `gorm:"column:sku_id"`
+		Quantity  int64
+	}
+	if err := db.Model(&model.Order{}).
+		Select("product_id, sku_id, SUM(quantity) AS quantity").
+		Where("product_id IN ? AND status IN ?", productIDs, []model.OrderStatus{model.OrderStatusPendingPayment, model.OrderStatusPaid}).
+		Group("product_id, sku_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[unitKey]int64, len(rows))
+	for _, row := range rows {
+		out[unitKey{row.ProductID, row.SKUID}] = row.Quantity
+	}
+	return out, nil
+}
+
+// pendingReservations 收集已扣 Redis 库存但尚未落终态的请求：DB 中 pending 的 order_requests，
+// 以及还没有 order_requests 记录的 outbox / 死信流事件和已交给 Broker 的请求；
+// 同时返回请求状态已过期、无法判定的请求 ID。
+func (r *Reconciler) pendingReservations(ctx context.Context, db *gorm.DB, productIDs []uint) (map[unitKey][]reservation, []string, error) {
+	var rows []reservation
+	if err := db.Model(&model.OrderRequest{}).
+		Select("request_id, user_id, product_id, sku_id, quantity").
+		Where("product_id IN ? AND status = ?", productIDs, model.OrderRequestPending).
+		Scan(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	wanted := make(map[uint]bool, len(productIDs))
+	for _, id := range productIDs {
+		wanted[id] = true
+	}
+	var inFlight []reservation
+	for _, stream := range []string{r.stream, rediskey.DeadLetterStreamKey(r.stream)} {
+		list, err := r.scanStream(ctx, stream, wanted)
+		if err != nil {
+			return nil, nil, err
+		}
+		inFlight = append(inFlight, list...)
+	}
+	relayed, unresolved, err := r.relayedReservations(ctx, wanted)
+	if err != nil {
+		return nil, nil, err
+	}
+	inFlight = append(inFlight, relayed...)
+	if len(inFlight) > 0 || len(unresolved) > 0 {
+		reqIDs := append([]string(nil), unresolved...)
+		for _, res := range inFlight {
+			reqIDs = append(reqIDs, res.RequestID)
+		}
+		var known []string
+		if err := db.Model(&model.OrderRequest{}).Where("request_id IN ?", reqIDs).Pluck("request_id", &known).Error; err != nil {
+			return nil, nil, err
+		}
+		seen := make(map[string]bool, len(known)+len(rows))
+		for _, id := range known {
+			seen[id] = true
+		}
+		for _, res := range inFlight {
+			if !seen[res.RequestID] {
+				seen[res.RequestID] = true
+				rows = append(rows, res)
+			}
+		}
+		// 已有 order_requests 记录的按 DB 计，不算无法判定。
+		unresolved = slices.DeleteFunc(unresolved, func(id string) bool { return seen[id] })
+	}
+
+	out := make(map[unitKey][]reservation)
+	for _, res := range rows {
+		out[res.unit()] = append(out[res.unit()], res)
+	}
+	return out, unresolved, nil
+}
+
+// relayedReservations 按请求状态解析已离开 outbox 的 pending 请求：Relay 登记为已交给 Broker 的
+// （可能仍在 topic 中等待消费，或停在 Broker 死信 topic），以及停在 Redis 死信流的。
+// 请求状态已过期、无法得知商品与件数的请求 ID 单独返回。
+func (r *Reconciler) relayedReservations(ctx context.Context, wanted map[uint]bool) ([]reservation, []string, error) {
+	pipe := r.rdb.Pipeline()
+	relayed := pipe.SMembers(ctx, rediskey.RelayedRequestsKey())
+	deadLettered := pipe.SMembers(ctx, rediskey.DeadLetteredRequestsKey())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, err
+	}
+	ids := append(relayed.Val(), deadLettered.Val()...)
+	sort.Strings(ids)
+	ids = slices.Compact(ids)
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	pipe = r.rdb.Pipeline()
+	states := make([]*rd.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		states[i] = pipe.HGetAll(ctx, rediskey.RequestStatusKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, err
+	}
+	var out []reservation
+	var unresolved []string
+	for i, id := range ids {
+		m := states[i].Val()
+		values := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			values[k] = v
+		}
+		res, ok := parseStreamReservation(values)
+		if !ok {
+			unresolved = append(unresolved, id)
+			continue
+		}
+		// 进入终态时会同时移出集合，这里只是兜底。
+		if m["status"] != rediskey.RequestPending {
+			continue
+		}
+		if wanted[res.ProductID] {
+			out = append(out, res)
+		}
+	}
+	return out, unresolved, nil
+}
+
+// scanStream 分批读取 stream 中属于指定商品的下单事件；字段异常的条目跳过（由死信流程处理）。
+func (r *Reconciler) scanStream(ctx context.Context, stream string, wanted map[uint]bool) ([]reservation, error) {
+	var out []reservation
+	start := "-"
+	for {
+		msgs, err := r.rdb.XRangeN(ctx, stream, start, "+", streamScanBatch).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, xm := range msgs {
+			res, ok := parseStreamReservation(xm.Values)
+			if ok && wanted[res.ProductID] {
+				out = append(out, res)
+			}
+		}
+		if len(msgs) < streamScanBatch {
+			return out, nil
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+func parseStreamReservation(values map[string]interface{}) (reservation, bool) {
+	str := func(k string) string {
+		s, _ := values[k].(string)
+		return s
+	}
+	productID, err := strconv.ParseUint(str("product_id"), 10, 64)
+	if err != nil {
+		return reservation{}, false
+	}
+	userID, err := strconv.ParseInt(str("user_id"), 10, 64)
+	if err != nil {
+		return reservation{}, false
+	}
+	quantity, err := strconv.ParseInt(str("quantity"), 10, 64)
+	if err != nil {
+		return reservation{}, false
+	}
+	var skuID uint64
+	if s := str("sku_id"); s != "" {
+		if skuID, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return reservation{}, false
+		}
+	}
+	requestID := str("request_id")
+	if requestID == "" {
+		return reservation{}, false
+	}
+	return reservation{RequestID: requestID, UserID: userID, ProductID: uint(productID), SKUID: uint(skuID), Quantity: quantity}, true
+}
+
+// uncompensatedReservations 找出已失败/已取消但 Redis 中没有回补标记的请求。
+// 回补标记只保留 CompensationMarkTTL，更早的请求无法判定，视为已回补（避免误判后重复回补）。
+func (r *Reconciler) uncompensatedReservations(ctx context.Context, db *gorm.DB, productIDs []uint) (map[unitKey][]reservation, error) {
+	cutoff := time.Now().Add(-rediskey.CompensationMarkTTL + time.Hour)
+
+	var candidates []reservation
+	if err := db.Model(&model.OrderRequest{}).
+		Select("request_id, user_id, product_id, sku_id, quantity").
+		Where("product_id IN ? AND status = ? AND updated_at > ?", productIDs, model.OrderRequestFailed, cutoff).
+		Scan(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var cancelled []model.Order
+	if err := db.Where("product_id IN ? AND status = ? AND stock_released = ? AND updated_at > ?",
+		productIDs, model.OrderStatusCancelled, false, cutoff).
+		Find(&cancelled).Error; err != nil {
+		return nil, err
+	}
+	for i := range cancelled {
+		o := &cancelled[i]
+		candidates = append(candidates, reservation{
+			RequestID: o.RequestID,
+			UserID:    o.UserID,
+			ProductID: o.ProductID,
+			SKUID:     o.SKUID,
+			Quantity:  int64(o.Quantity),
+			order:     o,
+		})
+	}
+
+	out := make(map[unitKey][]reservation)
+	if len(candidates) == 0 {
+		return out, nil
+	}
+	pipe := r.rdb.Pipeline()
+	exists := make([]*rd.IntCmd, len(candidates))
+	for i, res := range candidates {
+		exists[i] = pipe.Exists(ctx, rediskey.CompensationLockKey(res.RequestID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, res := range candidates {
+		if exists[i].Val() == 0 {
+			out[res.unit()] = append(out[res.unit()], res)
+		}
+	}
+	for u := range out {
+		sort.Slice(out[u], func(a, b int) bool { return out[u][a].RequestID < out[u][b].RequestID })
+	}
+	return out, nil
+}
+
+// repair 先幂等回补遗漏的请求，再对剩余差异做 compare-and-set 校正；回补与校正均记录审计事件（操作者取自 ctx）。
+func (r *Reconciler) repair(ctx context.Context, it *Item, uncompensated []reservation, unresolved []string) error {
+	for _, res := range uncompensated {
+		if res.order != nil {
+			if err := order.ReleaseReservation(ctx, r.db, r.rdb, *res.order); err != nil {
+				return err
+			}
+		} else {
+			inventory := repository.NewRedisInventory(r.rdb, r.stream)
+			if err := audit.Compensate(ctx, inventory, repository.NewGormStore(r.db).Audit(), res.RequestID, res.ProductID, res.SKUID, res.Quantity); err != nil {
+				return err
+			}
+			if _, err := inventory.ReleaseQuota(ctx, res.RequestID, res.ProductID, res.UserID, res.Quantity); err != nil {
+				return err
+			}
+		}
+		it.Repaired = true
+	}
+
+	if it.Actual == nil {
+		return nil
+	}
+	if it.Pending > 0 {
+		return errors.New("residual diff not corrected: requests still pending")
+	}
+	if len(unresolved) > 0 {
+		return errors.New("residual diff not corrected: relayed or dead-lettered requests without request state")
+	}
+	actual, err := r.rdb.Get(ctx, it.StockKey).Int64()
+	if err != nil {
+		return err
+	}
+	if actual == it.Expected {
+		return nil
+	}
+	// 先以 pending 记下修正，再 CAS 写 Redis：不会出现没有审计事件的库存修正。
+	store := repository.NewGormStore(r.db)
+	e := audit.NewStock(ctx, audit.ActionStockCorrect, it.ProductID, it.SKUID, &actual, &it.Expected)
+	e.Detail = map[string]any{"initial_stock": it.InitialStock, "sold": it.Sold}
+	events := []model.AuditEvent{e}
+	if err := audit.Prepare(ctx, store, events); err != nil {
+		return err
+	}
+	n, err := r.rdb.Eval(ctx, luaCompareAndSetStock, []string{it.StockKey}, actual, it.Expected).Int()
+	if err != nil {
+		audit.Fail(ctx, store, events, err)
+		return err
+	}
+	if n == 0 {
+		events[0].Status = model.AuditStatusSkipped
+		if err := audit.Settle(ctx, store, events); err != nil {
+			return err
+		}
+		return errors.New("stock changed during reconciliation, retry")
+	}
+	it.Repaired = true
+	return audit.Settle(ctx, store, events)
+}
@@ -0,0 +1,83 @@
+package reconcile_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"flash_sale/internal/config"
+	"flash_sale/internal/model"
+	"flash_sale/internal/reconcile"
+	"flash_sale/internal/storage/storagetest"
+	rediskey "flash_sale/pkg/redis"
+)
+
+// TestRunRelayedRequest 已交给 Broker 但尚未被消费的请求：既不在 outbox 也没有 order_requests 记录，
+// 只能按请求状态计入未落终态件数；否则校正会把已扣减的库存加回去造成超卖。
+func TestRunRelayedRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		withState      bool
+		wantPending    int64
+		wantStatus     string
+		wantUnresolved []string
+	}{
+		{"relayed with request state", true, 2, reconcile.StatusOK, nil},
+		// 请求状态已过期：无法判定商品与件数，不能做 compare-and-set 校正。
+		{"relayed without request state", false, 0, reconcile.StatusDrift, []string{"req-relayed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			rdb := storagetest.OpenRedis(t)
+			db := storagetest.OpenMigrated(t, config.DBDriverSQLite)
+
+			now := time.Now()
+			p := model.Product{Name: "test", Stock: 10, SalePrice: 100, StartTime: now, EndTime: now.Add(time.Hour)}
+			if err := db.Create(&p).Error; err != nil {
+				t.Fatalf("create product: %v", err)
+			}
+			stockKey := rediskey.StockKey(p.ID, 0)
+			if err := rdb.Set(ctx, stockKey, 8, 0).Err(); err != nil {
+				t.Fatalf("set stock: %v", err)
+			}
+			if err := rdb.SAdd(ctx, rediskey.RelayedRequestsKey(), "req-relayed").Err(); err != nil {
+				t.Fatalf("mark relayed: %v", err)
+			}
+			if tt.withState {
+				if err := rdb.HSet(ctx, rediskey.RequestStatusKey("req-relayed"),
+					"request_id", "req-relayed",
+					"status", rediskey.RequestPending,
+					"user_id", 7,
+					"product_id", p.ID,
+					"sku_id", 0,
+					"quantity", 2,
+				).Err(); err != nil {
+					t.Fatalf("set request state: %v", err)
+				}
+			}
+
+			report, err := reconcile.NewReconciler(db, rdb, "stream:test").Run(ctx, []uint{p.ID}, true)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if len(report.Items) != 1 {
+				t.Fatalf("items = %d, want 1", len(report.Items))
+			}
+			it := report.Items[0]
+			if it.Pending != tt.wantPending || it.Status != tt.wantStatus {
+				t.Fatalf("pending = %d status = %s, want %d %s", it.Pending, it.Status, tt.wantPending, tt.wantStatus)
+			}
+			if !slices.Equal(report.UnresolvedRequestIDs, tt.wantUnresolved) {
+				t.Fatalf("unresolved = %v, want %v", report.UnresolvedRequestIDs, tt.wantUnresolved)
+			}
+			if it.Repaired {
+				t.Fatalf("stock corrected while a relayed request is in flight")
+			}
+			if got, err := rdb.Get(ctx, stockKey).Int64(); err != nil || got != 8 {
+				t.Fatalf("redis stock = %d (%v), want 8", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package registration
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/storage"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrProductNotFound 表示商品不存在。
+	ErrProductNotFound = errors.New("product not found")
+	// ErrRegistrationClosed 表示商品已开售，不再接受预约。
+	ErrRegistrationClosed = errors.New("registration closed")
+	// ErrSaleStarted 表示商品已开售，不能再修改预约要求。
+	ErrSaleStarted = errors.New("sale already started")
+)
+
+// 回填 Redis 预约集合时单批 SADD 的用户数。
+const syncBatchSize = 1000
+
+// Stats 为商品的预约统计，用于开售前估算需求、决定预热库存。
+type Stats struct {
+	ProductID           uint      `json:"product_id"`
+	RequireRegistration bool      `json:"require_registration"`
+	StartTime           time.Time `json:"start_time"`
+	Stock               int64     `json:"stock"`
+	// Registered 为 DB 中的预约人数（权威值）。
+	Registered int64 `json:"registered"`
+	// Cached 为 Redis 预约集合中的人数，小于 Registered 说明集合丢失，预热时会回填。
+	Cached int64 `json:"cached"`
+	// DemandRatio 为预约人数 / 库存。
+	DemandRatio float64 `json:"demand_ratio"`
+}
+
+// Register 在开售前预约商品，重复预约返回原记录。
+// 先写 DB 再写 Redis 集合：Redis 写失败时返回错误，客户端重试即可（DB 侧幂等），预热时也会按 DB 回填。
+func Register(ctx context.Context, db *gorm.DB, rdb *rd.Client, productID uint, userID int64) (model.Registration, error) {
+	db = db.WithContext(ctx)
+	prod, err := getProduct(db, productID)
+	if err != nil {
+		return model.Registration{}, err
+	}
+	if !time.Now().Before(prod.StartTime) {
+		return model.Registration{}, ErrRegistrationClosed
+	}
+
+	reg := model.Registration{ProductID: productID, UserID: userID}
+	if err := db.Create(&reg).Error; err != nil {
+		if !storage.IsUniqueViolation(err) {
+			return model.Registration{}, err
+		}
+		if err := db.Where("product_id = ? AND user_id = ?", productID, userID).First(&reg).Error; err != nil {
+			return model.Registration{}, err
+		}
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.SAdd(ctx, rediskey.RegistrationKey(productID), userID)
+	pipe.ExpireAt(ctx, rediskey.RegistrationKey(productID), keyExpireAt(prod))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return model.Registration{}, err
+	}
+	return reg, nil
+}
+
+// IsRegistered 查询用户是否已预约（以 DB 为准）。
+func IsRegistered(ctx context.Context, db *gorm.DB, productID uint, userID int64) (bool, error) {
+	var n int64
+	err := db.WithContext(ctx).Model(&model.Registration{}).
+		Where("product_id = ? AND user_id = ?", productID, userID).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// SetRequired 开启或关闭商品的预约要求，只允许在开售前修改。同一事务内写入 registration.set_required 审计事件。
+func SetRequired(ctx context.Context, db *gorm.DB, productID uint, required bool) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		prod, err := getProduct(tx, productID)
+		if err != nil {
+			return err
+		}
+		if !time.Now().Before(prod.StartTime) {
+			return ErrSaleStarted
+		}
+		if err := tx.Model(&model.Product{}).Where("id = ?", productID).Update("require_registration", required).Error; err != nil {
+			return err
+		}
+		e := audit.New(ctx, audit.ActionRegistrationSet, audit.TargetProduct, strconv.FormatUint(uint64(productID), 10))
+		e.ProductID = productID
+		e.Detail = map[string]any{"before": prod.RequireRegistration, "after": required}
+		return audit.Record(ctx, tx, e)
+	})
+}
+
+// GetStats 统计商品的预约人数。
+func GetStats(ctx context.Context, db *gorm.DB, rdb *rd.Client, productID uint) (Stats, error) {
+	db = db.WithContext(ctx)
+	prod, err := getProduct(db, productID)
+	if err != nil {
+		return Stats{}, err
+	}
+	out := Stats{
+		ProductID:           prod.ID,
+		RequireRegistration: prod.RequireRegistration,
+		StartTime:           prod.StartTime,
+		Stock:               prod.Stock,
+	}
+	if err := db.Model(&model.Registration{}).Where("product_id = ?", productID).Count(&out.Registered).Error; err != nil {
+		return Stats{}, err
+	}
+	if out.Cached, err = rdb.SCard(ctx, rediskey.RegistrationKey(productID)).Result(); err != nil {
+		return Stats{}, err
+	}
+	if out.Stock > 0 {
+		out.DemandRatio = float64(out.Registered) / float64(out.Stock)
+	}
+	return out, nil
+}
+
+// Sync 按 DB 回填商品的 Redis 预约集合（只增不删，可重复执行）。
+// 未开启预约要求的商品跳过；预热库存时调用，防止 Redis 数据丢失后已预约用户被拦截。
+func Sync(ctx context.Context, db *gorm.DB, rdb *rd.Client, prod model.Product) error {
+	if !prod.RequireRegistration {
+		return nil
+	}
+	key := rediskey.RegistrationKey(prod.ID)
+	var regs []model.Registration
+	return db.WithContext(ctx).Where("product_id = ?", prod.ID).Order("id ASC").
+		FindInBatches(&regs, syncBatchSize, func(_ *gorm.DB, _ int) error {
+			members := make([]any, 0, len(regs))
+			for _, r := range regs {
+				members = append(members, r.UserID)
+			}
+			pipe := rdb.TxPipeline()
+			pipe.SAdd(ctx, key, members...)
+			pipe.ExpireAt(ctx, key, keyExpireAt(prod))
+			_, err := pipe.Exec(ctx)
+			return err
+		}).Error
+}
+
+func getProduct(db *gorm.DB, productID uint) (model.Product, error) {
+	var prod model.Product
+	if err := db.First(&prod, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Product{}, ErrProductNotFound
+		}
+		return model.Product{}, err
+	}
+	return prod, nil
+}
+
+// keyExpireAt 预约集合保留到商品结束后一小时，覆盖结束前最后一批下单。
+func keyExpireAt(prod model.Product) time.Time {
+	return prod.EndTime.Add(time.Hour)
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"flash_sale/internal/model"
+	"flash_sale/internal/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormStore 基于 GORM 的实现；db 可以是普通连接，也可以是事务句柄。
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建基于 GORM 的 Store。
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Products() ProductRepository { return gormProducts{db: s.db} }
+func (s *gormStore) Orders() OrderRepository     { return gormOrders{db: s.db} }
+func (s *gormStore) Requests() RequestRepository { return gormRequests{db: s.db} }
+func (s *gormStore) Audit() AuditRepository      { return gormAudit{db: s.db} }
+
+func (s *gormStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// translate 把 GORM / 驱动错误映射为仓储层错误。
+func translate(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case storage.IsUniqueViolation(err):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
+
+type gormProducts struct {
+	db *gorm.DB
+}
+
+func (r gormProducts) List(ctx context.Context) ([]model.Product, error) {
+	var list []model.Product
+	if err := r.db.WithContext(ctx).Preload("SKUs").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r gormProducts) Get(ctx context.Context, id uint) (model.Product, error) {
+	var p model.Product
+	err := r.db.WithContext(ctx).First(&p, id).Error
+	return p, translate(err)
+}
+
+func (r gormProducts) GetWithSKUs(ctx context.Context, id uint) (model.Product, error) {
+	var p model.Product
+	err := r.db.WithContext(ctx).Preload("SKUs").First(&p, id).Error
+	return p, translate(err)
+}
+
+func (r gormProducts) Create(ctx context.Context, p *model.Product) error {
+	// 商品与 SKU 在同一事务内写入（GORM 关联自动保存）。
+	return translate(r.db.WithContext(ctx).Create(p).Error)
+}
+
+type gormOrders struct {
+	db *gorm.DB
+}
+
+func (r gormOrders) GetByOrderNo(ctx context.Context, orderNo string) (model.Order, error) {
+	var o model.Order
+	err := r.db.WithContext(ctx).Where("order_no = ?", orderNo).First(&o).Error
+	return o, translate(err)
+}
+
+func (r gormOrders) GetByRequestID(ctx context.Context, requestID string) (model.Order, error) {
+	var o model.Order
+	err := r.db.WithContext(ctx).Where("request_id = ?", requestID).First(&o).Error
+	return o, translate(err)
+}
+
+func (r gormOrders) Create(ctx context.Context, o *model.Order) error {
+	// 嵌套事务即 SAVEPOINT：PostgreSQL 中语句失败会使整个事务失效，
+	// 回滚到保存点后调用方才能继续在同一事务内查询已存在的订单。
+	return translate(r.db.WithContext(ctx).Transaction(func(sp *gorm.DB) error {
+		return sp.Create(o).Error
+	}))
+}
+
+// ReserveUserQuota 先 upsert 计数行再行锁读取，串行化同一用户同一商品的并发建单。
+func (r gormOrders) ReserveUserQuota(ctx context.Context, userID int64, productID uint, quantity, limit int) error {
+	db := r.db.WithContext(ctx)
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+		DoNothing: true,
+	}).Create(&model.UserPurchase{UserID: userID, ProductID: productID}).Error; err != nil {
+		return err
+	}
+
+	var up model.UserPurchase
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND product_id = ?", userID, productID).
+		First(&up).Error; err != nil {
+		return translate(err)
+	}
+	if up.Quantity+quantity > limit {
+		return ErrPurchaseLimitExceeded
+	}
+	return db.Model(&model.UserPurchase{}).
+		Where("id = ?", up.ID).
+		Update("quantity", gorm.Expr("quantity + ?", quantity)).Error
+}
+
+type gormRequests struct {
+	db *gorm.DB
+}
+
+func (r gormRequests) Get(ctx context.Context, requestID string) (model.OrderRequest, error) {
+	var req model.OrderRequest
+	err := r.db.WithContext(ctx).Where("request_id = ?", requestID).First(&req).Error
+	return req, translate(err)
+}
+
+// GetForUpdate 在 PostgreSQL / MySQL 下生成 SELECT ... FOR UPDATE；SQLite 无行锁，由库级写锁串行化。
+func (r gormRequests) GetForUpdate(ctx context.Context, requestID string) (model.OrderRequest, error) {
+	var req model.OrderRequest
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("request_id = ?", requestID).
+		First(&req).Error
+	return req, translate(err)
+}
+
+func (r gormRequests) UpsertPending(ctx context.Context, req model.OrderRequest) error {
+	req.ID = 0
+	req.Status = model.OrderRequestPending
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "request_id"}},
+		DoNothing: true,
+	}).Create(&req).Error
+}
+
+func (r gormRequests) MarkSuccess(ctx context.Context, requestID, orderNo string) error {
+	return r.db.WithContext(ctx).Model(&model.OrderRequest{}).
+		Where("request_id = ?", requestID).
+		Updates(map[string]any{
+			"status":    model.OrderRequestSuccess,
+			"order_no":  orderNo,
+			"error_msg": "",
+		}).Error
+}
+
+func (r gormRequests) MarkFailed(ctx context.Context, requestID, reason string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.OrderRequest{}).
+		Where("request_id = ? AND status = ?", requestID, model.OrderRequestPending).
+		Updates(map[string]any{
+			"status":    model.OrderRequestFailed,
+			"error_msg": reason,
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r gormRequests) RecordDenied(ctx context.Context, req model.OrderRequest) error {
+	req.ID = 0
+	req.Status = model.OrderRequestDenied
+	return translate(r.db.WithContext(ctx).Create(&req).Error)
+}
+
+type gormAudit struct {
+	db *gorm.DB
+}
+
+func (r gormAudit) Append(ctx context.Context, e *model.AuditEvent) error {
+	e.ID = 0
+	if e.Status == "" {
+		e.Status = model.AuditStatusApplied
+	}
+	db := r.db.WithContext(ctx)
+	if e.DedupKey != nil {
+		db = db.Clauses(clause.OnConflict{DoNothing: true})
+	}
+	return db.Create(e).Error
+}
+
+func (r gormAudit) Settle(ctx context.Context, e *model.AuditEvent) error {
+	res := r.db.WithContext(ctx).Model(&model.AuditEvent{}).
+		Where("id = ? AND status = ?", e.ID, model.AuditStatusPending).
+		Select("status", "stock_before", "detail").
+		Updates(&model.AuditEvent{Status: e.Status, StockBefore: e.StockBefore, Detail: e.Detail})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	"flash_sale/internal/storage/storagetest"
+)
+
+// TestGormOrderCreateDuplicateInTransaction 验证订单插入在 SAVEPOINT 中执行：
+// 唯一冲突返回 ErrDuplicate 后，同一事务仍可继续查询并提交（PostgreSQL 下语句失败会使未用保存点的事务整体失效）。
+func TestGormOrderCreateDuplicateInTransaction(t *testing.T) {
+	for _, driver := range storagetest.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			ctx := context.Background()
+			store := repository.NewGormStore(storagetest.OpenMigrated(t, driver))
+
+			err := store.Transaction(ctx, func(tx repository.Store) error {
+				if err := tx.Orders().Create(ctx, testOrder("SK1", "req-1")); err != nil {
+					return err
+				}
+				err := tx.Orders().Create(ctx, testOrder("SK2", "req-1"))
+				if !errors.Is(err, repository.ErrDuplicate) {
+					t.Fatalf("duplicate request_id: got %v, want ErrDuplicate", err)
+				}
+				existing, err := tx.Orders().GetByRequestID(ctx, "req-1")
+				if err != nil {
+					return err
+				}
+				if existing.OrderNo != "SK1" {
+					t.Fatalf("order_no = %s, want SK1", existing.OrderNo)
+				}
+				return tx.Requests().UpsertPending(ctx, model.OrderRequest{
+					RequestID: "req-1", UserID: 1, ProductID: 1, Quantity: 1, Amount: 100, Status: model.OrderRequestPending,
+				})
+			})
+			if err != nil {
+				t.Fatalf("transaction after duplicate: %v", err)
+			}
+
+			o, err := store.Orders().GetByRequestID(ctx, "req-1")
+			if err != nil || o.OrderNo != "SK1" {
+				t.Fatalf("committed order = %+v, %v", o, err)
+			}
+			if _, err := store.Requests().Get(ctx, "req-1"); err != nil {
+				t.Fatalf("committed request: %v", err)
+			}
+			if _, err := store.Orders().GetByRequestID(ctx, "missing"); !errors.Is(err, repository.ErrNotFound) {
+				t.Fatalf("missing order: got %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func testOrder(orderNo, requestID string) *model.Order {
+	expireAt := time.Now().Add(time.Minute)
+	return &model.Order{
+		OrderNo:   orderNo,
+		RequestID: requestID,
+		UserID:    1,
+		ProductID: 1,
+		Quantity:  1,
+		Amount:    100,
+		ExpireAt:  &expireAt,
+	}
+}
+
+// TestGormAuditSettle 验证 pending 事件只能更新一次，且更新时写入改动前库存与附加信息；直接写入的事件为 applied。
+func TestGormAuditSettle(t *testing.T) {
+	for _, driver := range storagetest.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			ctx := context.Background()
+			db := storagetest.OpenMigrated(t, driver)
+			store := repository.NewGormStore(db)
+
+			after := int64(10)
+			pending := model.AuditEvent{Actor: "test", Action: "stock.preload", TargetType: "stock", TargetID: "stock:1", StockAfter: &after, Status: model.AuditStatusPending}
+			if err := store.Audit().Append(ctx, &pending); err != nil {
+				t.Fatalf("append pending: %v", err)
+			}
+			applied := model.AuditEvent{Actor: "test", Action: "product.create", TargetType: "product", TargetID: "1"}
+			if err := store.Audit().Append(ctx, &applied); err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			if applied.Status != model.AuditStatusApplied {
+				t.Fatalf("default status = %q, want applied", applied.Status)
+			}
+
+			before := int64(3)
+			pending.Status, pending.StockBefore, pending.Detail = model.AuditStatusApplied, &before, map[string]any{"campaign_id": float64(7)}
+			if err := store.Audit().Settle(ctx, &pending); err != nil {
+				t.Fatalf("settle: %v", err)
+			}
+			var got model.AuditEvent
+			if err := db.First(&got, pending.ID).Error; err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if got.Status != model.AuditStatusApplied || got.StockBefore == nil || *got.StockBefore != 3 ||
+				got.StockAfter == nil || *got.StockAfter != 10 || got.Detail["campaign_id"] != float64(7) {
+				t.Fatalf("settled = %+v", got)
+			}
+
+			pending.Status = model.AuditStatusFailed
+			if err := store.Audit().Settle(ctx, &pending); !errors.Is(err, repository.ErrNotFound) {
+				t.Fatalf("settle twice: got %v, want ErrNotFound", err)
+			}
+			applied.Status = model.AuditStatusFailed
+			if err := store.Audit().Settle(ctx, &applied); !errors.Is(err, repository.ErrNotFound) {
+				t.Fatalf("settle applied event: got %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
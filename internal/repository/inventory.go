@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flash_sale/internal/risk"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// ReserveStatus 为一次下单接入的结果。
+type ReserveStatus string
+
+const (
+	// ReserveOK 表示已扣库存、占用限购额度并写入 outbox。
+	ReserveOK ReserveStatus = "OK"
+	// ReserveBlacklisted 表示用户、IP 或设备号命中黑名单（维度见 ReserveResult.Blacklisted）。
+	ReserveBlacklisted ReserveStatus = "BLACKLISTED"
+	// ReserveIdempotent 表示幂等键已使用过（历史请求见 ReserveResult.ExistingRequestID）。
+	ReserveIdempotent ReserveStatus = "IDEMPOTENT"
+	// ReserveNotRegistered 表示商品要求预约而用户未预约。
+	ReserveNotRegistered ReserveStatus = "NOT_REGISTERED"
+	// ReserveLimitExceeded 表示累计占用数量超过每人限购。
+	ReserveLimitExceeded ReserveStatus = "LIMIT_EXCEEDED"
+	// ReserveOutOfStock 表示库存不足。
+	ReserveOutOfStock ReserveStatus = "OUT_OF_STOCK"
+)
+
+// Reservation 为下单接入的参数。
+type Reservation struct {
+	RequestID string
+	UserID    int64
+	ProductID uint
+	SKUID     uint
+	Quantity  int
+	Amount    int64
+
+	PerUserLimit        int
+	RequireRegistration bool
+	// IdempotencyKey 为客户端幂等键，同一用户同一商品下重复使用时返回历史 request_id。
+	IdempotencyKey string
+	// ClientIP / DeviceID 参与黑名单拦截，为空时跳过对应维度。
+	ClientIP string
+	DeviceID string
+
+	// StateTTL 为请求状态与幂等映射的保留时长，QuotaTTL 为限购计数的保留时长。
+	StateTTL time.Duration
+	QuotaTTL time.Duration
+}
+
+// ReserveResult 为 Reserve 的返回。
+type ReserveResult struct {
+	Status ReserveStatus
+	// ExistingRequestID 为 Status=ReserveIdempotent 时的历史 request_id。
+	ExistingRequestID string
+	// Blacklisted 为 Status=ReserveBlacklisted 时命中的维度。
+	Blacklisted risk.Kind
+}
+
+// Inventory 为库存与限购额度的缓存层（生产为 Redis Lua），DB 中的订单与购买记录是事实来源。
+// 下单接入时原子占用库存与额度，失败收敛时按 request_id 幂等归还。
+type Inventory interface {
+	// Reserve 原子完成黑名单、幂等、预约、限购与库存校验，通过后扣库存、写 pending 状态并写入 outbox。
+	Reserve(ctx context.Context, r Reservation) (ReserveResult, error)
+	// CompensateStock 幂等回补库存，同一 request_id 只加一次。
+	CompensateStock(ctx context.Context, requestID string, productID, skuID uint, quantity int64) (rediskey.Compensation, error)
+	// ReleaseQuota 幂等归还限购额度，返回本次是否实际归还。
+	ReleaseQuota(ctx context.Context, requestID string, productID uint, userID int64, quantity int64) (bool, error)
+}
+
+// luaReserveRequest 原子完成：
+// 1) 用户、IP、设备号任一在黑名单中直接拒绝（返回命中的维度）
+// 2) 幂等键命中直接返回历史 request_id
+// 3) 商品要求预约时校验用户在预约集合中
+// 4) 每人限购校验（累计已占用数量 + 本次数量 <= 上限）
+// 5) 库存校验与扣减
+// 6) 写入 outbox，写 request 状态 pending（记录 outbox entry ID 供清扫任务定位），并登记到 pending 时间索引
+// 7) 累加用户已占用数量并写幂等映射
+const luaReserveRequest = `
+local stockKey = KEYS[1]
+local userQtyKey = KEYS[2]
+local requestStateKey = KEYS[3]
+local idemKey = KEYS[4]
+local streamKey = KEYS[5]
+local pendingKey = KEYS[6]
+local registrationKey = KEYS[7]
+local blacklistUserKey = KEYS[8]
+local blacklistIPKey = KEYS[9]
+local blacklistDeviceKey = KEYS[10]
+
+local quantity = tonumber(ARGV[1])
+local requestID = ARGV[2]
+local userID = ARGV[3]
+local productID = ARGV[4]
+local amount = ARGV[5]
+local requestTTL = tonumber(ARGV[6])
+local userLockTTL = tonumber(ARGV[7])
+local idemTTL = tonumber(ARGV[8])
+local perUserLimit = tonumber(ARGV[9])
+local skuID = ARGV[10]
+local nowMs = tonumber(ARGV[11])
+local requireRegistration = ARGV[12] == '1'
+local clientIP = ARGV[13]
+local deviceID = ARGV[14]
+
+if redis.call('SISMEMBER', blacklistUserKey, userID) == 1 then
+  return 'BLACKLISTED:user'
+end
+if clientIP ~= '' and redis.call('SISMEMBER', blacklistIPKey, clientIP) == 1 then
+  return 'BLACKLISTED:ip'
+end
+if deviceID ~= '' and redis.call('SISMEMBER', blacklistDeviceKey, deviceID) == 1 then
+  return 'BLACKLISTED:device'
+end
+
+local existingReq = redis.call('GET', idemKey)
+if existingReq then
+  return 'IDEMPOTENT:' .. existingReq
+end
+
+if requireRegistration and redis.call('SISMEMBER', registrationKey, userID) == 0 then
+  return 'NOT_REGISTERED'
+end
+
+local purchased = tonumber(redis.call('GET', userQtyKey) or '0')
+if purchased + quantity > perUserLimit then
+  return 'LIMIT_EXCEEDED'
+end
+
+local current = tonumber(redis.call('GET', stockKey) or '0')
+if current < quantity then
+  return 'OUT_OF_STOCK'
+end
+
+redis.call('DECRBY', stockKey, quantity)
+redis.call('INCRBY', userQtyKey, quantity)
+redis.call('EXPIRE', userQtyKey, userLockTTL)
+redis.call('SET', idemKey, requestID, 'EX', idemTTL)
+local eventID = redis.call('XADD', streamKey, '*',
+  'request_id', requestID,
+  'product_id', productID,
+  'sku_id', skuID,
+  'user_id', userID,
+  'quantity', quantity,
+  'amount', amount
+)
+redis.call('HSET', requestStateKey,
+  'request_id', requestID,
+  'status', 'pending',
+  'order_no', '',
+  'reason', '',
+  'user_id', userID,
+  'product_id', productID,
+  'sku_id', skuID,
+  'quantity', quantity,
+  'amount', amount,
+  'event_id', eventID
+)
+redis.call('EXPIRE', requestStateKey, requestTTL)
+redis.call('ZADD', pendingKey, nowMs, requestID)
+return 'OK'
+`
+
+type redisInventory struct {
+	rdb    *rd.Client
+	stream string
+}
+
+// NewRedisInventory 创建基于 Redis 的库存缓存层，stream 为下单事件的 outbox。
+func NewRedisInventory(rdb *rd.Client, stream string) Inventory {
+	return redisInventory{rdb: rdb, stream: stream}
+}
+
+func (i redisInventory) Reserve(ctx context.Context, r Reservation) (ReserveResult, error) {
+	requireRegistration := "0"
+	if r.RequireRegistration {
+		requireRegistration = "1"
+	}
+	keys := []string{
+		rediskey.StockKey(r.ProductID, r.SKUID),
+		rediskey.UserPurchasedQtyKey(r.ProductID, r.UserID),
+		rediskey.RequestStatusKey(r.RequestID),
+		rediskey.RequestIdempotencyKey(r.ProductID, r.UserID, r.IdempotencyKey),
+		i.stream,
+		rediskey.PendingRequestsKey(),
+		rediskey.RegistrationKey(r.ProductID),
+	}
+	for _, kind := range risk.Kinds {
+		keys = append(keys, rediskey.BlacklistKey(string(kind)))
+	}
+
+	res, err := i.rdb.Eval(ctx, luaReserveRequest, keys,
+		r.Quantity, r.RequestID, r.UserID, r.ProductID, r.Amount,
+		int64(r.StateTTL/time.Second), int64(r.QuotaTTL/time.Second), int64(r.StateTTL/time.Second),
+		r.PerUserLimit, r.SKUID, time.Now().UnixMilli(), requireRegistration, r.ClientIP, r.DeviceID,
+	).Text()
+	if err != nil {
+		return ReserveResult{}, err
+	}
+
+	status, arg, _ := strings.Cut(res, ":")
+	out := ReserveResult{Status: ReserveStatus(status)}
+	switch out.Status {
+	case ReserveBlacklisted:
+		out.Blacklisted = risk.Kind(arg)
+	case ReserveIdempotent:
+		out.ExistingRequestID = arg
+	}
+	return out, nil
+}
+
+func (i redisInventory) CompensateStock(ctx context.Context, requestID string, productID, skuID uint, quantity int64) (rediskey.Compensation, error) {
+	return rediskey.CompensateStockOnce(ctx, i.rdb, requestID, productID, skuID, quantity)
+}
+
+func (i redisInventory) ReleaseQuota(ctx context.Context, requestID string, productID uint, userID int64, quantity int64) (bool, error) {
+	return rediskey.ReleaseUserQuotaOnce(ctx, i.rdb, requestID, productID, userID, quantity)
+}
+
+type stockUnit struct {
+	productID uint
+	skuID     uint
+}
+
+// MemoryInventory 为进程内库存缓存层，供单元测试替代 Redis；不模拟过期。
+// states 非 nil 时，Reserve 成功后同下单 Lua 一样写入 pending 状态。
+type MemoryInventory struct {
+	mu sync.Mutex
+
+	states      *MemoryStateCache
+	stock       map[stockUnit]int64
+	purchased   map[purchaseKey]int64
+	idempotency map[string]string
+	registered  map[purchaseKey]bool
+	blacklist   map[risk.Kind]map[string]bool
+	compensated map[string]int64
+	released    map[string]bool
+	outbox      []Reservation
+}
+
+func NewMemoryInventory(states *MemoryStateCache) *MemoryInventory {
+	return &MemoryInventory{
+		states:      states,
+		stock:       make(map[stockUnit]int64),
+		purchased:   make(map[purchaseKey]int64),
+		idempotency: make(map[string]string),
+		registered:  make(map[purchaseKey]bool),
+		blacklist:   make(map[risk.Kind]map[string]bool),
+		compensated: make(map[string]int64),
+		released:    make(map[string]bool),
+	}
+}
+
+// SetStock 设置库存单元（skuID=0 为商品级库存）的剩余库存。
+func (i *MemoryInventory) SetStock(productID, skuID uint, n int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.stock[stockUnit{productID: productID, skuID: skuID}] = n
+}
+
+// Stock 返回库存单元的剩余库存。
+func (i *MemoryInventory) Stock(productID, skuID uint) int64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.stock[stockUnit{productID: productID, skuID: skuID}]
+}
+
+// Purchased 返回用户在商品上已占用的限购数量。
+func (i *MemoryInventory) Purchased(userID int64, productID uint) int64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.purchased[purchaseKey{userID: userID, productID: productID}]
+}
+
+// Register 将用户加入商品的预约集合。
+func (i *MemoryInventory) Register(productID uint, userID int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.registered[purchaseKey{userID: userID, productID: productID}] = true
+}
+
+// Blacklist 将取值加入某一维度的黑名单。
+func (i *MemoryInventory) Blacklist(kind risk.Kind, value string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.blacklist[kind] == nil {
+		i.blacklist[kind] = make(map[string]bool)
+	}
+	i.blacklist[kind][value] = true
+}
+
+// Reserved 返回已写入 outbox 的请求（按写入顺序）。
+func (i *MemoryInventory) Reserved() []Reservation {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]Reservation(nil), i.outbox...)
+}
+
+func (i *MemoryInventory) Reserve(ctx context.Context, r Reservation) (ReserveResult, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	values := map[risk.Kind]string{
+		risk.KindUser:   strconv.FormatInt(r.UserID, 10),
+		risk.KindIP:     r.ClientIP,
+		risk.KindDevice: r.DeviceID,
+	}
+	for _, kind := range risk.Kinds {
+		if value := values[kind]; value != "" && i.blacklist[kind][value] {
+			return ReserveResult{Status: ReserveBlacklisted, Blacklisted: kind}, nil
+		}
+	}
+
+	idemKey := rediskey.RequestIdempotencyKey(r.ProductID, r.UserID, r.IdempotencyKey)
+	if existing, ok := i.idempotency[idemKey]; ok {
+		return ReserveResult{Status: ReserveIdempotent, ExistingRequestID: existing}, nil
+	}
+
+	quota := purchaseKey{userID: r.UserID, productID: r.ProductID}
+	if r.RequireRegistration && !i.registered[quota] {
+		return ReserveResult{Status: ReserveNotRegistered}, nil
+	}
+	if i.purchased[quota]+int64(r.Quantity) > int64(r.PerUserLimit) {
+		return ReserveResult{Status: ReserveLimitExceeded}, nil
+	}
+	unit := stockUnit{productID: r.ProductID, skuID: r.SKUID}
+	if i.stock[unit] < int64(r.Quantity) {
+		return ReserveResult{Status: ReserveOutOfStock}, nil
+	}
+
+	i.stock[unit] -= int64(r.Quantity)
+	i.purchased[quota] += int64(r.Quantity)
+	i.idempotency[idemKey] = r.RequestID
+	i.outbox = append(i.outbox, r)
+	if i.states != nil {
+		if err := i.states.Put(ctx, rediskey.RequestState{RequestID: r.RequestID, Status: rediskey.RequestPending}, r.StateTTL); err != nil {
+			return ReserveResult{}, err
+		}
+	}
+	return ReserveResult{Status: ReserveOK}, nil
+}
+
+func (i *MemoryInventory) CompensateStock(_ context.Context, requestID string, productID, skuID uint, quantity int64) (rediskey.Compensation, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if after, ok := i.compensated[requestID]; ok {
+		return rediskey.Compensation{StockAfter: &after}, nil
+	}
+	unit := stockUnit{productID: productID, skuID: skuID}
+	i.stock[unit] += quantity
+	after := i.stock[unit]
+	i.compensated[requestID] = after
+	return rediskey.Compensation{Applied: true, StockAfter: &after}, nil
+}
+
+func (i *MemoryInventory) ReleaseQuota(_ context.Context, requestID string, productID uint, userID int64, quantity int64) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.released[requestID] {
+		return false, nil
+	}
+	i.released[requestID] = true
+	key := purchaseKey{userID: userID, productID: productID}
+	i.purchased[key] -= quantity
+	if i.purchased[key] <= 0 {
+		delete(i.purchased, key)
+	}
+	return true, nil
+}
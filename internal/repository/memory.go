@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"flash_sale/internal/model"
+)
+
+// MemoryStore 为进程内 Store 实现，供单元测试替代 SQLite。
+// 事务以快照回滚模拟，同一时刻只执行一个事务（相当于对全部数据加锁）；
+// 事务外的写入不与事务互斥，测试中需要隔离时应放在事务内。
+type MemoryStore struct {
+	txMu sync.Mutex
+
+	mu   sync.Mutex
+	data *memoryData
+}
+
+type purchaseKey struct {
+	userID    int64
+	productID uint
+}
+
+type memoryData struct {
+	products  map[uint]model.Product
+	orders    map[uint]model.Order
+	requests  map[string]model.OrderRequest
+	purchases map[purchaseKey]int
+	audit     []model.AuditEvent
+
+	nextProductID uint
+	nextSKUID     uint
+	nextOrderID   uint
+	nextRequestID uint
+	nextAuditID   uint
+}
+
+// NewMemoryStore 创建空的进程内 Store。
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: &memoryData{
+		products:  make(map[uint]model.Product),
+		orders:    make(map[uint]model.Order),
+		requests:  make(map[string]model.OrderRequest),
+		purchases: make(map[purchaseKey]int),
+	}}
+}
+
+func (d *memoryData) clone() *memoryData {
+	out := *d
+	out.products = make(map[uint]model.Product, len(d.products))
+	for id, p := range d.products {
+		p.SKUs = append([]model.SKU(nil), p.SKUs...)
+		out.products[id] = p
+	}
+	out.orders = make(map[uint]model.Order, len(d.orders))
+	for id, o := range d.orders {
+		out.orders[id] = o
+	}
+	out.requests = make(map[string]model.OrderRequest, len(d.requests))
+	for id, r := range d.requests {
+		out.requests[id] = r
+	}
+	out.purchases = make(map[purchaseKey]int, len(d.purchases))
+	for k, v := range d.purchases {
+		out.purchases[k] = v
+	}
+	out.audit = append([]model.AuditEvent(nil), d.audit...)
+	return &out
+}
+
+// UserPurchased 返回用户在商品上的累计已购数量，便于测试断言。
+func (s *MemoryStore) UserPurchased(userID int64, productID uint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.purchases[purchaseKey{userID: userID, productID: productID}]
+}
+
+func (s *MemoryStore) Products() ProductRepository { return memoryProducts{s} }
+func (s *MemoryStore) Orders() OrderRepository     { return memoryOrders{s} }
+func (s *MemoryStore) Requests() RequestRepository { return memoryRequests{s} }
+func (s *MemoryStore) Audit() AuditRepository      { return memoryAudit{s} }
+
+func (s *MemoryStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	return memoryTx{s}.Transaction(ctx, fn)
+}
+
+// memoryTx 为事务内的句柄：嵌套 Transaction 相当于保存点，失败只回滚自身的修改。
+type memoryTx struct {
+	*MemoryStore
+}
+
+func (t memoryTx) Transaction(_ context.Context, fn func(tx Store) error) error {
+	t.mu.Lock()
+	snapshot := t.data.clone()
+	t.mu.Unlock()
+
+	if err := fn(t); err != nil {
+		t.mu.Lock()
+		t.data = snapshot
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+type memoryProducts struct {
+	s *MemoryStore
+}
+
+func (r memoryProducts) List(_ context.Context) ([]model.Product, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	out := make([]model.Product, 0, len(r.s.data.products))
+	for _, p := range r.s.data.products {
+		p.SKUs = append([]model.SKU(nil), p.SKUs...)
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r memoryProducts) Get(ctx context.Context, id uint) (model.Product, error) {
+	p, err := r.GetWithSKUs(ctx, id)
+	p.SKUs = nil
+	return p, err
+}
+
+func (r memoryProducts) GetWithSKUs(_ context.Context, id uint) (model.Product, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	p, ok := r.s.data.products[id]
+	if !ok {
+		return model.Product{}, ErrNotFound
+	}
+	p.SKUs = append([]model.SKU(nil), p.SKUs...)
+	return p, nil
+}
+
+func (r memoryProducts) Create(_ context.Context, p *model.Product) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	d := r.s.data
+	now := time.Now()
+	d.nextProductID++
+	p.ID, p.CreatedAt, p.UpdatedAt = d.nextProductID, now, now
+	for i := range p.SKUs {
+		d.nextSKUID++
+		p.SKUs[i].ID, p.SKUs[i].ProductID = d.nextSKUID, p.ID
+		p.SKUs[i].CreatedAt, p.SKUs[i].UpdatedAt = now, now
+	}
+	stored := *p
+	stored.SKUs = append([]model.SKU(nil), p.SKUs...)
+	d.products[p.ID] = stored
+	return nil
+}
+
+type memoryOrders struct {
+	s *MemoryStore
+}
+
+func (r memoryOrders) find(match func(model.Order) bool) (model.Order, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, o := range r.s.data.orders {
+		if match(o) {
+			return o, nil
+		}
+	}
+	return model.Order{}, ErrNotFound
+}
+
+func (r memoryOrders) GetByOrderNo(_ context.Context, orderNo string) (model.Order, error) {
+	return r.find(func(o model.Order) bool { return o.OrderNo == orderNo })
+}
+
+func (r memoryOrders) GetByRequestID(_ context.Context, requestID string) (model.Order, error) {
+	return r.find(func(o model.Order) bool { return o.RequestID == requestID })
+}
+
+func (r memoryOrders) Create(_ context.Context, o *model.Order) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	d := r.s.data
+	for _, exist := range d.orders {
+		if exist.RequestID == o.RequestID || exist.OrderNo == o.OrderNo {
+			return ErrDuplicate
+		}
+	}
+	now := time.Now()
+	d.nextOrderID++
+	o.ID, o.CreatedAt, o.UpdatedAt = d.nextOrderID, now, now
+	d.orders[o.ID] = *o
+	return nil
+}
+
+func (r memoryOrders) ReserveUserQuota(_ context.Context, userID int64, productID uint, quantity, limit int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	key := purchaseKey{userID: userID, productID: productID}
+	if r.s.data.purchases[key]+quantity > limit {
+		return ErrPurchaseLimitExceeded
+	}
+	r.s.data.purchases[key] += quantity
+	return nil
+}
+
+type memoryRequests struct {
+	s *MemoryStore
+}
+
+func (r memoryRequests) Get(_ context.Context, requestID string) (model.OrderRequest, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	req, ok := r.s.data.requests[requestID]
+	if !ok {
+		return model.OrderRequest{}, ErrNotFound
+	}
+	return req, nil
+}
+
+// GetForUpdate 在内存实现中与 Get 相同：事务本身已串行执行。
+func (r memoryRequests) GetForUpdate(ctx context.Context, requestID string) (model.OrderRequest, error) {
+	return r.Get(ctx, requestID)
+}
+
+func (r memoryRequests) UpsertPending(_ context.Context, req model.OrderRequest) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	d := r.s.data
+	if _, ok := d.requests[req.RequestID]; ok {
+		return nil
+	}
+	now := time.Now()
+	d.nextRequestID++
+	req.ID, req.CreatedAt, req.UpdatedAt = d.nextRequestID, now, now
+	req.Status = model.OrderRequestPending
+	d.requests[req.RequestID] = req
+	return nil
+}
+
+func (r memoryRequests) MarkSuccess(_ context.Context, requestID, orderNo string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	req, ok := r.s.data.requests[requestID]
+	if !ok {
+		return nil
+	}
+	req.Status, req.OrderNo, req.ErrorMsg, req.UpdatedAt = model.OrderRequestSuccess, orderNo, "", time.Now()
+	r.s.data.requests[requestID] = req
+	return nil
+}
+
+func (r memoryRequests) MarkFailed(_ context.Context, requestID, reason string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	req, ok := r.s.data.requests[requestID]
+	if !ok || req.Status != model.OrderRequestPending {
+		return false, nil
+	}
+	req.Status, req.ErrorMsg, req.UpdatedAt = model.OrderRequestFailed, reason, time.Now()
+	r.s.data.requests[requestID] = req
+	return true, nil
+}
+
+func (r memoryRequests) RecordDenied(_ context.Context, req model.OrderRequest) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	d := r.s.data
+	if _, ok := d.requests[req.RequestID]; ok {
+		return ErrDuplicate
+	}
+	now := time.Now()
+	d.nextRequestID++
+	req.ID, req.CreatedAt, req.UpdatedAt = d.nextRequestID, now, now
+	req.Status = model.OrderRequestDenied
+	d.requests[req.RequestID] = req
+	return nil
+}
+
+type memoryAudit struct {
+	s *MemoryStore
+}
+
+func (r memoryAudit) Append(_ context.Context, e *model.AuditEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	d := r.s.data
+	if e.DedupKey != nil {
+		for _, existing := range d.audit {
+			if existing.DedupKey != nil && *existing.DedupKey == *e.DedupKey {
+				return nil
+			}
+		}
+	}
+	if e.Status == "" {
+		e.Status = model.AuditStatusApplied
+	}
+	d.nextAuditID++
+	e.ID, e.CreatedAt = d.nextAuditID, time.Now()
+	d.audit = append(d.audit, *e)
+	return nil
+}
+
+func (r memoryAudit) Settle(_ context.Context, e *model.AuditEvent) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for i := range r.s.data.audit {
+		existing := &r.s.data.audit[i]
+		if existing.ID == e.ID && existing.Status == model.AuditStatusPending {
+			existing.Status, existing.StockBefore, existing.Detail = e.Status, e.StockBefore, e.Detail
+			return nil
+		}
+	}
+	return ErrNotFound
+}
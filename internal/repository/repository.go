@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"flash_sale/internal/model"
+	rediskey "flash_sale/pkg/redis"
+)
+
+var (
+	// ErrNotFound 表示记录不存在。
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate 表示违反唯一约束（如重复的 request_id / order_no）。
+	ErrDuplicate = errors.New("duplicate record")
+	// ErrPurchaseLimitExceeded 表示累计购买数量超过商品的每人限购。
+	ErrPurchaseLimitExceeded = errors.New("purchase limit exceeded")
+)
+
+// ProductRepository 访问商品与 SKU。
+type ProductRepository interface {
+	// List 返回全部商品（含 SKU）。
+	List(ctx context.Context) ([]model.Product, error)
+	// Get 只读商品行，不加载 SKU。
+	Get(ctx context.Context, id uint) (model.Product, error)
+	// GetWithSKUs 读取商品并加载 SKU。
+	GetWithSKUs(ctx context.Context, id uint) (model.Product, error)
+	// Create 写入商品，p.SKUs 一并写入。
+	Create(ctx context.Context, p *model.Product) error
+}
+
+// OrderRepository 访问订单与用户累计购买数量。
+type OrderRepository interface {
+	GetByOrderNo(ctx context.Context, orderNo string) (model.Order, error)
+	GetByRequestID(ctx context.Context, requestID string) (model.Order, error)
+	// Create 写入订单；request_id / order_no 冲突返回 ErrDuplicate，且不影响所在事务的后续操作。
+	Create(ctx context.Context, o *model.Order) error
+	// ReserveUserQuota 累加用户在商品上的已购数量，超过 limit 返回 ErrPurchaseLimitExceeded。
+	// 需在事务内调用：同一用户同一商品的并发调用按行锁串行。
+	ReserveUserQuota(ctx context.Context, userID int64, productID uint, quantity, limit int) error
+}
+
+// RequestRepository 访问下单请求状态（order_requests）。
+type RequestRepository interface {
+	Get(ctx context.Context, requestID string) (model.OrderRequest, error)
+	// GetForUpdate 读取并行锁住请求行，需在事务内调用。
+	GetForUpdate(ctx context.Context, requestID string) (model.OrderRequest, error)
+	// UpsertPending 以 pending 状态写入请求，已存在则保持原样。
+	UpsertPending(ctx context.Context, req model.OrderRequest) error
+	// MarkSuccess 将请求置为成功并关联订单号。
+	MarkSuccess(ctx context.Context, requestID, orderNo string) error
+	// MarkFailed 仅允许 pending -> failed，返回是否实际更新（false 表示已是终态或不存在）。
+	MarkFailed(ctx context.Context, requestID, reason string) (bool, error)
+	// RecordDenied 以 denied 终态写入被风控拒绝的请求（未占用库存，仅用于查询与审计）。
+	RecordDenied(ctx context.Context, req model.OrderRequest) error
+}
+
+// AuditRepository 追加审计事件（audit_events 只追加，除 pending 事件执行后的结果外不提供修改与删除）。
+type AuditRepository interface {
+	// Append 写入事件，Status 为空时按 applied 写入；DedupKey 非空且已存在时忽略本次写入。
+	Append(ctx context.Context, e *model.AuditEvent) error
+	// Settle 以 e 的 Status、StockBefore 与 Detail 更新 pending 事件 e.ID（执行后才得知的结果）；
+	// 事件不存在或已不是 pending 时返回 ErrNotFound。
+	Settle(ctx context.Context, e *model.AuditEvent) error
+}
+
+// Store 聚合各仓储并提供事务边界。
+type Store interface {
+	Products() ProductRepository
+	Orders() OrderRepository
+	Requests() RequestRepository
+	Audit() AuditRepository
+	// Transaction 在事务内执行 fn，fn 内必须通过参数 tx 访问仓储；fn 返回错误时整体回滚。
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+}
+
+// RequestStateCache 为请求状态的缓存层（生产为 Redis），DB 中的 order_requests 是事实来源。
+type RequestStateCache interface {
+	// Get 查询请求状态，found=false 表示缓存未命中。
+	Get(ctx context.Context, requestID string) (rediskey.RequestState, bool, error)
+	// Put 写入请求状态并刷新过期时间，进入终态时同时移出 pending 索引。
+	Put(ctx context.Context, state rediskey.RequestState, ttl time.Duration) error
+}
+
+// RequestStateOf 将 DB 请求行映射为对外的请求状态。
+func RequestStateOf(req model.OrderRequest) rediskey.RequestState {
+	out := rediskey.RequestState{RequestID: req.RequestID}
+	switch req.Status {
+	case model.OrderRequestSuccess:
+		out.Status = rediskey.RequestSuccess
+		out.OrderNo = req.OrderNo
+	case model.OrderRequestFailed:
+		out.Status = rediskey.RequestFailed
+		out.Reason = req.ErrorMsg
+	case model.OrderRequestNotSelected:
+		out.Status = rediskey.RequestNotSelected
+	case model.OrderRequestDenied:
+		out.Status = rediskey.RequestDenied
+		out.Reason = req.ReasonCode
+	default:
+		// pending 与抽签已报名（等待开奖）对外均为 pending。
+		out.Status = rediskey.RequestPending
+	}
+	return out
+}
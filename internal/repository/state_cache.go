@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+type redisStateCache struct {
+	rdb *rd.Client
+}
+
+// NewRedisStateCache 创建基于 Redis Hash 的请求状态缓存（与下单 Lua 写入的结构一致）。
+func NewRedisStateCache(rdb *rd.Client) RequestStateCache {
+	return redisStateCache{rdb: rdb}
+}
+
+func (c redisStateCache) Get(ctx context.Context, requestID string) (rediskey.RequestState, bool, error) {
+	return rediskey.GetRequestState(ctx, c.rdb, requestID)
+}
+
+func (c redisStateCache) Put(ctx context.Context, state rediskey.RequestState, ttl time.Duration) error {
+	return rediskey.PutRequestState(ctx, c.rdb, state.RequestID, state.Status, state.OrderNo, state.Reason, ttl)
+}
+
+// MemoryStateCache 为进程内请求状态缓存，供单元测试替代 Redis；不模拟过期。
+type MemoryStateCache struct {
+	mu     sync.Mutex
+	states map[string]rediskey.RequestState
+}
+
+func NewMemoryStateCache() *MemoryStateCache {
+	return &MemoryStateCache{states: make(map[string]rediskey.RequestState)}
+}
+
+func (c *MemoryStateCache) Get(_ context.Context, requestID string) (rediskey.RequestState, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.states[requestID]
+	return st, ok, nil
+}
+
+func (c *MemoryStateCache) Put(_ context.Context, state rediskey.RequestState, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states[state.RequestID] = state
+	return nil
+}
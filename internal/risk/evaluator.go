@@ -0,0 +1,125 @@
+package risk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Decision 为风控评估结论。
+type Decision string
+
+const (
+	// Allow 放行。
+	Allow Decision = "allow"
+	// Deny 拒绝：请求以 denied 终态落库并记录原因码，不进入库存预占。
+	Deny Decision = "deny"
+	// Challenge 要求人机校验：请求已带有效的工作量证明时放行，否则提示客户端领取挑战后重试。
+	Challenge Decision = "challenge"
+)
+
+// 原因码最大长度，与 order_requests.reason_code 列一致。
+const maxReasonLen = 64
+
+// Request 为交给评估器的下单上下文。
+type Request struct {
+	ProductID uint   `json:"product_id"`
+	SKUID     uint   `json:"sku_id"`
+	UserID    int64  `json:"user_id"`
+	Quantity  int    `json:"quantity"`
+	Amount    int64  `json:"amount"`
+	IP        string `json:"ip"`
+	DeviceID  string `json:"device_id"`
+	UserAgent string `json:"user_agent"`
+}
+
+// Verdict 为评估结果。Score 仅用于记录与排查，是否拦截以 Decision 为准；Reason 为拒绝原因（如 velocity）。
+type Verdict struct {
+	Decision Decision `json:"decision"`
+	Score    float64  `json:"score"`
+	Reason   string   `json:"reason"`
+}
+
+// Evaluator 为可插拔的风控评估接口（RiskEvaluator），在黑名单之外按业务规则或外部模型给请求打分。
+// 返回错误时下单入口放行（与限流一致，风控不应成为单点拒绝源）。
+type Evaluator interface {
+	Evaluate(ctx context.Context, req Request) (Verdict, error)
+}
+
+// EvaluatorFunc 将普通函数适配为 Evaluator。
+type EvaluatorFunc func(ctx context.Context, req Request) (Verdict, error)
+
+func (f EvaluatorFunc) Evaluate(ctx context.Context, req Request) (Verdict, error) {
+	return f(ctx, req)
+}
+
+// DenyReason 返回评估拒绝时记录的原因码：risk_<reason>，reason 为空时为 risk_deny。
+func DenyReason(v Verdict) string {
+	reason := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		case r == '-' || r == ' ' || r == '.':
+			return '_'
+		default:
+			return -1
+		}
+	}, v.Reason)
+	if reason == "" {
+		reason = string(Deny)
+	}
+	code := "risk_" + reason
+	if len(code) > maxReasonLen {
+		code = code[:maxReasonLen]
+	}
+	return code
+}
+
+// HTTPEvaluator 调用外部风控服务：POST JSON 编码的 Request，期望 200 与 JSON 编码的 Verdict。
+type HTTPEvaluator struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPEvaluator(url string, timeout time.Duration) *HTTPEvaluator {
+	return &HTTPEvaluator{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (e *HTTPEvaluator) Evaluate(ctx context.Context, req Request) (Verdict, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("risk evaluator: unexpected status %d", resp.StatusCode)
+	}
+	var v Verdict
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return Verdict{}, fmt.Errorf("risk evaluator: decode verdict: %w", err)
+	}
+	switch v.Decision {
+	case Allow, Deny, Challenge:
+		return v, nil
+	default:
+		return Verdict{}, fmt.Errorf("risk evaluator: unknown decision %q", v.Decision)
+	}
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/adminkey"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// createAdminKey 签发管理密钥（管理员），明文只在响应中返回一次。
+func createAdminKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name     string   `json:"name" binding:"required,max=64"`
+			Role     string   `json:"role" binding:"required"`
+			Scopes   []string `json:"scopes"`
+			TTLHours int      `json:"ttl_hours" binding:"omitempty,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		out, err := adminkey.Create(c.Request.Context(), db, req.Name, adminkey.Role(req.Role), req.Scopes, time.Duration(req.TTLHours)*time.Hour)
+		if err != nil {
+			respondAdminKeyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// listAdminKeys 列出管理密钥（管理员），不含明文与摘要。
+func listAdminKeys(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := adminkey.List(c.Request.Context(), db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": keys})
+	}
+}
+
+// rotateAdminKey 轮换管理密钥（管理员）：签发新密钥，旧密钥立即吊销或在 grace_sec 后过期。
+func rotateAdminKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseAdminKeyID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			GraceSec int `json:"grace_sec" binding:"omitempty,min=0"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+				return
+			}
+		}
+		out, err := adminkey.Rotate(c.Request.Context(), db, id, time.Duration(req.GraceSec)*time.Second)
+		if err != nil {
+			respondAdminKeyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// revokeAdminKey 吊销管理密钥（管理员），立即生效。
+func revokeAdminKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseAdminKeyID(c)
+		if !ok {
+			return
+		}
+		out, err := adminkey.Revoke(c.Request.Context(), db, id)
+		if err != nil {
+			respondAdminKeyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+func parseAdminKeyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "密钥ID无效"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondAdminKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, adminkey.ErrKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "密钥不存在"})
+	case errors.Is(err, adminkey.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "角色只能是 viewer / operator / admin"})
+	case errors.Is(err, adminkey.ErrInvalidScope):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "权限不存在或超出角色范围"})
+	case errors.Is(err, adminkey.ErrKeyInactive):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "密钥已吊销或已过期，不能轮换"})
+	case errors.Is(err, adminkey.ErrLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "不能吊销最后一个可用的 admin 密钥"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+	}
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// listAuditEvents 查询审计事件（管理员），按 id 倒序，before_id 翻页。
+// 可按 actor、action、target_type、target_id、request_id、status、product_id 与 since / until（RFC3339）过滤。
+func listAuditEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, err := strconv.Atoi(c.DefaultQuery("count", "50"))
+		if err != nil || count <= 0 || count > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "count 取值 1-500"})
+			return
+		}
+		var beforeID uint64
+		if raw := c.Query("before_id"); raw != "" {
+			if beforeID, err = strconv.ParseUint(raw, 10, 32); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "before_id 无效"})
+				return
+			}
+		}
+		f, ok := parseAuditFilter(c)
+		if !ok {
+			return
+		}
+		list, err := audit.List(c.Request.Context(), db, f, uint(beforeID), count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": list})
+	}
+}
+
+// exportAuditEvents 以 JSON Lines 导出全部匹配的审计事件（按 id 正序），过滤参数同 listAuditEvents。
+// 导出过程中出错时响应已开始写出，只能中断并记录日志。
+func exportAuditEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f, ok := parseAuditFilter(c)
+		if !ok {
+			return
+		}
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="audit_events.jsonl"`)
+		c.Status(http.StatusOK)
+		n, err := audit.Export(c.Request.Context(), db, f, c.Writer)
+		if err != nil {
+			log.Printf("audit export aborted after %d events: %v", n, err)
+		}
+	}
+}
+
+func parseAuditFilter(c *gin.Context) (audit.Filter, bool) {
+	f := audit.Filter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+		Status:     c.Query("status"),
+	}
+	if raw := c.Query("product_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || id == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "product_id 无效"})
+			return audit.Filter{}, false
+		}
+		f.ProductID = uint(id)
+	}
+	for _, t := range []struct {
+		param string
+		dst   *time.Time
+	}{
+		{"since", &f.Since},
+		{"until", &f.Until},
+	} {
+		raw := c.Query(t.param)
+		if raw == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": t.param + " 格式错误，请用 RFC3339"})
+			return audit.Filter{}, false
+		}
+		*t.dst = v
+	}
+	return f, true
+}
+
+// prepareAudit 在执行只改 Redis / Broker 的管理操作前以 pending 写入审计事件（无法与操作同事务）。
+// 写入失败时返回 500 且不执行操作，返回 false。
+func prepareAudit(c *gin.Context, store repository.Store, events ...model.AuditEvent) ([]model.AuditEvent, bool) {
+	if err := audit.Prepare(c.Request.Context(), store, events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "审计写入失败，操作未执行：" + err.Error()})
+		return nil, false
+	}
+	return events, true
+}
+
+// settleAudit 在操作成功后将 prepareAudit 写入的事件标记为 applied。
+// 更新失败时事件保持 pending（已记录操作意图），返回 500 并说明操作已生效，返回 false。
+func settleAudit(c *gin.Context, store repository.Store, events []model.AuditEvent) bool {
+	if err := audit.Settle(c.Request.Context(), store, events); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "操作已生效，审计状态更新失败：" + err.Error()})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/campaign"
+
+	"github.com/gin-gonic/gin"
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// createCampaign 创建活动并纳入商品，预热/开始/清理由后台调度器按时间窗推进。
+func createCampaign(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name       string `json:"name" binding:"required"`
+			StartTime  string `json:"start_time" binding:"required"`
+			EndTime    string `json:"end_time" binding:"required"`
+			ProductIDs []uint `json:"product_ids" binding:"required,min=1,dive,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		start, err := time.Parse(time.RFC3339, req.StartTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "start_time 格式错误，请用 RFC3339"})
+			return
+		}
+		end, err := time.Parse(time.RFC3339, req.EndTime)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "end_time 格式错误，请用 RFC3339"})
+			return
+		}
+		out, err := campaign.Create(c.Request.Context(), db, req.Name, start, end, req.ProductIDs)
+		if err != nil {
+			respondCampaignError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// listCampaigns 查询活动列表。
+func listCampaigns(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := campaign.List(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": list})
+	}
+}
+
+// getCampaign 查询活动详情（含商品与 SKU）。
+func getCampaign(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "活动ID无效"})
+			return
+		}
+		out, err := campaign.Get(db, uint(id))
+		if err != nil {
+			respondCampaignError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// updateCampaignStock 修改活动内商品/SKU 库存，活动开始后库存冻结。
+func updateCampaignStock(db *gorm.DB, rdb *rd.Client, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "活动ID无效"})
+			return
+		}
+		var req struct {
+			ProductID uint  `json:"product_id" binding:"required,min=1"`
+			SKUID     uint  `json:"sku_id" binding:"omitempty,min=1"`
+			Stock     int64 `json:"stock" binding:"min=0"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		if err := campaign.UpdateStock(c.Request.Context(), db, rdb, uint(id), req.ProductID, req.SKUID, req.Stock, ttl); err != nil {
+			respondCampaignError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "库存已更新"})
+	}
+}
+
+func respondCampaignError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, campaign.ErrCampaignNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "活动不存在"})
+	case errors.Is(err, campaign.ErrStockTargetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "商品或 SKU 不属于该活动"})
+	case errors.Is(err, campaign.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "end_time 必须晚于 start_time 且晚于当前时间"})
+	case errors.Is(err, campaign.ErrProductUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "商品不存在或已属于其他活动"})
+	case errors.Is(err, campaign.ErrStockFrozen):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "活动已开始，库存已冻结"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+	}
+}
@@ -0,0 +1,43 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"flash_sale/internal/pow"
+	"flash_sale/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getChallenge 签发下单用的工作量证明挑战（绑定商品与用户），难度随当前入口 QPS 调整。
+// 客户端求解后在 /buy 请求头携带 X-PoW-Challenge 与 X-PoW-Solution。
+func getChallenge(gate *pow.Gate, products repository.ProductRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, userID, ok := parseProductUserQuery(c)
+		if !ok {
+			return
+		}
+		prod, err := products.Get(c.Request.Context(), productID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "商品不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		if time.Now().After(prod.EndTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "秒杀已结束"})
+			return
+		}
+
+		challenge, err := gate.Issue(c.Request.Context(), productID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": challenge})
+	}
+}
@@ -0,0 +1,155 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/queue"
+	"flash_sale/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listStreamDLQ 分页查询 Relay 死信流，start 为上一页最后一条 ID 之后的起点（"(" 前缀表示不含）。
+func listStreamDLQ(q *queue.StreamDLQ) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, err := strconv.ParseInt(c.DefaultQuery("count", "50"), 10, 64)
+		if err != nil || count <= 0 || count > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "count 取值 1-500"})
+			return
+		}
+		list, err := q.List(c.Request.Context(), c.Query("start"), count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": list})
+	}
+}
+
+// getStreamDLQ 查询单条 Relay 死信。
+func getStreamDLQ(q *queue.StreamDLQ) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dl, err := q.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			respondDLQError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": dl})
+	}
+}
+
+// redriveStreamDLQ 将 Relay 死信重新写回 outbox stream，并记录 dlq.redrive 审计事件。
+func redriveStreamDLQ(q *queue.StreamDLQ, store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		events, ok := prepareAudit(c, store, audit.New(c.Request.Context(), audit.ActionDLQRedrive, audit.TargetDLQ, "stream:"+c.Param("id")))
+		if !ok {
+			return
+		}
+		newID, err := q.Redrive(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			audit.Fail(c.Request.Context(), store, events, err)
+			respondDLQError(c, err)
+			return
+		}
+		events[0].Detail = map[string]any{"stream_id": newID}
+		if !settleAudit(c, store, events) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"stream_id": newID}})
+	}
+}
+
+// listBrokerDLQ 按分区 + offset 查询消费端死信（Kafka / 内存 Broker）。
+func listBrokerDLQ(q *queue.BrokerDLQ) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		partition, err := strconv.Atoi(c.DefaultQuery("partition", "0"))
+		if err != nil || partition < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "partition 无效"})
+			return
+		}
+		offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "offset 无效"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit <= 0 || limit > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "limit 取值 1-500"})
+			return
+		}
+		list, err := q.List(c.Request.Context(), partition, offset, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": list})
+	}
+}
+
+// getBrokerDLQ 查询单条消费端死信。
+func getBrokerDLQ(q *queue.BrokerDLQ) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		partition, offset, ok := parsePartitionOffset(c)
+		if !ok {
+			return
+		}
+		dl, err := q.Get(c.Request.Context(), partition, offset)
+		if err != nil {
+			respondDLQError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": dl})
+	}
+}
+
+// redriveBrokerDLQ 将消费端死信重新发布到下单 topic（同一条最多重投一次），并记录 dlq.redrive 审计事件。
+func redriveBrokerDLQ(q *queue.BrokerDLQ, store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		partition, offset, ok := parsePartitionOffset(c)
+		if !ok {
+			return
+		}
+		events, ok := prepareAudit(c, store, audit.New(c.Request.Context(), audit.ActionDLQRedrive, audit.TargetDLQ, fmt.Sprintf("broker:%d:%d", partition, offset)))
+		if !ok {
+			return
+		}
+		if err := q.Redrive(c.Request.Context(), partition, offset); err != nil {
+			audit.Fail(c.Request.Context(), store, events, err)
+			respondDLQError(c, err)
+			return
+		}
+		if !settleAudit(c, store, events) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "msg": "重投成功"})
+	}
+}
+
+func parsePartitionOffset(c *gin.Context) (int, int64, bool) {
+	partition, err := strconv.Atoi(c.Param("partition"))
+	if err != nil || partition < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "partition 无效"})
+		return 0, 0, false
+	}
+	offset, err := strconv.ParseInt(c.Param("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "offset 无效"})
+		return 0, 0, false
+	}
+	return partition, offset, true
+}
+
+func respondDLQError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, queue.ErrDeadLetterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "死信不存在"})
+	case errors.Is(err, queue.ErrAlreadyRedriven):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "该死信已重投"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+	}
+}
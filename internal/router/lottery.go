@@ -0,0 +1,170 @@
+package router
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/lottery"
+
+	"github.com/gin-gonic/gin"
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// createLottery 为商品创建抽签（商品需无 SKU、未纳入活动），中签名额为商品库存。
+func createLottery(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ProductID     uint   `json:"product_id" binding:"required,min=1"`
+			RegisterStart string `json:"register_start" binding:"required"`
+			RegisterEnd   string `json:"register_end" binding:"required"`
+			DrawAt        string `json:"draw_at"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		start, err := time.Parse(time.RFC3339, req.RegisterStart)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "register_start 格式错误，请用 RFC3339"})
+			return
+		}
+		end, err := time.Parse(time.RFC3339, req.RegisterEnd)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "register_end 格式错误，请用 RFC3339"})
+			return
+		}
+		// 未指定开奖时间时报名结束即开奖。
+		drawAt := end
+		if req.DrawAt != "" {
+			if drawAt, err = time.Parse(time.RFC3339, req.DrawAt); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "draw_at 格式错误，请用 RFC3339"})
+				return
+			}
+		}
+
+		out, err := lottery.Create(c.Request.Context(), db, req.ProductID, start, end, drawAt)
+		if err != nil {
+			respondLotteryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// getLottery 查询抽签（开奖前只公开种子承诺）。
+func getLottery(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseLotteryID(c)
+		if !ok {
+			return
+		}
+		out, err := lottery.Get(db, id)
+		if err != nil {
+			respondLotteryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// registerLottery 报名抽签，返回 request_id：开奖前 /result 为 pending，开奖后为订单结果或 not_selected。
+func registerLottery(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseLotteryID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			UserID int64 `json:"user_id" binding:"omitempty,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		if req.UserID, ok = resolveUserID(c, req.UserID); !ok {
+			return
+		}
+		entry, err := lottery.Register(c.Request.Context(), db, id, req.UserID)
+		if err != nil {
+			respondLotteryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code": 0,
+			"data": gin.H{
+				"request_id": entry.RequestID,
+				"status":     "pending",
+			},
+		})
+	}
+}
+
+// getLotteryDrawLog 返回开奖明细（种子、算法、全部报名者的分值与排名），供审计复算。
+func getLotteryDrawLog(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseLotteryID(c)
+		if !ok {
+			return
+		}
+		out, err := lottery.DrawLog(db, id)
+		if err != nil {
+			respondLotteryError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// drawLottery 报名结束后立即开奖并投递中签请求（无需等到 draw_at）。
+// 投递失败不影响开奖结果，由 Drawer 下一轮重试。
+func drawLottery(db *gorm.DB, rdb *rd.Client, stream string, stateTTL time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseLotteryID(c)
+		if !ok {
+			return
+		}
+		out, err := lottery.Draw(c.Request.Context(), db, id)
+		if err != nil {
+			respondLotteryError(c, err)
+			return
+		}
+		if err := lottery.Dispatch(c.Request.Context(), db, rdb, stream, id, stateTTL); err != nil {
+			log.Printf("lottery dispatch id=%d: %v", id, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+func parseLotteryID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "抽签ID无效"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondLotteryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, lottery.ErrLotteryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "抽签不存在"})
+	case errors.Is(err, lottery.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "register_end 必须晚于 register_start 且晚于当前时间，draw_at 不得早于 register_end"})
+	case errors.Is(err, lottery.ErrProductUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "商品不存在、含 SKU、已属于活动或已设置抽签"})
+	case errors.Is(err, lottery.ErrRegistrationClosed):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "不在报名时间内"})
+	case errors.Is(err, lottery.ErrNotDrawn):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "尚未开奖"})
+	case errors.Is(err, lottery.ErrDrawTooEarly):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "报名尚未结束"})
+	case errors.Is(err, lottery.ErrAlreadyDrawn):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "已开奖"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+	}
+}
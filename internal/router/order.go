@@ -0,0 +1,141 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/order"
+	"flash_sale/internal/repository"
+
+	"github.com/gin-gonic/gin"
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// orderActionRequest 是支付/取消接口的请求体，user_id 用于校验订单归属（开启 JWT 时以令牌为准）。
+type orderActionRequest struct {
+	UserID int64  `json:"user_id" binding:"omitempty,min=1"`
+	Reason string `json:"reason" binding:"omitempty,max=255"`
+}
+
+// getOrder 查询订单详情，仅订单所属用户可查看。
+func getOrder(orders repository.OrderRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		o, ok := loadOwnOrder(c, orders)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": o})
+	}
+}
+
+// payOrder 支付订单：仅允许 待支付 -> 已支付。
+func payOrder(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req orderActionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		userID, ok := resolveUserID(c, req.UserID)
+		if !ok {
+			return
+		}
+		o, err := order.Pay(db, c.Param("order_no"), userID)
+		if err != nil {
+			respondTransitionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": o})
+	}
+}
+
+// cancelOrder 取消订单：仅允许 待支付 -> 已取消，成功后归还 Redis 库存与限购额度。
+func cancelOrder(db *gorm.DB, rdb *rd.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req orderActionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		userID, ok := resolveUserID(c, req.UserID)
+		if !ok {
+			return
+		}
+		reason := req.Reason
+		if reason == "" {
+			reason = "user_cancelled"
+		}
+		o, err := order.Cancel(db, c.Param("order_no"), userID, reason)
+		if err != nil {
+			respondTransitionError(c, err)
+			return
+		}
+		// DB 已是事实来源：Redis 归还失败只记录日志，由超时任务按 stock_released 补做。
+		ctx := audit.WithActor(c.Request.Context(), fmt.Sprintf("user:%d", userID))
+		if err := order.ReleaseReservation(ctx, db, rdb, o); err != nil {
+			log.Printf("cancel order release reservation order_no=%s: %v", o.OrderNo, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": o})
+	}
+}
+
+// listOrderTransitions 查询订单状态流转历史，仅订单所属用户可查看。
+func listOrderTransitions(db *gorm.DB, orders repository.OrderRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		o, ok := loadOwnOrder(c, orders)
+		if !ok {
+			return
+		}
+		list, err := order.ListTransitions(db, o.OrderNo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": list})
+	}
+}
+
+// loadOwnOrder 按路径中的 order_no 加载订单并校验归属（用户身份同 resolveUserID，未开启 JWT 时取 ?user_id=）。
+// 失败时已写入响应。
+func loadOwnOrder(c *gin.Context, orders repository.OrderRepository) (model.Order, bool) {
+	userID, ok := parseUserQuery(c)
+	if !ok {
+		return model.Order{}, false
+	}
+	o, err := orders.GetByOrderNo(c.Request.Context(), c.Param("order_no"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "订单不存在"})
+			return model.Order{}, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return model.Order{}, false
+	}
+	if o.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "无权查看该订单"})
+		return model.Order{}, false
+	}
+	return o, true
+}
+
+func respondTransitionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, order.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "订单不存在"})
+	case errors.Is(err, order.ErrNotOwner):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "无权操作该订单"})
+	case errors.Is(err, order.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": err.Error()})
+	case errors.Is(err, order.ErrOrderExpired):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "订单已超过支付时限"})
+	case errors.Is(err, order.ErrVersionConflict):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "订单正在被并发修改，请重试"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+	}
+}
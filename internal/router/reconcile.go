@@ -0,0 +1,32 @@
+package router
+
+import (
+	"net/http"
+
+	"flash_sale/internal/reconcile"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reconcileStock 库存对账：默认 dry-run 只返回报告，apply=true 时修复差异。
+// 建议在活动结束、下单链路排空后调用。
+func reconcileStock(r *reconcile.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ProductIDs []uint `json:"product_ids" binding:"omitempty,dive,min=1"`
+			Apply      bool   `json:"apply"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+				return
+			}
+		}
+		report, err := r.Run(c.Request.Context(), req.ProductIDs, req.Apply)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": report})
+	}
+}
@@ -0,0 +1,112 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+
+	"flash_sale/internal/registration"
+
+	"github.com/gin-gonic/gin"
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// registerProduct 开售前预约商品，重复预约返回原记录。
+func registerProduct(db *gorm.DB, rdb *rd.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := parseProductID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			UserID int64 `json:"user_id" binding:"omitempty,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		if req.UserID, ok = resolveUserID(c, req.UserID); !ok {
+			return
+		}
+		out, err := registration.Register(c.Request.Context(), db, rdb, productID, req.UserID)
+		if err != nil {
+			respondRegistrationError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// getRegistration 查询用户是否已预约商品。
+func getRegistration(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, userID, ok := parseProductUserQuery(c)
+		if !ok {
+			return
+		}
+		registered, err := registration.IsRegistered(c.Request.Context(), db, productID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+			"product_id": productID,
+			"user_id":    userID,
+			"registered": registered,
+		}})
+	}
+}
+
+// getRegistrationStats 查询商品预约人数（管理员），用于开售前估算需求与预热库存。
+func getRegistrationStats(db *gorm.DB, rdb *rd.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := parseProductID(c)
+		if !ok {
+			return
+		}
+		out, err := registration.GetStats(c.Request.Context(), db, rdb, productID)
+		if err != nil {
+			respondRegistrationError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": out})
+	}
+}
+
+// setRegistrationRequired 开启或关闭商品的预约要求（管理员），仅开售前可修改。
+func setRegistrationRequired(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := parseProductID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			Required *bool `json:"required" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		if err := registration.SetRequired(c.Request.Context(), db, productID, *req.Required); err != nil {
+			respondRegistrationError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{
+			"product_id":           productID,
+			"require_registration": *req.Required,
+		}})
+	}
+}
+
+func respondRegistrationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, registration.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "商品不存在"})
+	case errors.Is(err, registration.ErrRegistrationClosed):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "商品已开售，预约已截止"})
+	case errors.Is(err, registration.ErrSaleStarted):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "商品已开售，不能修改预约要求"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+	}
+}
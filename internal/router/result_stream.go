@@ -0,0 +1,201 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"flash_sale/internal/notify"
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var resultUpgrader = websocket.Upgrader{
+	// 结果推送只读且不依赖 Cookie，允许跨域页面直接连接。
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamResultSSE 以 Server-Sent Events 推送请求结果：先推当前状态，进入终态后推送并断开。
+// 超时未出结果时直接断开，EventSource 会自动重连继续等待。
+func streamResultSSE(hub *notify.ResultHub, requests repository.RequestRepository, states repository.RequestStateCache, timeout, heartbeat time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqID := c.Param("request_id")
+		// 先订阅再查当前状态，避免两者之间写入的终态事件被漏掉。
+		updates, cancel := hub.Subscribe(reqID)
+		defer cancel()
+
+		state, ok := initialResultState(c, requests, states, reqID)
+		if !ok {
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		// 关闭 Nginx 等反向代理的响应缓冲，保证事件即时到达。
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		ctx, stop := context.WithTimeout(c.Request.Context(), timeout)
+		defer stop()
+
+		emit := func(st rediskey.RequestState) error {
+			payload, err := json.Marshal(resultPayload(st))
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(c.Writer, "event: result\ndata: %s\n\n", payload); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			return nil
+		}
+		ping := func() error {
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			return nil
+		}
+		reload := func(ctx context.Context) (rediskey.RequestState, bool, error) {
+			return loadRequestState(ctx, requests, states, reqID, 24*time.Hour)
+		}
+		if err := watchResult(ctx, state, updates, reload, heartbeat, emit, ping); err != nil {
+			log.Printf("result sse %s: %v", reqID, err)
+		}
+	}
+}
+
+// streamResultWS 以 WebSocket 推送请求结果，消息体与结果查询接口一致；
+// 进入终态后以 1000 关闭连接（reason=done），超时则以 reason=timeout 关闭。
+func streamResultWS(hub *notify.ResultHub, requests repository.RequestRepository, states repository.RequestStateCache, timeout, heartbeat time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqID := c.Param("request_id")
+		updates, cancel := hub.Subscribe(reqID)
+		defer cancel()
+
+		state, ok := initialResultState(c, requests, states, reqID)
+		if !ok {
+			return
+		}
+
+		conn, err := resultUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// Upgrade 失败时已向客户端写回 HTTP 错误。
+			return
+		}
+		defer conn.Close()
+
+		ctx, stop := context.WithTimeout(c.Request.Context(), timeout)
+		defer stop()
+
+		// 客户端不需要发送消息；读循环只用于处理控制帧并感知断开。
+		go func() {
+			defer stop()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		writeWait := heartbeat
+		emit := func(st rediskey.RequestState) error {
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			return conn.WriteJSON(resultPayload(st))
+		}
+		ping := func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		}
+		reload := func(ctx context.Context) (rediskey.RequestState, bool, error) {
+			return loadRequestState(ctx, requests, states, reqID, 24*time.Hour)
+		}
+
+		err = watchResult(ctx, state, updates, reload, heartbeat, emit, ping)
+		reason := "done"
+		switch {
+		case err != nil:
+			log.Printf("result ws %s: %v", reqID, err)
+			return
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			reason = "timeout"
+		case ctx.Err() != nil:
+			// 客户端已断开。
+			return
+		}
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	}
+}
+
+// initialResultState 查询推送开始前的状态；不存在或查询失败时按结果接口的格式直接响应并返回 false。
+func initialResultState(c *gin.Context, requests repository.RequestRepository, states repository.RequestStateCache, reqID string) (rediskey.RequestState, bool) {
+	state, found, err := loadRequestState(c.Request.Context(), requests, states, reqID, 24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		return rediskey.RequestState{}, false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "request_id 不存在"})
+		return rediskey.RequestState{}, false
+	}
+	return state, true
+}
+
+// resultPayload 构造推送消息体，与结果查询接口的 JSON 一致。
+func resultPayload(state rediskey.RequestState) gin.H {
+	data, ok := resultData(state)
+	if !ok {
+		return gin.H{"code": 500, "msg": "unknown request status"}
+	}
+	return gin.H{"code": 0, "data": data}
+}
+
+// watchResult 推送当前状态后等待终态：优先消费 hub 事件，每个心跳周期回查一次缓存 / DB 兜底
+// （pub/sub 断线期间的事件会丢失，跨实例的订阅也可能晚于发布）。
+// 推送终态或 ctx 结束时返回 nil，写入失败（客户端已断开）时返回错误。
+func watchResult(
+	ctx context.Context,
+	state rediskey.RequestState,
+	updates <-chan rediskey.RequestState,
+	reload func(ctx context.Context) (rediskey.RequestState, bool, error),
+	heartbeat time.Duration,
+	emit func(rediskey.RequestState) error,
+	ping func() error,
+) error {
+	if err := emit(state); err != nil {
+		return err
+	}
+	if state.Status != rediskey.RequestPending {
+		return nil
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case st := <-updates:
+			return emit(st)
+		case <-ticker.C:
+			st, found, err := reload(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("result stream reload %s: %v", state.RequestID, err)
+			}
+			if err == nil && found && st.Status != rediskey.RequestPending {
+				return emit(st)
+			}
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package router
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"flash_sale/internal/audit"
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	"flash_sale/internal/risk"
+
+	"github.com/gin-gonic/gin"
+	rd "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// denyRequest 以 denied 终态记录被风控拒绝的请求并返回 403；记录失败只打日志，不影响拒绝。
+func denyRequest(c *gin.Context, requests repository.RequestRepository, req model.OrderRequest, msg string) {
+	if err := requests.RecordDenied(c.Request.Context(), req); err != nil {
+		log.Printf("record denied request %s: %v", req.RequestID, err)
+	}
+	c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": msg, "data": gin.H{
+		"request_id": req.RequestID,
+		"status":     "denied",
+		"reason":     req.ReasonCode,
+	}})
+}
+
+// listBlacklist 按游标分页查询某一维度的黑名单（管理员）。
+func listBlacklist(rdb *rd.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind, ok := parseBlacklistKind(c)
+		if !ok {
+			return
+		}
+		cursor, err := strconv.ParseUint(c.DefaultQuery("cursor", "0"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "cursor 无效"})
+			return
+		}
+		count, err := strconv.ParseInt(c.DefaultQuery("count", "100"), 10, 64)
+		if err != nil || count <= 0 || count > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "count 取值 1-1000"})
+			return
+		}
+		page, err := risk.List(c.Request.Context(), rdb, kind, cursor, count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": page})
+	}
+}
+
+type blacklistRequest struct {
+	Values []string `json:"values" binding:"required,min=1,max=1000"`
+}
+
+// addBlacklist 批量加入黑名单（管理员），立即对后续下单生效，并记录 blacklist.add 审计事件。
+func addBlacklist(rdb *rd.Client, store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind, ok := parseBlacklistKind(c)
+		if !ok {
+			return
+		}
+		var req blacklistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		e := audit.New(c.Request.Context(), audit.ActionBlacklistAdd, audit.TargetBlacklist, string(kind))
+		e.Detail = map[string]any{"values": req.Values}
+		events, ok := prepareAudit(c, store, e)
+		if !ok {
+			return
+		}
+		added, err := risk.Block(c.Request.Context(), rdb, kind, req.Values)
+		if err != nil {
+			audit.Fail(c.Request.Context(), store, events, err)
+			respondBlacklistError(c, err)
+			return
+		}
+		events[0].Detail["added"] = added
+		if !settleAudit(c, store, events) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"kind": kind, "added": added}})
+	}
+}
+
+// removeBlacklist 批量移出黑名单（管理员），并记录 blacklist.remove 审计事件。
+func removeBlacklist(rdb *rd.Client, store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind, ok := parseBlacklistKind(c)
+		if !ok {
+			return
+		}
+		var req blacklistRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		e := audit.New(c.Request.Context(), audit.ActionBlacklistRemove, audit.TargetBlacklist, string(kind))
+		e.Detail = map[string]any{"values": req.Values}
+		events, ok := prepareAudit(c, store, e)
+		if !ok {
+			return
+		}
+		removed, err := risk.Unblock(c.Request.Context(), rdb, kind, req.Values)
+		if err != nil {
+			audit.Fail(c.Request.Context(), store, events, err)
+			respondBlacklistError(c, err)
+			return
+		}
+		events[0].Detail["removed"] = removed
+		if !settleAudit(c, store, events) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"kind": kind, "removed": removed}})
+	}
+}
+
+// listDenials 查询被风控拒绝的请求（管理员），按 id 倒序，可按商品、用户、原因码过滤，before_id 翻页。
+func listDenials(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, err := strconv.Atoi(c.DefaultQuery("count", "50"))
+		if err != nil || count <= 0 || count > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "count 取值 1-500"})
+			return
+		}
+		q := db.WithContext(c.Request.Context()).Where("status = ?", model.OrderRequestDenied)
+		for _, f := range []struct{ param, cond string }{
+			{"product_id", "product_id = ?"},
+			{"user_id", "user_id = ?"},
+			{"before_id", "id < ?"},
+		} {
+			raw := c.Query(f.param)
+			if raw == "" {
+				continue
+			}
+			v, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": f.param + " 无效"})
+				return
+			}
+			q = q.Where(f.cond, v)
+		}
+		if code := c.Query("reason_code"); code != "" {
+			q = q.Where("reason_code = ?", code)
+		}
+		var list []model.OrderRequest
+		if err := q.Order("id DESC").Limit(count).Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": list})
+	}
+}
+
+func parseBlacklistKind(c *gin.Context) (risk.Kind, bool) {
+	kind, ok := risk.ParseKind(c.Param("kind"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "黑名单类型只能是 user / ip / device"})
+		return "", false
+	}
+	return kind, true
+}
+
+func respondBlacklistError(c *gin.Context, err error) {
+	if errors.Is(err, risk.ErrInvalidEntry) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "黑名单取值不合法（user 为正整数，ip 为合法地址，device 不超过 128 字符）"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+}
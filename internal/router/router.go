@@ -3,14 +3,27 @@ package router
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"flash_sale/internal/adminkey"
+	"flash_sale/internal/audit"
+	"flash_sale/internal/auth"
 	"flash_sale/internal/config"
 	"flash_sale/internal/middleware"
 	"flash_sale/internal/model"
+	"flash_sale/internal/notify"
+	"flash_sale/internal/pow"
+	"flash_sale/internal/queue"
+	"flash_sale/internal/reconcile"
+	"flash_sale/internal/registration"
+	"flash_sale/internal/repository"
+	"flash_sale/internal/risk"
+	"flash_sale/internal/waitroom"
 	rediskey "flash_sale/pkg/redis"
 
 	"github.com/gin-gonic/gin"
@@ -19,86 +32,111 @@ import (
 	"gorm.io/gorm"
 )
 
-// luaReserveRequest 原子完成：
-// 1) 幂等键命中直接返回历史 request_id
-// 2) 一人一单锁校验
-// 3) 库存校验与扣减
-// 4) 写 request 状态 pending
-// 5) 写用户锁与幂等映射
-const luaReserveRequest = `
-local stockKey = KEYS[1]
-local userLockKey = KEYS[2]
-local requestStateKey = KEYS[3]
-local idemKey = KEYS[4]
-local streamKey = KEYS[5]
-
-local quantity = tonumber(ARGV[1])
-local requestID = ARGV[2]
-local userID = ARGV[3]
-local productID = ARGV[4]
-local amount = ARGV[5]
-local requestTTL = tonumber(ARGV[6])
-local userLockTTL = tonumber(ARGV[7])
-local idemTTL = tonumber(ARGV[8])
-
-local existingReq = redis.call('GET', idemKey)
-if existingReq then
-  return 'IDEMPOTENT:' .. existingReq
-end
-
-if redis.call('EXISTS', userLockKey) == 1 then
-  return 'DUPLICATE'
-end
-
-local current = tonumber(redis.call('GET', stockKey) or '0')
-if current < quantity then
-  return 'OUT_OF_STOCK'
-end
-
-redis.call('DECRBY', stockKey, quantity)
-redis.call('SET', userLockKey, requestID, 'EX', userLockTTL)
-redis.call('SET', idemKey, requestID, 'EX', idemTTL)
-redis.call('HSET', requestStateKey,
-  'request_id', requestID,
-  'status', 'pending',
-  'order_no', '',
-  'reason', '',
-  'user_id', userID,
-  'product_id', productID,
-  'quantity', quantity,
-  'amount', amount
-)
-redis.call('EXPIRE', requestStateKey, requestTTL)
-redis.call('XADD', streamKey, '*',
-  'request_id', requestID,
-  'product_id', productID,
-  'user_id', userID,
-  'quantity', quantity,
-  'amount', amount
-)
-return 'OK'
-`
-
 // Setup 注册全部 HTTP 路由。
-func Setup(r *gin.Engine, db *gorm.DB, rdb *rd.Client, cfg config.AppConfig) {
+// 商品、订单、请求状态的读写经由仓储接口；订单状态机、活动与对账仍直接使用 db。
+// room 为 nil 表示未开启等待室；verifier 为 nil 表示未开启 JWT（用户身份取自请求中的 user_id）；
+// gate 为 nil 表示不提供工作量证明挑战，非 nil 时按 cfg.PowEnabled 决定下单是否强制校验；
+// evaluator 为 nil 表示只做黑名单拦截。
+func Setup(r *gin.Engine, db *gorm.DB, rdb *rd.Client, cfg config.AppConfig, brokerDLQ *queue.BrokerDLQ, hub *notify.ResultHub, room *waitroom.Room, verifier *auth.Verifier, gate *pow.Gate, evaluator risk.Evaluator) {
+	store := repository.NewGormStore(db)
+	states := repository.NewRedisStateCache(rdb)
+	inventory := repository.NewRedisInventory(rdb, cfg.OrderEventStream)
+	// 以用户身份操作的接口先校验 JWT，再按令牌中的用户限流。
+	userAuth := middleware.RequireJWT(verifier)
+	buyLimit := middleware.RedisRateLimit(rdb, cfg.BuyRateLimit, cfg.BuyRateWindow)
+	// 开启请求签名时 /buy 先验签并登记 nonce，重放的请求不进入限流与下单。
+	var signingKeys map[string]string
+	if cfg.SignedRequestsEnabled {
+		signingKeys = cfg.SigningKeys
+	}
+	signed := middleware.VerifySignature(rdb, signingKeys, cfg.SignatureMaxSkew)
+	// 管理接口：先校验 API 密钥，再按路由检查权限（角色 viewer / operator / admin）。
+	adminAuth := middleware.RequireAdminKey(db)
+	scope := middleware.RequireScope
+
+	// 响应头回写 X-Request-Id，管理操作的审计事件以它关联请求。
+	r.Use(middleware.RequestID())
+
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"msg": "pong"})
 	})
 	// Products
-	r.GET("/api/products", listProducts(db))
-	r.POST("/api/products", createProduct(db))
+	r.GET("/api/products", listProducts(store.Products()))
+	r.POST("/api/products", adminAuth, scope(adminkey.ScopeProductsWrite), createProduct(store))
 	// flash Sale
-	r.POST("/api/flash_sale/preload/:product_id", preloadStock(db, rdb, cfg.PreloadAdminToken, cfg.StockCacheTTL))
+	r.POST("/api/flash_sale/preload/:product_id", adminAuth, scope(adminkey.ScopeStockPreload), preloadStock(db, store, rdb, cfg.StockCacheTTL))
 	r.GET("/api/flash_sale/stock/:product_id", getStock(rdb))
-	r.POST("/api/flash_sale/buy", middleware.RedisRateLimit(rdb, cfg.BuyRateLimit, cfg.BuyRateWindow), secKill(db, rdb, cfg.StockCacheTTL, cfg.OrderEventStream))
-	r.GET("/api/flash_sale/result/:request_id", getResult(db, rdb))
+	r.POST("/api/flash_sale/buy", userAuth, signed, buyLimit, secKill(store, states, inventory, room, gate, cfg.PowEnabled, evaluator, cfg.StockCacheTTL))
+	r.GET("/api/flash_sale/result/:request_id", getResult(hub, store.Requests(), states, cfg.ResultWaitMax, cfg.ResultStreamHeartbeat))
+	r.GET("/api/flash_sale/result/:request_id/stream", streamResultSSE(hub, store.Requests(), states, cfg.ResultStreamTimeout, cfg.ResultStreamHeartbeat))
+	r.GET("/api/flash_sale/result/:request_id/ws", streamResultWS(hub, store.Requests(), states, cfg.ResultStreamTimeout, cfg.ResultStreamHeartbeat))
+	// 工作量证明：先领取并求解挑战，再凭解下单（未强制开启时仅在风控要求人机校验后使用）
+	if gate != nil {
+		r.GET("/api/flash_sale/challenge/:product_id", userAuth, getChallenge(gate, store.Products()))
+	}
+	// 开售前预约：要求预约的商品只有预约用户可以下单
+	r.POST("/api/flash_sale/registration/:product_id", userAuth, buyLimit, registerProduct(db, rdb))
+	r.GET("/api/flash_sale/registration/:product_id", userAuth, getRegistration(db))
+	// 等待室：排队、查询位置（轮询 / SSE），放行后凭准入凭证下单
+	if room != nil {
+		r.POST("/api/flash_sale/waiting_room/:product_id/join", userAuth, joinWaitingRoom(room, store.Products()))
+		r.GET("/api/flash_sale/waiting_room/:product_id/position", userAuth, getWaitingRoomPosition(room))
+		r.GET("/api/flash_sale/waiting_room/:product_id/position/stream", userAuth, streamWaitingRoomPosition(room, cfg.WaitingRoomAdmitInterval, cfg.ResultStreamTimeout))
+	}
+	// 抽签发售：报名、查询、开奖明细（中签请求走 /result 查询）
+	r.GET("/api/lotteries/:id", getLottery(db))
+	r.POST("/api/lotteries/:id/register", userAuth, buyLimit, registerLottery(db))
+	r.GET("/api/lotteries/:id/draw", getLotteryDrawLog(db))
+	// Orders（支付状态机）
+	r.GET("/api/orders/:order_no", userAuth, getOrder(store.Orders()))
+	r.GET("/api/orders/:order_no/transitions", userAuth, listOrderTransitions(db, store.Orders()))
+	r.POST("/api/orders/:order_no/pay", userAuth, payOrder(db))
+	r.POST("/api/orders/:order_no/cancel", userAuth, cancelOrder(db, rdb))
+	// Admin：死信查询与重投
+	streamDLQ := queue.NewStreamDLQ(rdb, cfg.OrderEventStream)
+	admin := r.Group("/api/admin", adminAuth)
+	admin.GET("/dlq/stream", scope(adminkey.ScopeDLQRead), listStreamDLQ(streamDLQ))
+	admin.GET("/dlq/stream/:id", scope(adminkey.ScopeDLQRead), getStreamDLQ(streamDLQ))
+	admin.POST("/dlq/stream/:id/redrive", scope(adminkey.ScopeDLQRedrive), redriveStreamDLQ(streamDLQ, store))
+	// Admin：活动（调度器负责预热/开始/清理）
+	admin.POST("/campaigns", scope(adminkey.ScopeCampaignsWrite), createCampaign(db))
+	admin.GET("/campaigns", scope(adminkey.ScopeCampaignsRead), listCampaigns(db))
+	admin.GET("/campaigns/:id", scope(adminkey.ScopeCampaignsRead), getCampaign(db))
+	admin.PUT("/campaigns/:id/stock", scope(adminkey.ScopeCampaignsWrite), updateCampaignStock(db, rdb, cfg.StockCacheTTL))
+	// Admin：预约统计与预约要求开关
+	admin.GET("/registrations/:product_id", scope(adminkey.ScopeRegistrationsRead), getRegistrationStats(db, rdb))
+	admin.PUT("/products/:product_id/registration", scope(adminkey.ScopeRegistrationsWrite), setRegistrationRequired(db))
+	// Admin：抽签（到点由 Drawer 开奖，也可在报名结束后手动开奖）
+	admin.POST("/lotteries", scope(adminkey.ScopeLotteriesWrite), createLottery(db))
+	admin.POST("/lotteries/:id/draw", scope(adminkey.ScopeLotteriesWrite), drawLottery(db, rdb, cfg.OrderEventStream, cfg.StockCacheTTL))
+	// Admin：库存对账（Redis vs DB）
+	admin.POST("/reconcile", scope(adminkey.ScopeReconcile), reconcileStock(reconcile.NewReconciler(db, rdb, cfg.OrderEventStream)))
+	// Admin：风控黑名单（user / ip / device）与拒绝记录
+	admin.GET("/risk/blacklist/:kind", scope(adminkey.ScopeRiskRead), listBlacklist(rdb))
+	admin.POST("/risk/blacklist/:kind", scope(adminkey.ScopeRiskWrite), addBlacklist(rdb, store))
+	admin.DELETE("/risk/blacklist/:kind", scope(adminkey.ScopeRiskWrite), removeBlacklist(rdb, store))
+	admin.GET("/risk/denials", scope(adminkey.ScopeRiskRead), listDenials(db))
+	// Admin：管理密钥（签发、轮换、吊销）
+	admin.GET("/keys", scope(adminkey.ScopeKeysManage), listAdminKeys(db))
+	admin.POST("/keys", scope(adminkey.ScopeKeysManage), createAdminKey(db))
+	admin.POST("/keys/:id/rotate", scope(adminkey.ScopeKeysManage), rotateAdminKey(db))
+	admin.DELETE("/keys/:id", scope(adminkey.ScopeKeysManage), revokeAdminKey(db))
+	// Admin：审计事件查询与 JSON Lines 导出
+	admin.GET("/audit", scope(adminkey.ScopeAuditRead), listAuditEvents(db))
+	admin.GET("/audit/export", scope(adminkey.ScopeAuditRead), exportAuditEvents(db))
+	// stream 链路模式下没有 Broker，消费端死信同样写入 stream 死信流。
+	if brokerDLQ != nil {
+		admin.GET("/dlq/broker", scope(adminkey.ScopeDLQRead), listBrokerDLQ(brokerDLQ))
+		admin.GET("/dlq/broker/:partition/:offset", scope(adminkey.ScopeDLQRead), getBrokerDLQ(brokerDLQ))
+		admin.POST("/dlq/broker/:partition/:offset/redrive", scope(adminkey.ScopeDLQRedrive), redriveBrokerDLQ(brokerDLQ, store))
+	}
 }
 
 // listProducts 查询商品列表。
-func listProducts(db *gorm.DB) gin.HandlerFunc {
+func listProducts(products repository.ProductRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var list []model.Product
-		if err := db.Find(&list).Error; err != nil {
+		list, err := products.List(c.Request.Context())
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 			return
 		}
@@ -107,19 +145,33 @@ func listProducts(db *gorm.DB) gin.HandlerFunc {
 }
 
 // createProduct 创建秒杀商品（含时间窗校验）。
-func createProduct(db *gorm.DB) gin.HandlerFunc {
+// 可选 skus：按规格设置独立库存与价格，此时商品 stock/sale_price 自动汇总为总库存/最低价。
+// 可选 require_registration：只有开售前预约过的用户可以下单。
+// 同一事务内写入 product.create 审计事件（库存变更后为 DB 初始库存）。
+func createProduct(store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			Name      string `json:"name" binding:"required"`
-			Stock     int64  `json:"stock" binding:"required,min=1"`
-			SalePrice int64  `json:"sale_price" binding:"required,min=1"`
-			StartTime string `json:"start_time" binding:"required"`
-			EndTime   string `json:"end_time" binding:"required"`
+			Name                string `json:"name" binding:"required"`
+			Stock               int64  `json:"stock" binding:"omitempty,min=1"`
+			SalePrice           int64  `json:"sale_price" binding:"omitempty,min=1"`
+			PerUserLimit        int    `json:"per_user_limit" binding:"omitempty,min=1"`
+			StartTime           string `json:"start_time" binding:"required"`
+			EndTime             string `json:"end_time" binding:"required"`
+			RequireRegistration bool   `json:"require_registration"`
+			SKUs                []struct {
+				Name      string `json:"name" binding:"required"`
+				Stock     int64  `json:"stock" binding:"required,min=1"`
+				SalePrice int64  `json:"sale_price" binding:"required,min=1"`
+			} `json:"skus" binding:"omitempty,dive"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
 			return
 		}
+		if len(req.SKUs) == 0 && (req.Stock <= 0 || req.SalePrice <= 0) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "未提供 skus 时 stock 与 sale_price 必填"})
+			return
+		}
 		start, err := time.Parse(time.RFC3339, req.StartTime)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "start_time 格式错误，请用 RFC3339"})
@@ -134,14 +186,39 @@ func createProduct(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "end_time 必须晚于 start_time"})
 			return
 		}
+		if req.PerUserLimit <= 0 {
+			req.PerUserLimit = 1
+		}
 		p := &model.Product{
-			Name:      req.Name,
-			Stock:     req.Stock,
-			SalePrice: req.SalePrice,
-			StartTime: start,
-			EndTime:   end,
+			Name:                req.Name,
+			Stock:               req.Stock,
+			SalePrice:           req.SalePrice,
+			PerUserLimit:        req.PerUserLimit,
+			StartTime:           start,
+			EndTime:             end,
+			SaleMode:            model.SaleModeFCFS,
+			RequireRegistration: req.RequireRegistration,
 		}
-		if err := db.Create(p).Error; err != nil {
+		if len(req.SKUs) > 0 {
+			p.Stock, p.SalePrice = 0, 0
+			for _, sk := range req.SKUs {
+				p.SKUs = append(p.SKUs, model.SKU{Name: sk.Name, Stock: sk.Stock, SalePrice: sk.SalePrice})
+				p.Stock += sk.Stock
+				if p.SalePrice == 0 || sk.SalePrice < p.SalePrice {
+					p.SalePrice = sk.SalePrice
+				}
+			}
+		}
+		ctx := c.Request.Context()
+		if err := store.Transaction(ctx, func(tx repository.Store) error {
+			if err := tx.Products().Create(ctx, p); err != nil {
+				return err
+			}
+			e := audit.New(ctx, audit.ActionProductCreate, audit.TargetProduct, strconv.FormatUint(uint64(p.ID), 10))
+			e.ProductID, e.StockAfter = p.ID, &p.Stock
+			e.Detail = map[string]any{"name": p.Name, "sale_price": p.SalePrice, "per_user_limit": p.PerUserLimit, "skus": len(p.SKUs)}
+			return tx.Audit().Append(ctx, &e)
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 			return
 		}
@@ -150,14 +227,13 @@ func createProduct(db *gorm.DB) gin.HandlerFunc {
 }
 
 // preloadStock 将 DB 库存预热到 Redis，供高并发扣减。
-// 该接口要求简单管理员 token，避免被任意调用重置库存。
-func preloadStock(db *gorm.DB, rdb *rd.Client, adminToken string, ttl time.Duration) gin.HandlerFunc {
+// 有 SKU 的商品按 SKU 分别预热，可用 ?sku_id= 只预热单个 SKU。
+// 已纳入活动的商品由活动调度器预热，这里拒绝手动预热，避免覆盖已扣减的库存。
+// 要求预约的商品同时按 DB 回填 Redis 预约集合。
+// 需要 stock:preload 权限的管理密钥，避免被任意调用重置库存。
+// 每个库存单元记录一条 stock.preload 审计事件：覆盖前以 pending 写入目标库存，覆盖后标记 applied 并补上覆盖前的库存。
+func preloadStock(db *gorm.DB, store repository.Store, rdb *rd.Client, ttl time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.GetHeader("X-Admin-Token") != adminToken {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 401, "msg": "admin token 无效"})
-			return
-		}
-
 		// get param from url
 		idStr := c.Param("product_id")
 		id, err := strconv.ParseUint(idStr, 10, 32)
@@ -165,17 +241,66 @@ func preloadStock(db *gorm.DB, rdb *rd.Client, adminToken string, ttl time.Durat
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "商品ID无效"})
 			return
 		}
-		var p model.Product
-		if err := db.First(&p, id).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
+		skuID, ok := parseSKUID(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "sku_id 无效"})
+			return
+		}
+		p, err := store.Products().GetWithSKUs(c.Request.Context(), uint(id))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "商品不存在"})
 				return
 			}
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 			return
 		}
-		key := rediskey.StockKey(uint(id))
-		if err := rdb.Set(c.Request.Context(), key, p.Stock, ttl).Err(); err != nil {
+		if p.CampaignID != nil {
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "商品已纳入活动，库存由活动调度预热"})
+			return
+		}
+
+		var units []rediskey.StockUnit
+		if len(p.SKUs) == 0 {
+			if skuID != 0 {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "SKU 不存在"})
+				return
+			}
+			units = append(units, rediskey.StockUnit{ProductID: p.ID, Stock: p.Stock})
+		}
+		for _, sku := range p.SKUs {
+			if skuID == 0 || sku.ID == skuID {
+				units = append(units, rediskey.StockUnit{ProductID: p.ID, SKUID: sku.ID, Stock: sku.Stock})
+			}
+		}
+		if len(units) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "SKU 不存在"})
+			return
+		}
+
+		// 先以 pending 记下每个库存单元的目标库存，再覆盖 Redis：不会出现没有审计事件的覆盖。
+		ctx := c.Request.Context()
+		events := make([]model.AuditEvent, len(units))
+		for i, u := range units {
+			events[i] = audit.NewStock(ctx, audit.ActionStockPreload, u.ProductID, u.SKUID, nil, &units[i].Stock)
+		}
+		events, ok = prepareAudit(c, store, events...)
+		if !ok {
+			return
+		}
+		before, err := rediskey.OverwriteStock(ctx, rdb, units, ttl)
+		if err != nil {
+			audit.Fail(ctx, store, events, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		for i := range events {
+			events[i].StockBefore = before[i]
+		}
+		if !settleAudit(c, store, events) {
+			return
+		}
+		if err := registration.Sync(c.Request.Context(), db, rdb, p); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 			return
 		}
@@ -183,7 +308,7 @@ func preloadStock(db *gorm.DB, rdb *rd.Client, adminToken string, ttl time.Durat
 	}
 }
 
-// getStock 查询 Redis 中的实时库存。
+// getStock 查询 Redis 中的实时库存，?sku_id= 查询 SKU 级库存。
 func getStock(rdb *rd.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("product_id")
@@ -193,31 +318,68 @@ func getStock(rdb *rd.Client) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "商品ID无效"})
 			return
 		}
-		key := rediskey.StockKey(uint(id))
+		skuID, ok := parseSKUID(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "sku_id 无效"})
+			return
+		}
+		key := rediskey.StockKey(uint(id), skuID)
 		val, err := rdb.Get(c.Request.Context(), key).Int64()
 		if err != nil {
 			if err == rd.Nil {
-				c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"stock": int64(0)}})
+				c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"sku_id": skuID, "stock": int64(0)}})
 				return
 			}
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"stock": val}})
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"sku_id": skuID, "stock": val}})
+	}
+}
+
+// resolveUserID 确定请求的用户身份：开启 JWT 时以令牌中的用户为准，请求中的 user_id 可省略，
+// 与令牌不一致时返回 403；未开启时使用请求中的 user_id。失败时已写入响应。
+func resolveUserID(c *gin.Context, requested int64) (int64, bool) {
+	if userID, ok := middleware.UserID(c); ok {
+		if requested != 0 && requested != userID {
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "user_id 与登录身份不一致"})
+			return 0, false
+		}
+		return userID, true
+	}
+	if requested <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "user_id 必填"})
+		return 0, false
+	}
+	return requested, true
+}
+
+// parseSKUID 解析可选的 ?sku_id=，缺省为 0（商品级库存）。
+func parseSKUID(c *gin.Context) (uint, bool) {
+	s := c.Query("sku_id")
+	if s == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, false
 	}
+	return uint(id), true
 }
 
 // secKill 是秒杀下单入口。
 // 关键流程：
-// 1. 参数校验与活动时间校验
-// 2. Redis Lua 原子接入（幂等 + 一人一单 + 扣库存 + pending 状态 + outbox 入流）
-// 3. API 直接返回 pending，由 Relay 异步转发 Kafka
-func secKill(db *gorm.DB, rdb *rd.Client, requestStateTTL time.Duration, orderEventStream string) gin.HandlerFunc {
+// 1. 参数校验（开启等待室时校验准入凭证）与活动时间校验
+// 2. 开启工作量证明时校验挑战的解，随后风控评估（配置了 evaluator 时），拒绝的请求以 denied 终态落库
+// 3. 库存缓存层原子接入（Redis Lua：黑名单 + 幂等 + 预约校验 + 每人限购 + 扣库存 + pending 状态 + outbox 入流）
+// 4. API 直接返回 pending，由 Relay 异步转发 Broker（stream 模式下由 Consumer 直接消费）
+func secKill(store repository.Store, states repository.RequestStateCache, inventory repository.Inventory, room *waitroom.Room, gate *pow.Gate, powRequired bool, evaluator risk.Evaluator, requestStateTTL time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
 			ProductID uint  `json:"product_id" binding:"required,min=1"`
-			UserID    int64 `json:"user_id" binding:"required,min=1"`
-			Quantity  int   `json:"quantity" binding:"omitempty,min=1,max=1"`
+			SKUID     uint  `json:"sku_id" binding:"omitempty,min=1"`
+			UserID    int64 `json:"user_id" binding:"omitempty,min=1"`
+			Quantity  int   `json:"quantity" binding:"omitempty,min=1"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -225,17 +387,25 @@ func secKill(db *gorm.DB, rdb *rd.Client, requestStateTTL time.Duration, orderEv
 			return
 		}
 
+		var ok bool
+		if req.UserID, ok = resolveUserID(c, req.UserID); !ok {
+			return
+		}
 		if req.Quantity <= 0 {
 			req.Quantity = 1
 		}
-		if req.Quantity != 1 {
-			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "当前示例仅支持每次购买 1 件"})
-			return
+
+		// 等待室开启时必须持有本商品、本用户且未过期的准入凭证，未排队的流量不进入 Lua。
+		if room != nil {
+			if err := room.Verify(c.GetHeader("X-Admission-Token"), req.ProductID, req.UserID); err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "请先排队，凭准入凭证下单"})
+				return
+			}
 		}
 
-		var prod model.Product
-		if err := db.First(&prod, req.ProductID).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
+		prod, err := store.Products().GetWithSKUs(c.Request.Context(), req.ProductID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "商品不存在"})
 				return
 			}
@@ -243,6 +413,39 @@ func secKill(db *gorm.DB, rdb *rd.Client, requestStateTTL time.Duration, orderEv
 			return
 		}
 
+		// 有 SKU 的商品必须指定 sku_id，单价取 SKU 价格；限购仍按商品维度累计。
+		unitPrice := prod.SalePrice
+		if req.SKUID != 0 {
+			found := false
+			for _, sku := range prod.SKUs {
+				if sku.ID == req.SKUID {
+					unitPrice, found = sku.SalePrice, true
+					break
+				}
+			}
+			if !found {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "SKU 不存在"})
+				return
+			}
+		} else if len(prod.SKUs) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "该商品需指定 sku_id"})
+			return
+		}
+
+		perUserLimit := prod.PerUserLimit
+		if perUserLimit <= 0 {
+			perUserLimit = 1
+		}
+		if req.Quantity > perUserLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "超过每人限购数量"})
+			return
+		}
+
+		if prod.SaleMode == model.SaleModeLottery {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "该商品为抽签发售，请报名抽签"})
+			return
+		}
+
 		now := time.Now()
 		if now.Before(prod.StartTime) || now.After(prod.EndTime) {
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "不在秒杀时间段内"})
@@ -255,7 +458,7 @@ func secKill(db *gorm.DB, rdb *rd.Client, requestStateTTL time.Duration, orderEv
 			idemToken = "auto-" + requestID
 		}
 
-		amount := prod.SalePrice * int64(req.Quantity)
+		amount := unitPrice * int64(req.Quantity)
 		statusTTL := requestStateTTL
 		if statusTTL <= 0 {
 			statusTTL = 24 * time.Hour
@@ -265,31 +468,102 @@ func secKill(db *gorm.DB, rdb *rd.Client, requestStateTTL time.Duration, orderEv
 			lockTTL = 24 * time.Hour
 		}
 
-		stockKey := rediskey.StockKey(req.ProductID)
-		userLockKey := rediskey.UserPurchaseLockKey(req.ProductID, req.UserID)
-		requestStateKey := rediskey.RequestStatusKey(requestID)
-		idemKey := rediskey.RequestIdempotencyKey(req.ProductID, req.UserID, idemToken)
+		clientIP := c.ClientIP()
+		deviceID := strings.TrimSpace(c.GetHeader("X-Device-Id"))
+		denied := model.OrderRequest{
+			RequestID: requestID,
+			UserID:    req.UserID,
+			ProductID: req.ProductID,
+			SKUID:     req.SKUID,
+			Quantity:  req.Quantity,
+			Amount:    amount,
+		}
+
+		// 工作量证明：挑战须为本商品、本用户签发，解满足难度且未使用过（校验通过即作废）。
+		// 放在商品、SKU、数量与活动时间等校验之后，参数错误的请求不会白白消耗挑战。
+		// 未强制开启时只校验携带了挑战的请求（风控要求人机校验后的重试）。
+		powPassed := false
+		if gate != nil && (powRequired || c.GetHeader("X-PoW-Challenge") != "") {
+			err := gate.Verify(c.Request.Context(), c.GetHeader("X-PoW-Challenge"), c.GetHeader("X-PoW-Solution"), req.ProductID, req.UserID)
+			switch {
+			case errors.Is(err, pow.ErrInvalidSolution):
+				c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "请先完成人机校验"})
+				return
+			case errors.Is(err, pow.ErrChallengeUsed):
+				c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "人机校验已使用，请重新获取挑战"})
+				return
+			case err != nil:
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+				return
+			}
+			powPassed = true
+		}
+
+		// 风控评估：拒绝的请求以 denied 终态落库；要求人机校验而未带挑战的请求提示领取挑战后重试。
+		// 评估失败时放行，黑名单仍在 Lua 内生效。
+		if evaluator != nil {
+			verdict, err := evaluator.Evaluate(c.Request.Context(), risk.Request{
+				ProductID: req.ProductID,
+				SKUID:     req.SKUID,
+				UserID:    req.UserID,
+				Quantity:  req.Quantity,
+				Amount:    amount,
+				IP:        clientIP,
+				DeviceID:  deviceID,
+				UserAgent: c.Request.UserAgent(),
+			})
+			switch {
+			case err != nil:
+				log.Printf("risk evaluate: %v", err)
+			case verdict.Decision == risk.Deny:
+				denied.ReasonCode = risk.DenyReason(verdict)
+				denied.ErrorMsg = fmt.Sprintf("risk score %g", verdict.Score)
+				denyRequest(c, store.Requests(), denied, "请求存在风险，已被拒绝")
+				return
+			case verdict.Decision == risk.Challenge && !powPassed:
+				c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "请先完成人机校验", "data": gin.H{"decision": risk.Challenge}})
+				return
+			}
+		}
 
-		res, err := rdb.Eval(c.Request.Context(), luaReserveRequest,
-			[]string{stockKey, userLockKey, requestStateKey, idemKey, orderEventStream},
-			req.Quantity, requestID, req.UserID, req.ProductID, amount,
-			int64(statusTTL/time.Second), int64(lockTTL/time.Second), int64(statusTTL/time.Second),
-		).Text()
+		res, err := inventory.Reserve(c.Request.Context(), repository.Reservation{
+			RequestID:           requestID,
+			UserID:              req.UserID,
+			ProductID:           req.ProductID,
+			SKUID:               req.SKUID,
+			Quantity:            req.Quantity,
+			Amount:              amount,
+			PerUserLimit:        perUserLimit,
+			RequireRegistration: prod.RequireRegistration,
+			IdempotencyKey:      idemToken,
+			ClientIP:            clientIP,
+			DeviceID:            deviceID,
+			StateTTL:            statusTTL,
+			QuotaTTL:            lockTTL,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 			return
 		}
 
-		switch {
-		case res == "OUT_OF_STOCK":
+		switch res.Status {
+		case repository.ReserveOK:
+		case repository.ReserveBlacklisted:
+			denied.ReasonCode = risk.BlacklistReason(res.Blacklisted)
+			denyRequest(c, store.Requests(), denied, "账号或设备已被限制下单")
+			return
+		case repository.ReserveOutOfStock:
 			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "库存不足"})
 			return
-		case res == "DUPLICATE":
-			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "该商品已抢购过，限购一件"})
+		case repository.ReserveLimitExceeded:
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "超过每人限购数量"})
 			return
-		case strings.HasPrefix(res, "IDEMPOTENT:"):
-			existReqID := strings.TrimPrefix(res, "IDEMPOTENT:")
-			state, found, err := loadRequestState(c.Request.Context(), db, rdb, existReqID, statusTTL)
+		case repository.ReserveNotRegistered:
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "该商品需开售前预约，未预约不能下单"})
+			return
+		case repository.ReserveIdempotent:
+			existReqID := res.ExistingRequestID
+			state, found, err := loadRequestState(c.Request.Context(), store.Requests(), states, existReqID, statusTTL)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
 				return
@@ -306,14 +580,12 @@ func secKill(db *gorm.DB, rdb *rd.Client, requestStateTTL time.Duration, orderEv
 			}
 			respondWithState(c, state)
 			return
-		}
-
-		if res != "OK" {
+		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "reserve stock failed"})
 			return
 		}
 
-		// 异步建单：事件已写入 Redis Stream，后续由 Relay 转 Kafka。
+		// 异步建单：事件已写入 Redis Stream，后续由 Relay 转 Broker 或由 Consumer 直接消费。
 		c.JSON(http.StatusOK, gin.H{
 			"code": 0,
 			"data": gin.H{
@@ -325,8 +597,9 @@ func secKill(db *gorm.DB, rdb *rd.Client, requestStateTTL time.Duration, orderEv
 	}
 }
 
-// getResult 根据 request_id 查询订单异步处理状态
-func getResult(db *gorm.DB, rdb *rd.Client) gin.HandlerFunc {
+// getResult 查询请求结果；带 wait（如 wait=5s，最长 maxWait）时为长轮询：
+// pending 状态下阻塞到终态事件到达或超时，超时返回的仍是 pending。
+func getResult(hub *notify.ResultHub, requests repository.RequestRepository, states repository.RequestStateCache, maxWait, heartbeat time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		reqID := c.Param("request_id")
 		if reqID == "" {
@@ -334,21 +607,57 @@ func getResult(db *gorm.DB, rdb *rd.Client) gin.HandlerFunc {
 			return
 		}
 
-		state, found, err := loadRequestState(c.Request.Context(), db, rdb, reqID, 24*time.Hour)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+		var wait time.Duration
+		if raw := c.Query("wait"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "wait 格式错误，示例：wait=5s"})
+				return
+			}
+			wait = min(d, maxWait)
+		}
+
+		if wait <= 0 {
+			state, ok := initialResultState(c, requests, states, reqID)
+			if !ok {
+				return
+			}
+			respondWithState(c, state)
 			return
 		}
-		if !found {
-			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "request_id 不存在"})
+
+		// 先订阅再查当前状态，避免两者之间写入的终态事件被漏掉。
+		updates, cancel := hub.Subscribe(reqID)
+		defer cancel()
+
+		state, ok := initialResultState(c, requests, states, reqID)
+		if !ok {
+			return
+		}
+
+		ctx, stop := context.WithTimeout(c.Request.Context(), wait)
+		defer stop()
+
+		// 复用推送的等待逻辑，只保留最后一次状态作为响应。
+		emit := func(st rediskey.RequestState) error {
+			state = st
+			return nil
+		}
+		reload := func(ctx context.Context) (rediskey.RequestState, bool, error) {
+			return loadRequestState(ctx, requests, states, reqID, 24*time.Hour)
+		}
+		_ = watchResult(ctx, state, updates, reload, heartbeat, emit, func() error { return nil })
+		if c.Request.Context().Err() != nil {
+			// 客户端已断开。
 			return
 		}
 		respondWithState(c, state)
 	}
 }
 
-func loadRequestState(ctx context.Context, db *gorm.DB, rdb *rd.Client, requestID string, ttl time.Duration) (rediskey.RequestState, bool, error) {
-	state, found, err := rediskey.GetRequestState(ctx, rdb, requestID)
+// loadRequestState 先查状态缓存，未命中再回查 DB 并回填缓存。
+func loadRequestState(ctx context.Context, requests repository.RequestRepository, states repository.RequestStateCache, requestID string, ttl time.Duration) (rediskey.RequestState, bool, error) {
+	state, found, err := states.Get(ctx, requestID)
 	if err != nil {
 		return rediskey.RequestState{}, false, err
 	}
@@ -356,63 +665,60 @@ func loadRequestState(ctx context.Context, db *gorm.DB, rdb *rd.Client, requestI
 		return state, true, nil
 	}
 
-	var req model.OrderRequest
-	if err := db.Where("request_id = ?", requestID).First(&req).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+	req, err := requests.Get(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			return rediskey.RequestState{}, false, nil
 		}
 		return rediskey.RequestState{}, false, err
 	}
 
-	out := rediskey.RequestState{
-		RequestID: req.RequestID,
-	}
-	switch req.Status {
-	case model.OrderRequestPending:
-		out.Status = rediskey.RequestPending
-	case model.OrderRequestSuccess:
-		out.Status = rediskey.RequestSuccess
-		out.OrderNo = req.OrderNo
-	case model.OrderRequestFailed:
-		out.Status = rediskey.RequestFailed
-		out.Reason = req.ErrorMsg
-	default:
-		out.Status = rediskey.RequestPending
-	}
-
-	_ = rediskey.PutRequestState(ctx, rdb, out.RequestID, out.Status, out.OrderNo, out.Reason, ttl)
+	out := repository.RequestStateOf(req)
+	_ = states.Put(ctx, out, ttl)
 	return out, true, nil
 }
 
 func respondWithState(c *gin.Context, state rediskey.RequestState) {
+	data, ok := resultData(state)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "unknown request status"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": data})
+}
+
+// resultData 将请求状态映射为结果接口的 data（轮询、SSE、WebSocket 共用），未知状态返回 false。
+func resultData(state rediskey.RequestState) (gin.H, bool) {
 	switch state.Status {
 	case rediskey.RequestPending:
-		c.JSON(http.StatusOK, gin.H{
-			"code": 0,
-			"data": gin.H{
-				"status":     "pending",
-				"request_id": state.RequestID,
-			},
-		})
+		return gin.H{
+			"status":     "pending",
+			"request_id": state.RequestID,
+		}, true
 	case rediskey.RequestSuccess:
-		c.JSON(http.StatusOK, gin.H{
-			"code": 0,
-			"data": gin.H{
-				"status":     "created",
-				"order_no":   state.OrderNo,
-				"request_id": state.RequestID,
-			},
-		})
+		return gin.H{
+			"status":     "created",
+			"order_no":   state.OrderNo,
+			"request_id": state.RequestID,
+		}, true
 	case rediskey.RequestFailed:
-		c.JSON(http.StatusOK, gin.H{
-			"code": 0,
-			"data": gin.H{
-				"status":     "failed",
-				"request_id": state.RequestID,
-				"reason":     state.Reason,
-			},
-		})
+		return gin.H{
+			"status":     "failed",
+			"request_id": state.RequestID,
+			"reason":     state.Reason,
+		}, true
+	case rediskey.RequestNotSelected:
+		return gin.H{
+			"status":     "not_selected",
+			"request_id": state.RequestID,
+		}, true
+	case rediskey.RequestDenied:
+		return gin.H{
+			"status":     "denied",
+			"request_id": state.RequestID,
+			"reason":     state.Reason,
+		}, true
 	default:
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "unknown request status"})
+		return nil, false
 	}
 }
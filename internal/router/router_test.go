@@ -0,0 +1,362 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"flash_sale/internal/auth"
+	"flash_sale/internal/middleware"
+	"flash_sale/internal/model"
+	"flash_sale/internal/repository"
+	"flash_sale/internal/risk"
+	rediskey "flash_sale/pkg/redis"
+
+	"github.com/gin-gonic/gin"
+)
+
+type buyFixture struct {
+	store     *repository.MemoryStore
+	states    *repository.MemoryStateCache
+	inventory *repository.MemoryInventory
+	engine    *gin.Engine
+	product   model.Product
+}
+
+// newBuyFixture 以内存仓储、内存状态缓存与内存库存搭建下单与结果查询接口，商品正在售卖、库存 3、每人限购 2。
+func newBuyFixture(t *testing.T, mutate func(p *model.Product)) *buyFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	f := &buyFixture{store: repository.NewMemoryStore(), states: repository.NewMemoryStateCache()}
+	f.inventory = repository.NewMemoryInventory(f.states)
+
+	p := model.Product{
+		Name:         "test",
+		Stock:        3,
+		SalePrice:    100,
+		PerUserLimit: 2,
+		StartTime:    time.Now().Add(-time.Hour),
+		EndTime:      time.Now().Add(time.Hour),
+		SaleMode:     model.SaleModeFCFS,
+	}
+	if mutate != nil {
+		mutate(&p)
+	}
+	if err := f.store.Products().Create(context.Background(), &p); err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	f.product = p
+	f.inventory.SetStock(p.ID, 0, 3)
+
+	f.engine = gin.New()
+	f.engine.POST("/buy", secKill(f.store, f.states, f.inventory, nil, nil, false, nil, time.Hour))
+	f.engine.GET("/result/:request_id", getResult(nil, f.store.Requests(), f.states, 0, time.Second))
+	return f
+}
+
+type apiResponse struct {
+	Code int            `json:"code"`
+	Msg  string         `json:"msg"`
+	Data map[string]any `json:"data"`
+}
+
+func (f *buyFixture) do(t *testing.T, method, path string, body any, header map[string]string) (int, apiResponse) {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	f.engine.ServeHTTP(w, req)
+
+	var resp apiResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func (f *buyFixture) buy(t *testing.T, body gin.H, header map[string]string) (int, apiResponse) {
+	t.Helper()
+	if _, ok := body["product_id"]; !ok {
+		body["product_id"] = f.product.ID
+	}
+	return f.do(t, http.MethodPost, "/buy", body, header)
+}
+
+func TestSecKillReservesStock(t *testing.T) {
+	f := newBuyFixture(t, nil)
+
+	code, resp := f.buy(t, gin.H{"user_id": 10001, "quantity": 2}, nil)
+	if code != http.StatusOK || resp.Data["status"] != "pending" {
+		t.Fatalf("buy: got %d %+v, want 200 pending", code, resp)
+	}
+	requestID, _ := resp.Data["request_id"].(string)
+	if requestID == "" {
+		t.Fatalf("buy: missing request_id")
+	}
+
+	if got := f.inventory.Stock(f.product.ID, 0); got != 1 {
+		t.Fatalf("stock = %d, want 1", got)
+	}
+	if got := f.inventory.Purchased(10001, f.product.ID); got != 2 {
+		t.Fatalf("purchased = %d, want 2", got)
+	}
+	reserved := f.inventory.Reserved()
+	if len(reserved) != 1 {
+		t.Fatalf("outbox has %d entries, want 1", len(reserved))
+	}
+	if r := reserved[0]; r.RequestID != requestID || r.Quantity != 2 || r.Amount != 200 || r.PerUserLimit != 2 {
+		t.Fatalf("outbox entry = %+v", r)
+	}
+
+	code, resp = f.do(t, http.MethodGet, "/result/"+requestID, nil, nil)
+	if code != http.StatusOK || resp.Data["status"] != "pending" {
+		t.Fatalf("result: got %d %+v, want 200 pending", code, resp)
+	}
+}
+
+func TestSecKillRejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		mutate   func(p *model.Product)
+		prepare  func(f *buyFixture)
+		body     gin.H
+		header   map[string]string
+		wantCode int
+		wantMsg  string
+	}{
+		{
+			name:     "missing user",
+			body:     gin.H{},
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "user_id 必填",
+		},
+		{
+			name:     "product not found",
+			body:     gin.H{"product_id": 999, "user_id": 10001},
+			wantCode: http.StatusNotFound,
+			wantMsg:  "商品不存在",
+		},
+		{
+			name:     "quantity above limit",
+			body:     gin.H{"user_id": 10001, "quantity": 3},
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "超过每人限购数量",
+		},
+		{
+			name:     "lottery product",
+			mutate:   func(p *model.Product) { p.SaleMode = model.SaleModeLottery },
+			body:     gin.H{"user_id": 10001},
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "该商品为抽签发售，请报名抽签",
+		},
+		{
+			name:     "sale not started",
+			mutate:   func(p *model.Product) { p.StartTime = time.Now().Add(time.Hour) },
+			body:     gin.H{"user_id": 10001},
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "不在秒杀时间段内",
+		},
+		{
+			name:     "out of stock",
+			prepare:  func(f *buyFixture) { f.inventory.SetStock(f.product.ID, 0, 1) },
+			body:     gin.H{"user_id": 10001, "quantity": 2},
+			wantCode: http.StatusBadRequest,
+			wantMsg:  "库存不足",
+		},
+		{
+			name:     "not registered",
+			mutate:   func(p *model.Product) { p.RequireRegistration = true },
+			body:     gin.H{"user_id": 10001},
+			wantCode: http.StatusForbidden,
+			wantMsg:  "该商品需开售前预约，未预约不能下单",
+		},
+		{
+			name:     "blacklisted device",
+			prepare:  func(f *buyFixture) { f.inventory.Blacklist(risk.KindDevice, "dev-1") },
+			body:     gin.H{"user_id": 10001},
+			header:   map[string]string{"X-Device-Id": "dev-1"},
+			wantCode: http.StatusForbidden,
+			wantMsg:  "账号或设备已被限制下单",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBuyFixture(t, tt.mutate)
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+			before := f.inventory.Stock(f.product.ID, 0)
+
+			code, resp := f.buy(t, tt.body, tt.header)
+			if code != tt.wantCode || resp.Msg != tt.wantMsg {
+				t.Fatalf("got %d %q, want %d %q", code, resp.Msg, tt.wantCode, tt.wantMsg)
+			}
+			if got := f.inventory.Stock(f.product.ID, 0); got != before {
+				t.Fatalf("stock changed from %d to %d", before, got)
+			}
+			if n := len(f.inventory.Reserved()); n != 0 {
+				t.Fatalf("outbox has %d entries, want 0", n)
+			}
+		})
+	}
+}
+
+func TestSecKillUserFromJWT(t *testing.T) {
+	const secret = "test-secret"
+	v, err := auth.NewVerifier([]string{secret}, "", "", "", 0)
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	token, err := auth.SignHS256(secret, 10001, "", "", time.Minute)
+	if err != nil {
+		t.Fatalf("SignHS256: %v", err)
+	}
+	f := newBuyFixture(t, nil)
+	f.engine.POST("/jwt/buy", middleware.RequireJWT(v), secKill(f.store, f.states, f.inventory, nil, nil, false, nil, time.Hour))
+	bearer := map[string]string{"Authorization": "Bearer " + token}
+
+	tests := []struct {
+		name     string
+		body     gin.H
+		header   map[string]string
+		wantCode int
+	}{
+		{"no token", gin.H{"product_id": f.product.ID, "user_id": 10001}, nil, http.StatusUnauthorized},
+		{"body user mismatch", gin.H{"product_id": f.product.ID, "user_id": 10002}, bearer, http.StatusForbidden},
+		{"body user omitted", gin.H{"product_id": f.product.ID}, bearer, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := f.do(t, http.MethodPost, "/jwt/buy", tt.body, tt.header)
+			if code != tt.wantCode {
+				t.Fatalf("got %d %+v, want %d", code, resp, tt.wantCode)
+			}
+		})
+	}
+
+	reserved := f.inventory.Reserved()
+	if len(reserved) != 1 || reserved[0].UserID != 10001 {
+		t.Fatalf("outbox = %+v, want one entry for user 10001", reserved)
+	}
+}
+
+func TestSecKillRegisteredUser(t *testing.T) {
+	f := newBuyFixture(t, func(p *model.Product) { p.RequireRegistration = true })
+	f.inventory.Register(f.product.ID, 10001)
+
+	if code, resp := f.buy(t, gin.H{"user_id": 10001}, nil); code != http.StatusOK {
+		t.Fatalf("buy: got %d %+v, want 200", code, resp)
+	}
+}
+
+func TestSecKillPerUserLimitAcrossRequests(t *testing.T) {
+	f := newBuyFixture(t, nil)
+
+	if code, resp := f.buy(t, gin.H{"user_id": 10001}, nil); code != http.StatusOK {
+		t.Fatalf("first buy: got %d %+v", code, resp)
+	}
+	if code, resp := f.buy(t, gin.H{"user_id": 10001}, nil); code != http.StatusOK {
+		t.Fatalf("second buy: got %d %+v", code, resp)
+	}
+	code, resp := f.buy(t, gin.H{"user_id": 10001}, nil)
+	if code != http.StatusBadRequest || resp.Msg != "超过每人限购数量" {
+		t.Fatalf("third buy: got %d %+v, want limit exceeded", code, resp)
+	}
+	if got := f.inventory.Stock(f.product.ID, 0); got != 1 {
+		t.Fatalf("stock = %d, want 1", got)
+	}
+}
+
+func TestSecKillIdempotencyKey(t *testing.T) {
+	f := newBuyFixture(t, nil)
+	header := map[string]string{"X-Idempotency-Key": "k1"}
+
+	_, first := f.buy(t, gin.H{"user_id": 10001}, header)
+	code, second := f.buy(t, gin.H{"user_id": 10001}, header)
+	if code != http.StatusOK || second.Data["request_id"] != first.Data["request_id"] {
+		t.Fatalf("replay: got %d %+v, want request_id %v", code, second, first.Data["request_id"])
+	}
+	if got := f.inventory.Stock(f.product.ID, 0); got != 2 {
+		t.Fatalf("stock = %d, want 2", got)
+	}
+}
+
+func TestSecKillBlacklistRecordsDenied(t *testing.T) {
+	f := newBuyFixture(t, nil)
+	f.inventory.Blacklist(risk.KindUser, "10001")
+
+	code, resp := f.buy(t, gin.H{"user_id": 10001}, nil)
+	if code != http.StatusForbidden || resp.Data["reason"] != risk.BlacklistReason(risk.KindUser) {
+		t.Fatalf("buy: got %d %+v, want 403 blacklist_user", code, resp)
+	}
+	requestID, _ := resp.Data["request_id"].(string)
+
+	code, resp = f.do(t, http.MethodGet, "/result/"+requestID, nil, nil)
+	if code != http.StatusOK || resp.Data["status"] != "denied" {
+		t.Fatalf("result: got %d %+v, want denied", code, resp)
+	}
+}
+
+func TestGetResult(t *testing.T) {
+	f := newBuyFixture(t, nil)
+	ctx := context.Background()
+
+	req := model.OrderRequest{RequestID: "req-db", UserID: 10001, ProductID: f.product.ID, Quantity: 1, Amount: 100}
+	if err := f.store.Requests().UpsertPending(ctx, req); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if err := f.store.Requests().MarkSuccess(ctx, "req-db", "SKreqdb"); err != nil {
+		t.Fatalf("mark success: %v", err)
+	}
+	if err := f.states.Put(ctx, rediskey.RequestState{RequestID: "req-cached", Status: rediskey.RequestFailed, Reason: "purchase_limit_exceeded"}, time.Hour); err != nil {
+		t.Fatalf("put state: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantCode  int
+		want      map[string]any
+	}{
+		{"cache hit", "req-cached", http.StatusOK, map[string]any{"status": "failed", "reason": "purchase_limit_exceeded"}},
+		{"db fallback", "req-db", http.StatusOK, map[string]any{"status": "created", "order_no": "SKreqdb"}},
+		{"unknown", "req-missing", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := f.do(t, http.MethodGet, "/result/"+tt.requestID, nil, nil)
+			if code != tt.wantCode {
+				t.Fatalf("got %d %+v, want %d", code, resp, tt.wantCode)
+			}
+			for k, v := range tt.want {
+				if resp.Data[k] != v {
+					t.Fatalf("data[%s] = %v, want %v", k, resp.Data[k], v)
+				}
+			}
+		})
+	}
+
+	// DB 回查后回填缓存。
+	if st, found, _ := f.states.Get(ctx, "req-db"); !found || st.Status != rediskey.RequestSuccess || st.OrderNo != "SKreqdb" {
+		t.Fatalf("cache not backfilled: %+v found=%v", st, found)
+	}
+
+	code, resp := f.do(t, http.MethodGet, "/result/req-db?wait=bad", nil, nil)
+	if code != http.StatusBadRequest {
+		t.Fatalf("invalid wait: got %d %+v, want 400", code, resp)
+	}
+}
@@ -0,0 +1,169 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/repository"
+	"flash_sale/internal/waitroom"
+
+	"github.com/gin-gonic/gin"
+)
+
+// joinWaitingRoom 加入商品等待室，返回排队位置；已放行则直接返回准入凭证。
+// 秒杀开始前即可排队，开始后按放行速率依次放行。
+func joinWaitingRoom(room *waitroom.Room, products repository.ProductRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := parseProductID(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			UserID int64 `json:"user_id" binding:"omitempty,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+			return
+		}
+		if req.UserID, ok = resolveUserID(c, req.UserID); !ok {
+			return
+		}
+
+		prod, err := products.Get(c.Request.Context(), productID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "商品不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		if time.Now().After(prod.EndTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "秒杀已结束"})
+			return
+		}
+
+		ticket, err := room.Join(c.Request.Context(), productID, req.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": ticket})
+	}
+}
+
+// getWaitingRoomPosition 查询排队位置（轮询）。
+func getWaitingRoomPosition(room *waitroom.Room) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, userID, ok := parseProductUserQuery(c)
+		if !ok {
+			return
+		}
+		ticket, err := room.Position(c.Request.Context(), productID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": ticket})
+	}
+}
+
+// streamWaitingRoomPosition 以 SSE 推送排队位置，每个放行周期一次，放行（或不在队列中）后推送并断开。
+func streamWaitingRoomPosition(room *waitroom.Room, interval, timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, userID, ok := parseProductUserQuery(c)
+		if !ok {
+			return
+		}
+		ticket, err := room.Position(c.Request.Context(), productID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		ctx, stop := context.WithTimeout(c.Request.Context(), timeout)
+		defer stop()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last waitroom.Ticket
+		for {
+			// 位置未变化时不重复推送。
+			if ticket != last {
+				payload, err := json.Marshal(gin.H{"code": 0, "data": ticket})
+				if err != nil {
+					return
+				}
+				if _, err := fmt.Fprintf(c.Writer, "event: position\ndata: %s\n\n", payload); err != nil {
+					return
+				}
+				c.Writer.Flush()
+				last = ticket
+			}
+			if ticket.Status != waitroom.StatusWaiting {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			next, err := room.Position(ctx, productID, userID)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("waiting room stream product=%d user=%d: %v", productID, userID, err)
+				}
+				continue
+			}
+			ticket = next
+		}
+	}
+}
+
+func parseProductID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("product_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "商品ID无效"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func parseProductUserQuery(c *gin.Context) (uint, int64, bool) {
+	productID, ok := parseProductID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	userID, ok := parseUserQuery(c)
+	if !ok {
+		return 0, 0, false
+	}
+	return productID, userID, true
+}
+
+// parseUserQuery 解析可选的 ?user_id= 并按 resolveUserID 确定用户身份，失败时已写入响应。
+func parseUserQuery(c *gin.Context) (int64, bool) {
+	var requested int64
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "用户ID无效"})
+			return 0, false
+		}
+		requested = id
+	}
+	return resolveUserID(c, requested)
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	pgUniqueViolation   = "23505"
+	mysqlDuplicateEntry = 1062
+
+	// PostgreSQL 可重试的 SQLSTATE：08 类为连接异常，57P0x 为服务端关闭 / 暂不可连接。
+	pgConnectionExceptionClass = "08"
+	pgSerializationFailure     = "40001"
+	pgDeadlockDetected         = "40P01"
+	pgTooManyConnections       = "53300"
+	pgAdminShutdown            = "57P01"
+	pgCrashShutdown            = "57P02"
+	pgCannotConnectNow         = "57P03"
+
+	mysqlTooManyConnections = 1040
+	mysqlServerShutdown     = 1053
+	mysqlLockWaitTimeout    = 1205
+	mysqlDeadlock           = 1213
+)
+
+// IsUniqueViolation 按驱动错误码判断唯一约束冲突，不依赖报错文本：
+// SQLite 扩展码 UNIQUE / PRIMARY KEY，PostgreSQL SQLSTATE 23505，MySQL 1062。
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolation
+	}
+	var myErr *mysqldriver.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == mysqlDuplicateEntry
+	}
+	return false
+}
+
+// IsTransient 判断错误是否为暂时性故障（连接断开 / 超时、数据库忙或锁冲突、死锁、服务重启），
+// 同一操作稍后重试即可成功。网络错误与 io.EOF 同样覆盖 Redis 连接故障。
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, mysqldriver.ErrInvalidConn) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy ||
+			sqliteErr.Code == sqlite3.ErrLocked ||
+			sqliteErr.Code == sqlite3.ErrIoErr
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.Timeout(err) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgSerializationFailure, pgDeadlockDetected, pgTooManyConnections,
+			pgAdminShutdown, pgCrashShutdown, pgCannotConnectNow:
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, pgConnectionExceptionClass)
+	}
+	var myErr *mysqldriver.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case mysqlTooManyConnections, mysqlServerShutdown, mysqlLockWaitTimeout, mysqlDeadlock:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"flash_sale/internal/storage"
+	"flash_sale/internal/storage/storagetest"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+type uniqueRow struct {
+	ID   uint   `gorm:"primarykey"`
+	Code string `gorm:"size:32;not null;uniqueIndex"`
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	for _, driver := range storagetest.Drivers {
+		t.Run(driver, func(t *testing.T) {
+			db := storagetest.Open(t, driver, "")
+			if err := db.AutoMigrate(&uniqueRow{}); err != nil {
+				t.Fatalf("migrate: %v", err)
+			}
+			if err := db.Create(&uniqueRow{Code: "a"}).Error; err != nil {
+				t.Fatalf("first insert: %v", err)
+			}
+
+			err := db.Create(&uniqueRow{Code: "a"}).Error
+			if !storage.IsUniqueViolation(err) {
+				t.Fatalf("duplicate unique index: got %v, want unique violation", err)
+			}
+			if !storage.IsUniqueViolation(fmt.Errorf("wrapped: %w", err)) {
+				t.Fatalf("wrapped duplicate not detected")
+			}
+
+			err = db.Create(&uniqueRow{ID: 1, Code: "b"}).Error
+			if !storage.IsUniqueViolation(err) {
+				t.Fatalf("duplicate primary key: got %v, want unique violation", err)
+			}
+
+			err = db.Exec("INSERT INTO unique_rows (code) VALUES (NULL)").Error
+			if err == nil {
+				t.Fatalf("not null insert succeeded")
+			}
+			if storage.IsUniqueViolation(err) {
+				t.Fatalf("not null violation reported as unique violation: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolationDriverErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("UNIQUE constraint failed"), false},
+		{"sqlite unique", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, true},
+		{"sqlite primary key", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, true},
+		{"sqlite not null", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintNotNull}, false},
+		{"postgres unique", &pgconn.PgError{Code: "23505"}, true},
+		{"postgres foreign key", &pgconn.PgError{Code: "23503"}, false},
+		{"mysql duplicate", &mysqldriver.MySQLError{Number: 1062}, true},
+		{"mysql other", &mysqldriver.MySQLError{Number: 1452}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storage.IsUniqueViolation(tt.err); got != tt.want {
+				t.Fatalf("IsUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("boom"), false},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{"canceled", context.Canceled, false},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy}, true},
+		{"sqlite constraint", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, false},
+		{"postgres serialization", &pgconn.PgError{Code: "40001"}, true},
+		{"postgres deadlock", &pgconn.PgError{Code: "40P01"}, true},
+		{"postgres connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"postgres admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"postgres unique", &pgconn.PgError{Code: "23505"}, false},
+		{"postgres connect", &pgconn.ConnectError{}, true},
+		{"mysql deadlock", &mysqldriver.MySQLError{Number: 1213}, true},
+		{"mysql lock wait", &mysqldriver.MySQLError{Number: 1205}, true},
+		{"mysql duplicate", &mysqldriver.MySQLError{Number: 1062}, false},
+		{"mysql invalid conn", mysqldriver.ErrInvalidConn, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storage.IsTransient(tt.err); got != tt.want {
+				t.Fatalf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
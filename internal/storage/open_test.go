@@ -0,0 +1,56 @@
+package storage_test
+
+import (
+	"strings"
+	"testing"
+
+	"flash_sale/internal/config"
+	"flash_sale/internal/storage/storagetest"
+)
+
+// TestOpenIsolationLevel 验证 DB_ISOLATION_LEVEL 作为连接级默认值下发，连接池中的每个连接都生效。
+func TestOpenIsolationLevel(t *testing.T) {
+	tests := []struct {
+		driver string
+		query  string
+	}{
+		{config.DBDriverPostgres, "SHOW default_transaction_isolation"},
+		{config.DBDriverMySQL, "SELECT @@transaction_isolation"},
+	}
+	levels := map[string]string{
+		config.IsolationReadCommitted:  "read committed",
+		config.IsolationRepeatableRead: "repeatable read",
+		config.IsolationSerializable:   "serializable",
+	}
+	for _, tt := range tests {
+		for level, want := range levels {
+			t.Run(tt.driver+"/"+level, func(t *testing.T) {
+				db := storagetest.Open(t, tt.driver, level)
+				sqlDB, err := db.DB()
+				if err != nil {
+					t.Fatal(err)
+				}
+				sqlDB.SetMaxOpenConns(2)
+				for i := 0; i < 2; i++ {
+					var got string
+					if err := db.Raw(tt.query).Scan(&got).Error; err != nil {
+						t.Fatalf("query isolation: %v", err)
+					}
+					got = strings.ToLower(strings.ReplaceAll(got, "-", " "))
+					if got != want {
+						t.Fatalf("isolation = %q, want %q", got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestOpenSQLite 验证 SQLite 使用 DSN 作为文件路径打开，可直接读写。
+func TestOpenSQLite(t *testing.T) {
+	db := storagetest.Open(t, config.DBDriverSQLite, "")
+	var one int
+	if err := db.Raw("SELECT 1").Scan(&one).Error; err != nil || one != 1 {
+		t.Fatalf("SELECT 1 = %d, %v", one, err)
+	}
+}
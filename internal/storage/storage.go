@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"flash_sale/internal/config"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Open 按 DB_DRIVER 打开数据库连接。
+// postgres / mysql 下 DB_ISOLATION_LEVEL 作为连接级默认隔离级别下发，
+// 对所有事务（建单、限购累计、订单状态流转）统一生效，无需在调用处逐个传 TxOptions。
+func Open(cfg config.AppConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.DBDriver {
+	case config.DBDriverPostgres:
+		pgCfg, err := pgx.ParseConfig(cfg.DBDSN)
+		if err != nil {
+			return nil, fmt.Errorf("parse postgres dsn: %w", err)
+		}
+		if cfg.DBIsolation != "" {
+			pgCfg.RuntimeParams["default_transaction_isolation"] = postgresIsolation(cfg.DBIsolation)
+		}
+		dialector = postgres.New(postgres.Config{Conn: stdlib.OpenDB(*pgCfg)})
+	case config.DBDriverMySQL:
+		myCfg, err := mysqldriver.ParseDSN(cfg.DBDSN)
+		if err != nil {
+			return nil, fmt.Errorf("parse mysql dsn: %w", err)
+		}
+		// 模型包含 time.Time 字段，必须由驱动解析 DATETIME。
+		myCfg.ParseTime = true
+		if cfg.DBIsolation != "" {
+			if myCfg.Params == nil {
+				myCfg.Params = map[string]string{}
+			}
+			myCfg.Params["transaction_isolation"] = "'" + mysqlIsolation(cfg.DBIsolation) + "'"
+		}
+		dialector = mysql.Open(myCfg.FormatDSN())
+	default:
+		dialector = sqlite.Open(cfg.DBDSN)
+	}
+	return gorm.Open(dialector, &gorm.Config{})
+}
+
+// postgresIsolation 把 DB_ISOLATION_LEVEL 转为 PostgreSQL 的取值：read_committed -> "read committed"。
+func postgresIsolation(level string) string {
+	return strings.ReplaceAll(level, "_", " ")
+}
+
+// mysqlIsolation 把 DB_ISOLATION_LEVEL 转为 MySQL 的取值：read_committed -> "READ-COMMITTED"。
+func mysqlIsolation(level string) string {
+	return strings.ToUpper(strings.ReplaceAll(level, "_", "-"))
+}
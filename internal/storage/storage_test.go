@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"testing"
+
+	"flash_sale/internal/config"
+)
+
+func TestIsolationValues(t *testing.T) {
+	tests := []struct {
+		level    string
+		postgres string
+		mysql    string
+	}{
+		{config.IsolationReadCommitted, "read committed", "READ-COMMITTED"},
+		{config.IsolationRepeatableRead, "repeatable read", "REPEATABLE-READ"},
+		{config.IsolationSerializable, "serializable", "SERIALIZABLE"},
+	}
+	for _, tt := range tests {
+		if got := postgresIsolation(tt.level); got != tt.postgres {
+			t.Errorf("postgresIsolation(%q) = %q, want %q", tt.level, got, tt.postgres)
+		}
+		if got := mysqlIsolation(tt.level); got != tt.mysql {
+			t.Errorf("mysqlIsolation(%q) = %q, want %q", tt.level, got, tt.mysql)
+		}
+	}
+}
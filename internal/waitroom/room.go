@@ -0,0 +1,282 @@
+package waitroom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"flash_sale/internal/repository"
+	rediskey "flash_sale/pkg/redis"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// 排队状态。
+const (
+	StatusWaiting   = "waiting"
+	StatusAdmitted  = "admitted"
+	StatusNotQueued = "not_queued"
+)
+
+// luaTicket 原子查询（ARGV[4]=1 时顺带入队）用户在等待室中的状态：
+// 已放行且未过期返回 {1, 过期毫秒时间戳}；在队列中返回 {0, 排名(从 0 开始)}；都不在返回 {-1, 0}。
+// 放行已过期的用户重新入队时排到队尾。
+const luaTicket = `
+local queueKey = KEYS[1]
+local admittedKey = KEYS[2]
+local roomsKey = KEYS[3]
+
+local userID = ARGV[1]
+local productID = ARGV[2]
+local nowMs = tonumber(ARGV[3])
+local join = ARGV[4] == '1'
+
+local exp = redis.call('ZSCORE', admittedKey, userID)
+if exp then
+  if tonumber(exp) > nowMs then
+    return {1, exp}
+  end
+  if join then
+    redis.call('ZREM', admittedKey, userID)
+  end
+end
+
+if join then
+  redis.call('ZADD', queueKey, 'NX', nowMs, userID)
+  redis.call('SADD', roomsKey, productID)
+end
+local rank = redis.call('ZRANK', queueKey, userID)
+if rank then
+  return {0, rank}
+end
+return {-1, 0}
+`
+
+// luaAdmit 以共享的放行游标计算本轮可放行人数（多实例合计不超过速率）：
+// 游标每放行一人前进 1000/rate 毫秒，不足一人的时间留到下一轮；空闲后最多补发两轮的量。
+// 从队首弹出并登记到已放行集合；队列清空后将商品移出等待室集合。返回放行人数。
+const luaAdmit = `
+local queueKey = KEYS[1]
+local admittedKey = KEYS[2]
+local lastKey = KEYS[3]
+local roomsKey = KEYS[4]
+
+local productID = ARGV[1]
+local nowMs = tonumber(ARGV[2])
+local rate = tonumber(ARGV[3])
+local maxBatch = tonumber(ARGV[4])
+local expireAt = tonumber(ARGV[5])
+local admittedTTLMs = tonumber(ARGV[6])
+
+redis.call('ZREMRANGEBYSCORE', admittedKey, '-inf', nowMs)
+
+local step = 1000 / rate
+local window = 2 * maxBatch * step
+local last = tonumber(redis.call('GET', lastKey) or '0')
+if nowMs - last > window then
+  last = nowMs - window
+end
+local n = math.floor((nowMs - last) / step)
+if n <= 0 then
+  return 0
+end
+redis.call('SET', lastKey, last + n * step, 'PX', 3600000)
+
+local popped = redis.call('ZPOPMIN', queueKey, n)
+local admitted = 0
+for i = 1, #popped, 2 do
+  redis.call('ZADD', admittedKey, expireAt, popped[i])
+  admitted = admitted + 1
+end
+if admitted > 0 then
+  redis.call('PEXPIRE', admittedKey, admittedTTLMs)
+end
+if redis.call('ZCARD', queueKey) == 0 then
+  redis.call('SREM', roomsKey, productID)
+end
+return admitted
+`
+
+// Ticket 为用户在等待室中的状态。
+type Ticket struct {
+	Status string `json:"status"`
+	// Position 为排队位置（从 1 开始），仅 waiting 时有值。
+	Position int64 `json:"position,omitempty"`
+	// EstimatedWaitSec 按放行速率估算的剩余等待秒数。
+	EstimatedWaitSec int64 `json:"eta_sec,omitempty"`
+	// Token 为准入凭证，仅 admitted 时有值；下单时通过 X-Admission-Token 携带。
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Room 为按商品划分的虚拟等待室：用户按到达顺序排队（Redis ZSET），
+// 放行任务按固定速率从队首放行并签发限时准入凭证。
+type Room struct {
+	rdb      *rd.Client
+	products repository.ProductRepository
+	secret   []byte
+
+	rate     int
+	interval time.Duration
+	tokenTTL time.Duration
+}
+
+func NewRoom(rdb *rd.Client, products repository.ProductRepository, secret string, rate int, interval, tokenTTL time.Duration) *Room {
+	return &Room{
+		rdb:      rdb,
+		products: products,
+		secret:   []byte(secret),
+		rate:     rate,
+		interval: interval,
+		tokenTTL: tokenTTL,
+	}
+}
+
+// Join 将用户加入商品等待室（重复加入保持原位置），已放行的用户直接返回凭证。
+func (r *Room) Join(ctx context.Context, productID uint, userID int64) (Ticket, error) {
+	return r.ticket(ctx, productID, userID, true)
+}
+
+// Position 查询用户当前的排队状态，不会入队。
+func (r *Room) Position(ctx context.Context, productID uint, userID int64) (Ticket, error) {
+	return r.ticket(ctx, productID, userID, false)
+}
+
+// Verify 校验下单携带的准入凭证。
+func (r *Room) Verify(token string, productID uint, userID int64) error {
+	return verifyToken(r.secret, token, productID, userID, time.Now())
+}
+
+func (r *Room) ticket(ctx context.Context, productID uint, userID int64, join bool) (Ticket, error) {
+	joinFlag := "0"
+	if join {
+		joinFlag = "1"
+	}
+	res, err := r.rdb.Eval(ctx, luaTicket,
+		[]string{rediskey.WaitingRoomQueueKey(productID), rediskey.WaitingRoomAdmittedKey(productID), rediskey.WaitingRoomsKey()},
+		userID, productID, time.Now().UnixMilli(), joinFlag,
+	).Slice()
+	if err != nil {
+		return Ticket{}, err
+	}
+	if len(res) != 2 {
+		return Ticket{}, fmt.Errorf("unexpected waiting room reply: %v", res)
+	}
+
+	state, _ := res[0].(int64)
+	switch state {
+	case 1:
+		exp, err := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+		if err != nil {
+			return Ticket{}, fmt.Errorf("invalid admission expiry %v: %w", res[1], err)
+		}
+		expiresAt := time.UnixMilli(int64(exp))
+		return Ticket{
+			Status:    StatusAdmitted,
+			Token:     signToken(r.secret, productID, userID, expiresAt),
+			ExpiresAt: &expiresAt,
+		}, nil
+	case 0:
+		rank, _ := res[1].(int64)
+		position := rank + 1
+		return Ticket{
+			Status:           StatusWaiting,
+			Position:         position,
+			EstimatedWaitSec: int64(math.Ceil(float64(position) / float64(r.rate))),
+		}, nil
+	default:
+		return Ticket{Status: StatusNotQueued}, nil
+	}
+}
+
+// Run 周期性放行各商品等待室的队首用户，直到 ctx 取消。
+// 未开始的商品只排队不放行；已结束或已删除的商品清理等待室。
+func (r *Room) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.admitAll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("waiting room: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Room) admitAll(ctx context.Context) error {
+	members, err := r.rdb.SMembers(ctx, rediskey.WaitingRoomsKey()).Result()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, m := range members {
+		pid, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			r.rdb.SRem(ctx, rediskey.WaitingRoomsKey(), m)
+			continue
+		}
+		productID := uint(pid)
+
+		prod, err := r.products.Get(ctx, productID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if errors.Is(err, repository.ErrNotFound) || now.After(prod.EndTime) {
+			if err := r.close(ctx, productID); err != nil {
+				return err
+			}
+			continue
+		}
+		if now.Before(prod.StartTime) {
+			continue
+		}
+
+		n, err := r.admit(ctx, productID, now)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("waiting room: product=%d admitted=%d", productID, n)
+		}
+	}
+	return nil
+}
+
+func (r *Room) admit(ctx context.Context, productID uint, now time.Time) (int64, error) {
+	maxBatch := int64(math.Ceil(float64(r.rate) * r.interval.Seconds()))
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	return r.rdb.Eval(ctx, luaAdmit,
+		[]string{
+			rediskey.WaitingRoomQueueKey(productID),
+			rediskey.WaitingRoomAdmittedKey(productID),
+			rediskey.WaitingRoomLastAdmitKey(productID),
+			rediskey.WaitingRoomsKey(),
+		},
+		productID, now.UnixMilli(), r.rate, maxBatch, now.Add(r.tokenTTL).UnixMilli(), r.tokenTTL.Milliseconds(),
+	).Int64()
+}
+
+// close 清理商品的等待室（排队队列、放行记录与速率状态）。
+func (r *Room) close(ctx context.Context, productID uint) error {
+	pipe := r.rdb.TxPipeline()
+	pipe.Del(ctx,
+		rediskey.WaitingRoomQueueKey(productID),
+		rediskey.WaitingRoomAdmittedKey(productID),
+		rediskey.WaitingRoomLastAdmitKey(productID),
+	)
+	pipe.SRem(ctx, rediskey.WaitingRoomsKey(), productID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,54 @@
+package waitroom
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken 表示准入凭证缺失、格式错误、签名不符、已过期或与下单的商品 / 用户不匹配。
+var ErrInvalidToken = errors.New("invalid admission token")
+
+// 凭证格式：<product_id>.<user_id>.<过期毫秒时间戳>.<HMAC-SHA256 签名（base64url）>。
+// 无状态校验，下单路径不需要访问 Redis。
+func signToken(secret []byte, productID uint, userID int64, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d.%d.%d", productID, userID, expiresAt.UnixMilli())
+	return payload + "." + tokenSignature(secret, payload)
+}
+
+func tokenSignature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifyToken(secret []byte, token string, productID uint, userID int64, now time.Time) error {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return ErrInvalidToken
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(tokenSignature(secret, payload))) {
+		return ErrInvalidToken
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+	pid, err1 := strconv.ParseUint(parts[0], 10, 64)
+	uid, err2 := strconv.ParseInt(parts[1], 10, 64)
+	exp, err3 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return ErrInvalidToken
+	}
+	if uint(pid) != productID || uid != userID || now.UnixMilli() >= exp {
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -2,9 +2,12 @@ package redis
 
 import "fmt"
 
-// StockKey 统一约定商品库存键名。
-func StockKey(productID uint) string {
-	return fmt.Sprintf("flash_sale:stock:%d", productID)
+// StockKey 统一约定库存键名：skuID 为 0 表示商品级库存（无 SKU 的商品），否则为 SKU 级库存。
+func StockKey(productID, skuID uint) string {
+	if skuID == 0 {
+		return fmt.Sprintf("flash_sale:stock:%d", productID)
+	}
+	return fmt.Sprintf("flash_sale:stock:%d:sku:%d", productID, skuID)
 }
 
 // CompensationLockKey 标记某个 request_id 是否已做过库存回补。
@@ -17,12 +20,98 @@ func RequestStatusKey(requestID string) string {
 	return fmt.Sprintf("flash_sale:request:status:%s", requestID)
 }
 
-// UserPurchaseLockKey 标记某用户在某商品上的“已占位/已下单”状态。
-func UserPurchaseLockKey(productID uint, userID int64) string {
-	return fmt.Sprintf("flash_sale:purchase:lock:%d:%d", productID, userID)
+// PendingRequestsKey 是 pending 请求的时间索引（ZSET，score 为入队毫秒时间戳），供滞留请求清扫使用。
+func PendingRequestsKey() string {
+	return "flash_sale:request:pending"
+}
+
+// RelayedRequestsKey 是已交给 Relay 发布到 Broker 的 pending 请求集合（SET）：发布前登记，进入终态时移除。
+// 这些请求已离开 outbox，可能仍在 Broker 中等待消费或停在 Broker 死信 topic，清扫任务不判定为丢失。
+func RelayedRequestsKey() string {
+	return "flash_sale:request:relayed"
+}
+
+// DeadLetteredRequestsKey 是停在 Redis 死信流中等待人工重投的请求集合（SET），重投或进入终态时移除。
+func DeadLetteredRequestsKey() string {
+	return "flash_sale:request:dead_lettered"
+}
+
+// RequestEventsChannel 是请求进入终态时的 pub/sub 频道，负载为 JSON 编码的 RequestState。
+func RequestEventsChannel() string {
+	return "flash_sale:request:events"
+}
+
+// UserPurchasedQtyKey 记录某用户在某商品上已占用的购买数量（用于每人限购）。
+func UserPurchasedQtyKey(productID uint, userID int64) string {
+	return fmt.Sprintf("flash_sale:purchase:qty:%d:%d", productID, userID)
+}
+
+// UserQuotaReleaseKey 标记某个 request_id 是否已归还过限购额度。
+func UserQuotaReleaseKey(requestID string) string {
+	return fmt.Sprintf("flash_sale:purchase:released:%s", requestID)
+}
+
+// LotteryEnqueuedKey 标记某个中签请求是否已投递（已扣库存、占用限购额度并写入 outbox）。
+func LotteryEnqueuedKey(requestID string) string {
+	return fmt.Sprintf("flash_sale:lottery:enqueued:%s", requestID)
 }
 
 // RequestIdempotencyKey 将客户端幂等键映射到 request_id。
 func RequestIdempotencyKey(productID uint, userID int64, idemKey string) string {
 	return fmt.Sprintf("flash_sale:idem:%d:%d:%s", productID, userID, idemKey)
 }
+
+// RequestNonceKey 登记签名请求已使用的 nonce（SET NX），防止重放。
+func RequestNonceKey(clientID, nonce string) string {
+	return fmt.Sprintf("flash_sale:nonce:%s:%s", clientID, nonce)
+}
+
+// PowUsedKey 登记已使用的工作量证明挑战（SET NX），每个挑战只能下单一次。
+func PowUsedKey(challengeID string) string {
+	return fmt.Sprintf("flash_sale:pow:used:%s", challengeID)
+}
+
+// StreamClaimCountKey 记录 stream 中每条消息被跨消费者接管（XAUTOCLAIM）的次数。
+func StreamClaimCountKey(stream string) string {
+	return fmt.Sprintf("%s:claims", stream)
+}
+
+// DeadLetterStreamKey 存放无法继续处理的毒消息，供人工排查与重投。
+func DeadLetterStreamKey(stream string) string {
+	return fmt.Sprintf("%s:dlq", stream)
+}
+
+// DLQRedrivenKey 记录死信 topic 中已重投的消息（partition:offset），防止重复重投。
+func DLQRedrivenKey(topic string) string {
+	return fmt.Sprintf("flash_sale:dlq:redriven:%s", topic)
+}
+
+// RegistrationKey 是商品的预约用户集合（SET，member 为 user_id），下单 Lua 据此拦截未预约用户。
+func RegistrationKey(productID uint) string {
+	return fmt.Sprintf("flash_sale:registration:%d", productID)
+}
+
+// WaitingRoomQueueKey 是商品等待室的排队队列（ZSET，member 为 user_id，score 为首次入队毫秒时间戳）。
+func WaitingRoomQueueKey(productID uint) string {
+	return fmt.Sprintf("flash_sale:waitroom:%d:queue", productID)
+}
+
+// WaitingRoomAdmittedKey 记录已放行的用户（ZSET，score 为准入凭证过期的毫秒时间戳）。
+func WaitingRoomAdmittedKey(productID uint) string {
+	return fmt.Sprintf("flash_sale:waitroom:%d:admitted", productID)
+}
+
+// WaitingRoomLastAdmitKey 记录商品等待室上次放行的毫秒时间戳，多实例共享放行速率。
+func WaitingRoomLastAdmitKey(productID uint) string {
+	return fmt.Sprintf("flash_sale:waitroom:%d:last_admit", productID)
+}
+
+// WaitingRoomsKey 是有用户排队的商品集合，放行任务只扫描其中的商品。
+func WaitingRoomsKey() string {
+	return "flash_sale:waitroom:rooms"
+}
+
+// BlacklistKey 是某一维度（user / ip / device）的黑名单集合（SET），下单 Lua 据此拦截。
+func BlacklistKey(kind string) string {
+	return fmt.Sprintf("flash_sale:blacklist:%s", kind)
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	rd "github.com/redis/go-redis/v9"
@@ -14,14 +15,18 @@ const (
 	RequestSuccess = "success"
 	// RequestFailed 表示异步建单失败（已终态）。
 	RequestFailed = "failed"
+	// RequestNotSelected 表示抽签落选（已终态）。
+	RequestNotSelected = "not_selected"
+	// RequestDenied 表示请求被风控拒绝（已终态，未扣库存），Reason 为原因码。
+	RequestDenied = "denied"
 )
 
 // RequestState 对应 Redis 内的 request 状态结构。
 type RequestState struct {
-	RequestID string
-	Status    string
-	OrderNo   string
-	Reason    string
+	RequestID string `json:"request_id"`
+	Status    string `json:"status"`
+	OrderNo   string `json:"order_no,omitempty"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 // GetRequestState 查询 request_id 当前状态。found=false 表示 key 不存在。
@@ -48,17 +53,35 @@ func GetRequestState(ctx context.Context, rdb *rd.Client, requestID string) (Req
 }
 
 // PutRequestState 更新 request 状态，并刷新 key TTL。
+// 进入终态时同时移出 pending 索引与 Relay / 死信登记（清扫任务不再关注该请求），并在 RequestEventsChannel 上发布，供结果推送使用。
 func PutRequestState(ctx context.Context, rdb *rd.Client, requestID, status, orderNo, reason string, ttl time.Duration) error {
-	key := RequestStatusKey(requestID)
+	return PutRequestStates(ctx, rdb, []RequestState{{RequestID: requestID, Status: status, OrderNo: orderNo, Reason: reason}}, ttl)
+}
+
+// PutRequestStates 批量更新 request 状态，语义同 PutRequestState，一次事务管道提交。
+func PutRequestStates(ctx context.Context, rdb *rd.Client, states []RequestState, ttl time.Duration) error {
 	pipe := rdb.TxPipeline()
-	pipe.HSet(ctx, key,
-		"request_id", requestID,
-		"status", status,
-		"order_no", orderNo,
-		"reason", reason,
-	)
-	if ttl > 0 {
-		pipe.Expire(ctx, key, ttl)
+	for _, st := range states {
+		key := RequestStatusKey(st.RequestID)
+		pipe.HSet(ctx, key,
+			"request_id", st.RequestID,
+			"status", st.Status,
+			"order_no", st.OrderNo,
+			"reason", st.Reason,
+		)
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		if st.Status != RequestPending {
+			pipe.ZRem(ctx, PendingRequestsKey(), st.RequestID)
+			pipe.SRem(ctx, RelayedRequestsKey(), st.RequestID)
+			pipe.SRem(ctx, DeadLetteredRequestsKey(), st.RequestID)
+			event, err := json.Marshal(st)
+			if err != nil {
+				return err
+			}
+			pipe.Publish(ctx, RequestEventsChannel(), event)
+		}
 	}
 	_, err := pipe.Exec(ctx)
 	return err
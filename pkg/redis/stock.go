@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// StockUnit 为一个库存单元及其库存：SKUID 为 0 表示商品级库存。
+type StockUnit struct {
+	ProductID uint
+	SKUID     uint
+	Stock     int64
+}
+
+// OverwriteStock 在同一个 MULTI 中读出旧库存并覆盖为 units 中的库存，
+// 返回与 units 一一对应的旧库存（键不存在时为 nil）。
+func OverwriteStock(ctx context.Context, rdb *rd.Client, units []StockUnit, ttl time.Duration) ([]*int64, error) {
+	pipe := rdb.TxPipeline()
+	gets := make([]*rd.StringCmd, len(units))
+	for i, u := range units {
+		key := StockKey(u.ProductID, u.SKUID)
+		gets[i] = pipe.Get(ctx, key)
+		pipe.Set(ctx, key, u.Stock, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, rd.Nil) {
+		return nil, err
+	}
+	return stockValues(gets)
+}
+
+// InitStock 在同一个 MULTI 中读出旧库存，仅为不存在的键写入 units 中的库存（SET NX），已存在的键保持不变，
+// 返回与 units 一一对应的旧库存（键不存在、本次写入时为 nil）。
+func InitStock(ctx context.Context, rdb *rd.Client, units []StockUnit, ttl time.Duration) ([]*int64, error) {
+	pipe := rdb.TxPipeline()
+	gets := make([]*rd.StringCmd, len(units))
+	for i, u := range units {
+		key := StockKey(u.ProductID, u.SKUID)
+		gets[i] = pipe.Get(ctx, key)
+		pipe.SetNX(ctx, key, u.Stock, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, rd.Nil) {
+		return nil, err
+	}
+	return stockValues(gets)
+}
+
+// ClearStock 在同一个 MULTI 中读出并删除 units 的库存键，返回与 units 一一对应的旧库存（键不存在时为 nil）。
+func ClearStock(ctx context.Context, rdb *rd.Client, units []StockUnit) ([]*int64, error) {
+	pipe := rdb.TxPipeline()
+	gets := make([]*rd.StringCmd, len(units))
+	for i, u := range units {
+		key := StockKey(u.ProductID, u.SKUID)
+		gets[i] = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, rd.Nil) {
+		return nil, err
+	}
+	return stockValues(gets)
+}
+
+// stockValues 解析 MULTI 中 GET 到的库存，键不存在为 nil。
+func stockValues(gets []*rd.StringCmd) ([]*int64, error) {
+	out := make([]*int64, len(gets))
+	for i, get := range gets {
+		v, err := get.Int64()
+		if errors.Is(err, rd.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[i] = &v
+	}
+	return out, nil
+}
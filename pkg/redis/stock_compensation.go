@@ -7,7 +7,12 @@ import (
 	rd "github.com/redis/go-redis/v9"
 )
 
+// CompensationMarkTTL 为回补/额度归还标记的保留时长；超过该时长的请求无法再判定是否已回补。
+const CompensationMarkTTL = 7 * 24 * time.Hour
+
 // luaCompensateStockOnce 通过 SETNX 锁保证“同一请求只回补一次”。
+// 锁的值记录回补后的库存（after:<n>），重复调用时原样返回，供调用方补写审计。
+// 返回 {是否本次回补, 回补后库存}；锁由旧版本写入（值为 1）时库存为 nil。
 const luaCompensateStockOnce = `
 local lockKey = KEYS[1]
 local stockKey = KEYS[2]
@@ -15,24 +20,45 @@ local quantity = tonumber(ARGV[1])
 local ttlSec = tonumber(ARGV[2])
 
 if redis.call('SETNX', lockKey, '1') == 1 then
-  redis.call('EXPIRE', lockKey, ttlSec)
-  redis.call('INCRBY', stockKey, quantity)
-  return 1
+  local after = redis.call('INCRBY', stockKey, quantity)
+  redis.call('SET', lockKey, 'after:' .. after, 'EX', ttlSec)
+  return {1, after}
+end
+local after = string.match(redis.call('GET', lockKey) or '', '^after:(%-?%d+)$')
+if after then
+  return {0, tonumber(after)}
 end
-return 0
+return {0, false}
 `
 
+// Compensation 为一次幂等回补的结果。
+type Compensation struct {
+	// Applied 为 true 表示本次调用完成了回补；false 表示该请求此前已回补过。
+	Applied bool
+	// StockAfter 为（首次）回补后的库存，无法得知时为 nil。
+	StockAfter *int64
+}
+
 // CompensateStockOnce 幂等回补库存：
-// - 首次回补返回 true
-// - 重复回补返回 false（不会重复加库存）
-func CompensateStockOnce(ctx context.Context, rdb *rd.Client, requestID string, productID uint, quantity int64) (bool, error) {
+// - 首次回补返回 Applied=true
+// - 重复回补返回 Applied=false（不会重复加库存），StockAfter 仍为首次回补后的库存
+func CompensateStockOnce(ctx context.Context, rdb *rd.Client, requestID string, productID, skuID uint, quantity int64) (Compensation, error) {
 	lockKey := CompensationLockKey(requestID)
-	stockKey := StockKey(productID)
-	const lockTTLSeconds = int64((7 * 24 * time.Hour) / time.Second)
+	stockKey := StockKey(productID, skuID)
+	const lockTTLSeconds = int64(CompensationMarkTTL / time.Second)
 
-	n, err := rdb.Eval(ctx, luaCompensateStockOnce, []string{lockKey, stockKey}, quantity, lockTTLSeconds).Int()
+	res, err := rdb.Eval(ctx, luaCompensateStockOnce, []string{lockKey, stockKey}, quantity, lockTTLSeconds).Slice()
 	if err != nil {
-		return false, err
+		return Compensation{}, err
+	}
+	out := Compensation{}
+	if len(res) > 0 {
+		out.Applied = res[0] == int64(1)
+	}
+	if len(res) > 1 {
+		if after, ok := res[1].(int64); ok {
+			out.StockAfter = &after
+		}
 	}
-	return n == 1, nil
+	return out, nil
 }
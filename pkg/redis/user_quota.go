@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	rd "github.com/redis/go-redis/v9"
+)
+
+// luaReleaseUserQuotaOnce 通过 SETNX 标记保证“同一请求只归还一次限购额度”。
+// 归还后额度 <= 0 时直接删除计数 key。
+const luaReleaseUserQuotaOnce = `
+local markKey = KEYS[1]
+local qtyKey = KEYS[2]
+local quantity = tonumber(ARGV[1])
+local ttlSec = tonumber(ARGV[2])
+
+if redis.call('SETNX', markKey, '1') == 1 then
+  redis.call('EXPIRE', markKey, ttlSec)
+  local left = redis.call('DECRBY', qtyKey, quantity)
+  if left <= 0 then
+    redis.call('DEL', qtyKey)
+  end
+  return 1
+end
+return 0
+`
+
+// ReleaseUserQuotaOnce 幂等归还用户在某商品上已占用的限购额度：
+// - 首次归还返回 true
+// - 重复归还返回 false（不会重复扣减计数）
+func ReleaseUserQuotaOnce(ctx context.Context, rdb *rd.Client, requestID string, productID uint, userID int64, quantity int64) (bool, error) {
+	markKey := UserQuotaReleaseKey(requestID)
+	qtyKey := UserPurchasedQtyKey(productID, userID)
+	const markTTLSeconds = int64(CompensationMarkTTL / time.Second)
+
+	n, err := rdb.Eval(ctx, luaReleaseUserQuotaOnce, []string{markKey, qtyKey}, quantity, markTTLSeconds).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}